@@ -2,9 +2,8 @@ package carbolicacid
 
 import (
     "fmt"
-    "net"
+    "net/netip"
     "sort"
-    "strings"
 )
 
 type ipv4Range struct {
@@ -17,75 +16,32 @@ type ipv6Range struct {
     endHi, endLo     uint64
 }
 
+// addrRanges: 一组前缀合并后的地址空间，IPv4 / IPv6 分开（::ffff:0:0/96 属于 IPv6）
+type addrRanges struct {
+    v4 []ipv4Range
+    v6 []ipv6Range
+}
+
 // 解析 Corefile/手写 CIDR 字符串 → CIDRSet（bit）
-// parseCIDRs v0.3.2（保留原逻辑）
-func parseCIDRs(list []string) *CIDRSet {
+//
+// v0.3.5: 基于 netip 解析，任一条目无效（含主机位非零、带 zone）即返回错误，
+// 不再静默跳过。IPv4/IPv6 按前缀的地址族区分（::ffff:0:0/96 属于 IPv6）。
+func parseCIDRs(list []string) (*CIDRSet, error) {
     cs := &CIDRSet{}
 
-    for _, raw := range list {
-        s := raw
-
-        // 自动补全掩码
-        if !strings.Contains(s, "/") {
-            ip := net.ParseIP(s)
-            if ip == nil {
-                continue
-            }
-            if ip.To4() != nil {
-                s = s + "/32"
-            } else {
-                s = s + "/128"
-            }
-        }
-
-        ip, ipNet, err := net.ParseCIDR(s)
+    for _, s := range list {
+        p, err := parsePrefix(s)
         if err != nil {
-            continue
-        }
-
-        ones, bits := ipNet.Mask.Size()
-        if bits != 32 && bits != 128 {
-            continue
+            return nil, err
         }
-        if ones < 0 || ones > bits {
-            continue
-        }
-
-        // IPv4
-        if ip4 := ip.To4(); ip4 != nil {
-            v := ipv4ToUint32(ip4)
-            shift := uint8(32 - ones)
-            shifted := v >> shift
-            cs.v4 = append(cs.v4, IPv4CIDR{
-                shifted: shifted,
-                shift:   shift,
-            })
-            continue
-        }
-
-        // IPv6
-        hi, lo := ipv6ToUint128(ip)
-        p := uint8(ones)
-
-        var shiftedHi, shiftedLo uint64
-        if p == 0 {
-            shiftedHi, shiftedLo = 0, 0
-        } else if p <= 64 {
-            shiftedHi = hi >> (64 - p)
-            shiftedLo = 0
+        if p.Addr().Is4() {
+            cs.v4 = append(cs.v4, v4CIDR(p))
         } else {
-            shiftedHi = hi
-            shiftedLo = lo >> (128 - p)
+            cs.v6 = append(cs.v6, v6CIDR(p))
         }
-
-        cs.v6 = append(cs.v6, IPv6CIDR{
-            shiftedHi: shiftedHi,
-            shiftedLo: shiftedLo,
-            prefix:    p,
-        })
     }
 
-    return cs
+    return cs, nil
 }
 
 // ---------------------------
@@ -97,15 +53,47 @@ func parseCIDRs(list []string) *CIDRSet {
 // - 所有 exclude 合并为 allowList
 // - 所有 preset/block 合并为 blockList
 //
+// v0.3.5: 实际构建逻辑在 Policy.build，这里把结果同步回 Config
 func (c *Config) initBlockList() error {
-    if len(c.Blocks) == 0 {
+    p, err := NewPolicy(c.Blocks, c.Action)
+    if err != nil {
+        return err
+    }
+    if c.EmbeddedIPv4 {
+        if err := p.EnableEmbeddedIPv4(c.NAT64); err != nil {
+            return err
+        }
+    }
+
+    c.policy = p
+    c.blockList = p.blockList
+    c.allowList = p.allowList
+    c.presetAllIP = p.allIP
+
+    // initBlockList 只在 init 中执行一次；Corefile 重新加载时 Config 整体重建，缓存随之重建
+    if c.VerdictCache > 0 {
+        c.verdicts = newVerdictCache(c.VerdictCache)
+    }
+    if c.BlockedCache > 0 {
+        c.blocked = newVerdictCache(c.BlockedCache)
+    }
+
+    return nil
+}
+
+// build: 由 Blocks 生成 blockList + allowList
+func (p *Policy) build() error {
+    if len(p.Blocks) == 0 {
         return fmt.Errorf("carbolicacid: no preset/block configured")
     }
 
     var globalBlock CIDRSet
-    var allExcl []string
+    var allExcl CIDRSet
+
+    for _, b := range p.Blocks {
+        var parentCIDRs []string
+        var nodeBlock, nodeExcl CIDRSet
 
-    for _, b := range c.Blocks {
         switch b.Kind {
 
         // -------------------------
@@ -114,77 +102,89 @@ func (c *Config) initBlockList() error {
         // preset none {}
         // -------------------------
         case RulePreset:
-            presetSet, err := loadPresetBit(b.Value)
+            list, err := presetCIDRs(b.Value)
             if err != nil {
                 return err
             }
-            globalBlock.v4 = append(globalBlock.v4, presetSet.v4...)
-            globalBlock.v6 = append(globalBlock.v6, presetSet.v6...)
+            for _, cidr := range list {
+                if err := globalBlock.addRule(Rule{Node: b, CIDR: cidr}); err != nil {
+                    return err
+                }
+            }
 
             // 父 CIDR 列表
-            var parentCIDRs []string
+            parentCIDRs = list
             switch b.Value {
-            case "iana":
-                parentCIDRs = append(parentCIDRs, ianaPresetV4...)
-                parentCIDRs = append(parentCIDRs, ianaPresetV6...)
             case "allip":
-                parentCIDRs = append(parentCIDRs, "0.0.0.0/0", "::/0")
-                c.presetAllIP = true   // 记录 allip 在使用状态
+                p.allIP = true   // 记录 allip 在使用状态
             case "none":
                 if len(b.Excl) > 0 {
                     return fmt.Errorf("preset 'none' cannot have excludes")
                 }
-            default:
-                return fmt.Errorf("unknown preset: %s", b.Value)
-            }
-
-            // exclude 必须是 preset 的子集
-            for _, ex := range b.Excl {
-                ok, err := cidrSubsetOfAny(ex, parentCIDRs)
-                if err != nil {
-                    return err
-                }
-                if !ok {
-                    return fmt.Errorf("exclude %q is not subset of preset %q", ex, b.Value)
-                }
-                allExcl = append(allExcl, ex)
             }
 
         // -------------------------
         // block CIDR { exclude ... }
         // -------------------------
         case RuleInclude:
-            blockSet := parseCIDRs([]string{b.Value})
-            globalBlock.v4 = append(globalBlock.v4, blockSet.v4...)
-            globalBlock.v6 = append(globalBlock.v6, blockSet.v6...)
-
-            parentCIDRs := []string{b.Value}
-
-            for _, ex := range b.Excl {
-                ok, err := cidrSubsetOfAny(ex, parentCIDRs)
-                if err != nil {
-                    return err
-                }
-                if !ok {
-                    return fmt.Errorf("exclude %q is not subset of block %q", ex, b.Value)
-                }
-                allExcl = append(allExcl, ex)
+            if err := globalBlock.addRule(Rule{Node: b, CIDR: b.Value}); err != nil {
+                return err
             }
+            parentCIDRs = []string{b.Value}
 
         default:
             return fmt.Errorf("unsupported block kind: %v", b.Kind)
         }
+
+        // exclude 必须是父节点的子集
+        for _, ex := range b.Excl {
+            ok, err := cidrSubsetOfAny(ex, parentCIDRs)
+            if err != nil {
+                return err
+            }
+            if !ok {
+                return &CIDRError{Kind: ErrNotSubset, CIDR: ex, Detail: "parent is " + b.String()}
+            }
+            if err := allExcl.addRule(Rule{Node: b, CIDR: ex, Exclude: true}); err != nil {
+                return err
+            }
+            nodeExcl.addRule(Rule{Node: b, CIDR: ex, Exclude: true})
+        }
+
+        // exclude 合起来覆盖了父节点的全部地址：该节点不阻断任何地址，多半是写错了
+        if len(b.Excl) > 0 {
+            for _, cidr := range parentCIDRs {
+                nodeBlock.addRule(Rule{Node: b, CIDR: cidr})
+            }
+            if nodeBlock.ranges().minus(nodeExcl.ranges()).empty() {
+                return &CIDRError{Kind: ErrFullyExcluded, CIDR: b.Excl[len(b.Excl)-1], Detail: b.String() + " blocks nothing"}
+            }
+        }
     }
 
     // 构建 blockList
-    c.blockList = buildIPSet(&globalBlock)
+    p.blockList = buildIPSet(&globalBlock)
+
+    // 规范化后的地址空间：生效的阻断范围 = blockList − allowList（与 MatchAddr 一致）
+    p.excluded = allExcl.ranges()
+    p.blocked = globalBlock.ranges().minus(p.excluded)
+
+    // allip 模式下无 A/AAAA 的响应也会被阻断，归因到第一条 allip 规则
+    if p.allIP {
+        for i := range p.blockList.rules {
+            r := &p.blockList.rules[i]
+            if r.Node.Kind == RulePreset && r.Node.Value == "allip" {
+                p.allIPRule = r
+                break
+            }
+        }
+    }
 
     // 构建 allowList
-    if len(allExcl) > 0 {
-        exclSet := parseCIDRs(allExcl)
-        c.allowList = buildIPSet(exclSet)
+    if len(allExcl.rules) > 0 {
+        p.allowList = buildIPSet(&allExcl)
     } else {
-        c.allowList = nil
+        p.allowList = nil
     }
 
     return nil
@@ -193,27 +193,72 @@ func (c *Config) initBlockList() error {
 // ---------------------------
 // exclude 子集检查
 // ---------------------------
+//
+// child 必须包含于 parents 的并集，可以跨越相邻的父前缀
+// （例如 preset iana 的 224.0.0.0/4 与 240.0.0.0/4 合起来的 224.0.0.0/3）。
 func cidrSubsetOfAny(child string, parents []string) (bool, error) {
-    _, childNet, err := net.ParseCIDR(child)
+    c, err := parsePrefix(child)
     if err != nil {
-        return false, fmt.Errorf("invalid exclude CIDR %q: %v", child, err)
+        return false, err
     }
 
+    var list []netip.Prefix
     for _, ps := range parents {
-        _, parentNet, err := net.ParseCIDR(ps)
+        p, err := parsePrefix(ps)
         if err != nil {
-            continue
+            continue // 父前缀的错误由 addRule 报告
         }
+        list = append(list, p)
+    }
 
-        pOnes, _ := parentNet.Mask.Size()
-        cOnes, _ := childNet.Mask.Size()
+    return prefixWithin(c, list), nil
+}
 
-        if pOnes <= cOnes && parentNet.Contains(childNet.IP) {
-            return true, nil
+// prefixWithin: child 是否包含于 parents 的并集（同一地址族）
+func prefixWithin(child netip.Prefix, parents []netip.Prefix) bool {
+    for _, p := range parents {
+        if prefixSubset(child, p) {
+            return true // 常见情况：包含于单个父前缀
         }
     }
+    return prefixRanges(child).minus(prefixRanges(parents...)).empty()
+}
+
+// ---------------------------
+// 区间形式的地址空间
+// ---------------------------
+
+// ranges: 集合中全部前缀合并后的区间
+func (cs *CIDRSet) ranges() addrRanges {
+    return addrRanges{
+        v4: mergeIPv4Ranges(cidrV4ToRanges(cs.v4)),
+        v6: mergeIPv6Ranges(cidrV6ToRanges(cs.v6)),
+    }
+}
+
+// prefixRanges: 一组已校验前缀合并后的区间
+func prefixRanges(list ...netip.Prefix) addrRanges {
+    var cs CIDRSet
+    for _, p := range list {
+        if p.Addr().Is4() {
+            cs.v4 = append(cs.v4, v4CIDR(p))
+        } else {
+            cs.v6 = append(cs.v6, v6CIDR(p))
+        }
+    }
+    return cs.ranges()
+}
+
+// minus: a − b
+func (a addrRanges) minus(b addrRanges) addrRanges {
+    return addrRanges{
+        v4: diffIPv4Ranges(a.v4, b.v4),
+        v6: diffIPv6Ranges(a.v6, b.v6),
+    }
+}
 
-    return false, nil
+func (a addrRanges) empty() bool {
+    return len(a.v4) == 0 && len(a.v6) == 0
 }
 
 // ---------------------------
@@ -241,6 +286,7 @@ func buildIPSet(c *CIDRSet) *IPSet {
     sort.Slice(out.v4.rest, func(i, j int) bool { return out.v4.rest[i].shifted < out.v4.rest[j].shifted })
 
     out.v6 = c.v6
+    out.rules = c.rules
 
     return &out
 }
\ No newline at end of file
@@ -0,0 +1,117 @@
+package carbolicacid
+
+import "sort"
+
+// IPv4 区间运算，与 bit_ipv6_ranges.go 一一对应
+//
+// 区间端点为 uint32，中间计算使用 uint64，255.255.255.255 + 1 不会溢出。
+
+func cidrV4ToRanges(c []IPv4CIDR) []ipv4Range {
+    if len(c) == 0 {
+        return nil
+    }
+    out := make([]ipv4Range, 0, len(c))
+    for _, v := range c {
+        start := uint64(v.shifted) << v.shift // shift = 32 时 shifted 为 0
+        end := start | (uint64(1)<<v.shift - 1)
+        out = append(out, ipv4Range{start: uint32(start), end: uint32(end)})
+    }
+    return out
+}
+
+// mergeIPv4Ranges: 排序并合并重叠或相邻的区间（会重排 in）
+func mergeIPv4Ranges(in []ipv4Range) []ipv4Range {
+    if len(in) == 0 {
+        return nil
+    }
+    sort.Slice(in, func(i, j int) bool { return in[i].start < in[j].start })
+
+    out := make([]ipv4Range, 0, len(in))
+    cur := in[0]
+    for _, r := range in[1:] {
+        if uint64(r.start) <= uint64(cur.end)+1 {
+            if r.end > cur.end {
+                cur.end = r.end
+            }
+            continue
+        }
+        out = append(out, cur)
+        cur = r
+    }
+    return append(out, cur)
+}
+
+// diffIPv4Ranges: preset − excl；两者都必须是 mergeIPv4Ranges 的结果（有序、不重叠）
+func diffIPv4Ranges(preset, excl []ipv4Range) []ipv4Range {
+    if len(preset) == 0 {
+        return nil
+    }
+    if len(excl) == 0 {
+        return preset
+    }
+
+    out := make([]ipv4Range, 0, len(preset))
+    j := 0
+
+    for _, p := range preset {
+        curStart := p.start
+
+        // 跳过所有完全在左侧的 exclude
+        for j < len(excl) && excl[j].end < curStart {
+            j++
+        }
+
+        alive := true
+        for k := j; k < len(excl) && excl[k].start <= p.end; k++ {
+            e := excl[k]
+
+            // exclude 左侧剩下的部分 [curStart, e.start-1]
+            if curStart < e.start {
+                out = append(out, ipv4Range{start: curStart, end: e.start - 1})
+            }
+
+            // exclude 覆盖到当前段末尾：整段处理完毕
+            if e.end >= p.end {
+                alive = false
+                break
+            }
+
+            // e.end < p.end，e.end + 1 不会溢出
+            curStart = e.end + 1
+        }
+
+        if alive {
+            out = append(out, ipv4Range{start: curStart, end: p.end})
+        }
+    }
+
+    return out
+}
+
+// ipv4RangesToCIDRs: 区间 → 最少的前缀集合
+func ipv4RangesToCIDRs(ranges []ipv4Range) []IPv4CIDR {
+    var out []IPv4CIDR
+
+    for _, r := range ranges {
+        start, end := uint64(r.start), uint64(r.end)
+
+        for start <= end {
+            // 对齐限制与长度限制同时满足的最大块 2^shift
+            shift := uint8(32)
+            if start != 0 {
+                shift = uint8(trailingZeros64(start))
+            }
+            for start+uint64(1)<<shift-1 > end {
+                shift--
+            }
+
+            out = append(out, IPv4CIDR{
+                shifted: uint32(start >> shift),
+                shift:   shift,
+            })
+            start += uint64(1) << shift
+        }
+    }
+
+    return out
+}
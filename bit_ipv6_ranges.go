@@ -125,6 +125,7 @@ func cidrV6ToRanges(c []IPv6CIDR) []ipv6Range {
     return out
 }
 
+// mergeIPv6Ranges: 排序并合并重叠或相邻的区间（会重排 in）
 func mergeIPv6Ranges(in []ipv6Range) []ipv6Range {
     if len(in) == 0 {
         return nil
@@ -134,28 +135,22 @@ func mergeIPv6Ranges(in []ipv6Range) []ipv6Range {
     })
     out := make([]ipv6Range, 0, len(in))
     cur := in[0]
-    for i := 1; i < len(in); i++ {
-        r := in[i]
-        // r.start <= cur.end + 1
-        if !less128(cur.endHi, cur.endLo, r.startHi, r.startLo) &&
-            !less128(r.startHi, r.startLo, cur.startHi, cur.startLo) {
-            // 简化版合并逻辑留给你后面精简，这里先写成直接覆盖
-        }
-        // 简化：直接用区间重叠判断
-        if le128(r.startHi, r.startLo, cur.endHi, cur.endLo+1) {
-            // 合并
+    for _, r := range in[1:] {
+        // r.start <= cur.end + 1（cur.end 为最大地址时一定可以合并）
+        full := cur.endHi == ^uint64(0) && cur.endLo == ^uint64(0)
+        if nextHi, nextLo := add128(cur.endHi, cur.endLo, 0); full || le128(r.startHi, r.startLo, nextHi, nextLo) {
             if less128(cur.endHi, cur.endLo, r.endHi, r.endLo) {
                 cur.endHi, cur.endLo = r.endHi, r.endLo
             }
-        } else {
-            out = append(out, cur)
-            cur = r
+            continue
         }
+        out = append(out, cur)
+        cur = r
     }
-    out = append(out, cur)
-    return out
+    return append(out, cur)
 }
 
+// diffIPv6Ranges: preset − excl；两者都必须是 mergeIPv6Ranges 的结果（有序、不重叠）
 func diffIPv6Ranges(preset, excl []ipv6Range) []ipv6Range {
     if len(preset) == 0 {
         return nil
@@ -169,93 +164,66 @@ func diffIPv6Ranges(preset, excl []ipv6Range) []ipv6Range {
 
     for _, p := range preset {
         curStartHi, curStartLo := p.startHi, p.startLo
-        curEndHi, curEndLo := p.endHi, p.endLo
 
         // 跳过所有完全在左侧的 exclude: excl[j].end < curStart
         for j < len(excl) && less128(excl[j].endHi, excl[j].endLo, curStartHi, curStartLo) {
             j++
         }
 
-        k := j
-        for k < len(excl) && !less128(curEndHi, curEndLo, excl[k].startHi, excl[k].startLo) {
+        alive := true
+        for k := j; k < len(excl) && le128(excl[k].startHi, excl[k].startLo, p.endHi, p.endLo); k++ {
             e := excl[k]
 
-            // 1) exclude 完全覆盖当前区间: e.start <= curStart && e.end >= curEnd
-            if !less128(e.startHi, e.startLo, curStartHi, curStartLo) &&
-                !less128(curEndHi, curEndLo, e.endHi, e.endLo) {
-                // 整段被吃掉
-                curStartHi, curStartLo = 1, 0
-                curEndHi, curEndLo = 0, 0
-                break
-            }
-
-            // 2) exclude 覆盖左侧: e.start <= curStart && e.end < curEnd
-            if !less128(e.startHi, e.startLo, curStartHi, curStartLo) &&
-                less128(e.endHi, e.endLo, curEndHi, curEndLo) {
-                // 左边被截断，curStart 移到 e.end + 1
-                curStartHi, curStartLo = add128(e.endHi, e.endLo, 0)
-            } else if less128(curStartHi, curStartLo, e.startHi, e.startLo) &&
-                less128(e.endHi, e.endLo, curEndHi, curEndLo) {
-                // 3) exclude 在中间挖洞: curStart < e.start <= e.end < curEnd
-                // 先把左半段 [curStart, e.start-1] 收进去
+            // exclude 左侧剩下的部分 [curStart, e.start-1]
+            if less128(curStartHi, curStartLo, e.startHi, e.startLo) {
                 holeEndHi, holeEndLo := sub128(e.startHi, e.startLo, 0)
                 out = append(out, ipv6Range{
                     startHi: curStartHi, startLo: curStartLo,
                     endHi:   holeEndHi,  endLo:   holeEndLo,
                 })
-                // 再把 curStart 移到 e.end + 1
-                curStartHi, curStartLo = add128(e.endHi, e.endLo, 0)
-            } else if less128(curStartHi, curStartLo, e.startHi, e.startLo) &&
-                !less128(curEndHi, curEndLo, e.endHi, e.endLo) {
-                // 4) exclude 覆盖右侧: curStart < e.start && e.end >= curEnd
-                // 截断右边: curEnd = e.start - 1
-                curEndHi, curEndLo = sub128(e.startHi, e.startLo, 0)
+            }
+
+            // exclude 覆盖到当前段末尾：整段处理完毕
+            if ge128(e.endHi, e.endLo, p.endHi, p.endLo) {
+                alive = false
                 break
             }
 
-            k++
+            // e.end < p.end，e.end + 1 不会溢出
+            curStartHi, curStartLo = add128(e.endHi, e.endLo, 0)
         }
 
-        // 当前段被完全吃掉
-        if !less128(curStartHi, curStartLo, curEndHi, curEndLo) &&
-            !(curStartHi == curEndHi && curStartLo == curEndLo) {
-            continue
+        if alive {
+            out = append(out, ipv6Range{
+                startHi: curStartHi, startLo: curStartLo,
+                endHi:   p.endHi,    endLo:   p.endLo,
+            })
         }
-
-        // 剩余部分加入结果
-        out = append(out, ipv6Range{
-            startHi: curStartHi, startLo: curStartLo,
-            endHi:   curEndHi,   endLo:   curEndLo,
-        })
     }
 
     return out
 }
 
+// ipv6RangesToCIDRs: 区间 → 最少的前缀集合
 func ipv6RangesToCIDRs(ranges []ipv6Range) []IPv6CIDR {
     var out []IPv6CIDR
 
     for _, r := range ranges {
         startHi, startLo := r.startHi, r.startLo
-        endHi, endLo := r.endHi, r.endLo
-
-        for le128(startHi, startLo, endHi, endLo) {
-            // 1) 对齐限制：start 能对齐的最大前缀
-            tz := trailingZeros128(startHi, startLo) // 0–128
-            alignPrefix := uint8(128 - tz)
-
-            // 2) 长度限制：区间长度能容纳的最大块
-            lenHi, lenLo := inclusiveLen128(startHi, startLo, endHi, endLo)
-            maxBits := highestBit128(lenHi, lenLo)      // blockSize = 1 << maxBits
-            lengthPrefix := uint8(128 - maxBits)        // 对应前缀长度
-
-            // 3) 取两者中“更长的前缀”（更小的块）
-            prefix := alignPrefix
-            if lengthPrefix > prefix {
-                prefix = lengthPrefix
+
+        for {
+            // 1) 对齐限制：start 能对齐的最大块 2^bits
+            bits := trailingZeros128(startHi, startLo) // 0–128
+
+            // 2) 长度限制：区间剩余长度能容纳的最大块（长度为 2^128 时不受限）
+            if lenHi, lenLo, full := inclusiveLen128(startHi, startLo, r.endHi, r.endLo); !full {
+                if hb := highestBit128(lenHi, lenLo); hb < bits {
+                    bits = hb
+                }
             }
+            prefix := uint8(128 - bits)
 
-            // 4) 计算 shiftedHi/shiftedLo（预右移）
+            // 3) 计算 shiftedHi/shiftedLo（预右移）
             var shiftedHi, shiftedLo uint64
             if prefix == 0 {
                 shiftedHi, shiftedLo = 0, 0
@@ -273,15 +241,30 @@ func ipv6RangesToCIDRs(ranges []ipv6Range) []IPv6CIDR {
                 prefix:    prefix,
             })
 
-            // 5) 前进到下一个块起点：start += 2^(128 - prefix)
-            incBits := uint8(128 - prefix)
-            startHi, startLo = add128(startHi, startLo, incBits)
+            // 4) 块末尾到达区间末尾则结束，否则前进到下一个块起点：start += 2^bits
+            endHi, endLo := blockEnd128(startHi, startLo, bits)
+            if endHi == r.endHi && endLo == r.endLo {
+                break
+            }
+            startHi, startLo = add128(startHi, startLo, uint8(bits))
         }
     }
 
     return out
 }
 
+// blockEnd128: 以 start 对齐的 2^bits 大小块的最后一个地址
+func blockEnd128(hi, lo uint64, bits int) (uint64, uint64) {
+    switch {
+    case bits >= 128:
+        return ^uint64(0), ^uint64(0)
+    case bits >= 64:
+        return hi | (uint64(1)<<(bits-64) - 1), ^uint64(0)
+    default:
+        return hi, lo | (uint64(1)<<bits - 1)
+    }
+}
+
 func trailingZeros128(hi, lo uint64) int {
     if hi == 0 && lo == 0 {
         return 128
@@ -304,7 +287,8 @@ func trailingZeros64(v uint64) int {
     return n
 }
 
-func inclusiveLen128(startHi, startLo, endHi, endLo uint64) (uint64, uint64) {
+// inclusiveLen128: end - start + 1；长度为 2^128（整个地址空间）时 full 为 true
+func inclusiveLen128(startHi, startLo, endHi, endLo uint64) (uint64, uint64, bool) {
     // diff = end - start
     var diffHi, diffLo uint64
     if endLo >= startLo {
@@ -317,9 +301,12 @@ func inclusiveLen128(startHi, startLo, endHi, endLo uint64) (uint64, uint64) {
 
     // len = diff + 1
     if diffLo == ^uint64(0) {
-        return diffHi + 1, 0
+        if diffHi == ^uint64(0) {
+            return 0, 0, true
+        }
+        return diffHi + 1, 0, false
     }
-    return diffHi, diffLo + 1
+    return diffHi, diffLo + 1, false
 }
 
 func highestBit128(hi, lo uint64) int {
@@ -0,0 +1,70 @@
+package carbolicacid
+
+import (
+    "net/netip"
+    "reflect"
+    "testing"
+)
+
+func v6Ranges(prefixes ...string) []ipv6Range {
+    var c []IPv6CIDR
+    for _, s := range prefixes {
+        c = append(c, v6CIDR(netip.MustParsePrefix(s)))
+    }
+    return cidrV6ToRanges(c)
+}
+
+func v6CIDRs(prefixes ...string) []IPv6CIDR {
+    var out []IPv6CIDR
+    for _, s := range prefixes {
+        out = append(out, v6CIDR(netip.MustParsePrefix(s)))
+    }
+    return out
+}
+
+// 区间跨越低 64 位进位、到达地址空间末尾时的合并 / 求差 / 转前缀
+func TestIPv6RangeHelpers(t *testing.T) {
+    tests := []struct {
+        name    string
+        preset  []string
+        exclude []string
+        want    []string
+    }{
+        // 相邻区间在低 64 位全 1 处衔接，cur.end + 1 需要进位到高 64 位
+        {"adjacent across carry", []string{"2001:db8::/64", "2001:db8:0:1::/64"}, nil, []string{"2001:db8::/63"}},
+        {"whole space", []string{"::/0"}, nil, []string{"::/0"}},
+        {"top of space", []string{"ffff::/16"}, nil, []string{"ffff::/16"}},
+        {"last address", []string{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff/128"}, nil, []string{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff/128"}},
+        {"whole minus lower half", []string{"::/0"}, []string{"::/1"}, []string{"8000::/1"}},
+        {"whole minus upper half", []string{"::/0"}, []string{"8000::/1"}, []string{"::/1"}},
+        {"hole in the middle", []string{"2001:db8::/32"}, []string{"2001:db8:8000::/33"}, []string{"2001:db8::/33"}},
+        {"exclude covers all", []string{"2001:db8::/32"}, []string{"2001::/16"}, nil},
+        {"two holes", []string{"2001:db8::/126"}, []string{"2001:db8::1/128", "2001:db8::2/128"}, []string{"2001:db8::/128", "2001:db8::3/128"}},
+        {"exclude ends at top", []string{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffc/126"}, []string{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff/128"}, []string{
+            "ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffc/127", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe/128",
+        }},
+    }
+
+    for _, tc := range tests {
+        merged := mergeIPv6Ranges(v6Ranges(tc.preset...))
+        if len(tc.exclude) > 0 {
+            merged = diffIPv6Ranges(merged, mergeIPv6Ranges(v6Ranges(tc.exclude...)))
+        }
+        got := ipv6RangesToCIDRs(merged)
+        if want := v6CIDRs(tc.want...); !reflect.DeepEqual(got, want) {
+            t.Errorf("%s: got %d prefixes %v, want %d %v", tc.name, len(got), got, len(want), want)
+        }
+    }
+}
+
+func TestInclusiveLen128(t *testing.T) {
+    if hi, lo, full := inclusiveLen128(0, 0, ^uint64(0), ^uint64(0)); !full || hi != 0 || lo != 0 {
+        t.Errorf("whole space: got (%d, %d, %v), want (0, 0, true)", hi, lo, full)
+    }
+    if hi, lo, full := inclusiveLen128(0, 0, 0, ^uint64(0)); full || hi != 1 || lo != 0 {
+        t.Errorf("2^64: got (%d, %d, %v), want (1, 0, false)", hi, lo, full)
+    }
+    if hi, lo, full := inclusiveLen128(1, 5, 1, 5); full || hi != 0 || lo != 1 {
+        t.Errorf("single address: got (%d, %d, %v), want (0, 1, false)", hi, lo, full)
+    }
+}
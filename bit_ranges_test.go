@@ -0,0 +1,344 @@
+package carbolicacid
+
+import (
+    "errors"
+    "math/rand"
+    "net/netip"
+    "testing"
+)
+
+// 区间运算的性质测试：在 4096 个地址的窗口内随机生成前缀，与逐地址的位图参照实现比较。
+// 窗口放在地址空间的起点、中间、64 位进位处与末尾，覆盖溢出边界。
+
+const rangeWindow = 4096
+
+var v4Windows = []uint32{0, 0x0a000000, 0xfffff000}
+
+var v6Windows = [][2]uint64{
+    {0, 0},
+    {1, ^uint64(0) - rangeWindow/2 + 1}, // 跨越低 64 位向高 64 位的进位
+    {^uint64(0), ^uint64(0) - rangeWindow + 1},
+}
+
+// rangeInput: 由任意字节生成两组窗口内的前缀（每 3 字节一条），a / b 中的下标为窗口内偏移
+type rangeInput struct {
+    window int
+    a, b   [][2]int // 窗口内偏移（已按块大小对齐）与块大小的 log2
+}
+
+func decodeRangeInput(data []byte) rangeInput {
+    var in rangeInput
+    if len(data) == 0 {
+        return in
+    }
+    in.window = int(data[0]) % 3
+    for data = data[1:]; len(data) >= 3; data = data[3:] {
+        size := int(data[2]>>1) % 13 // 1–4096 个地址
+        off := (int(data[0])<<8 | int(data[1])) % rangeWindow
+        off &^= 1<<size - 1
+        if data[2]&1 == 0 {
+            in.a = append(in.a, [2]int{off, size})
+        } else {
+            in.b = append(in.b, [2]int{off, size})
+        }
+    }
+    return in
+}
+
+type bitmap [rangeWindow]bool
+
+func (m *bitmap) set(blocks [][2]int) {
+    for _, b := range blocks {
+        for i := b[0]; i < b[0]+1<<b[1]; i++ {
+            m[i] = true
+        }
+    }
+}
+
+func (m *bitmap) minus(o *bitmap) *bitmap {
+    var out bitmap
+    for i := range m {
+        out[i] = m[i] && !o[i]
+    }
+    return &out
+}
+
+// ---------------- IPv4 ----------------
+
+func v4Block(base uint32, b [2]int) IPv4CIDR {
+    return IPv4CIDR{shifted: (base + uint32(b[0])) >> b[1], shift: uint8(b[1])}
+}
+
+// v4Bitmap: 区间列表 → 窗口位图；同时检查区间有序、不重叠、不相邻、不越出窗口
+func v4Bitmap(t *testing.T, base uint32, ranges []ipv4Range) *bitmap {
+    t.Helper()
+    var m bitmap
+    for i, r := range ranges {
+        if r.start > r.end || r.start < base || r.end-base >= rangeWindow {
+            t.Fatalf("range %d out of window: %+v", i, r)
+        }
+        if i > 0 && uint64(ranges[i-1].end)+1 >= uint64(r.start) {
+            t.Fatalf("ranges %d and %d overlap or touch: %+v %+v", i-1, i, ranges[i-1], r)
+        }
+        for a := uint64(r.start); a <= uint64(r.end); a++ {
+            m[a-uint64(base)] = true
+        }
+    }
+    return &m
+}
+
+func checkIPv4Ranges(t *testing.T, data []byte) {
+    in := decodeRangeInput(data)
+    base := v4Windows[in.window]
+
+    var ca, cb []IPv4CIDR
+    for _, b := range in.a {
+        ca = append(ca, v4Block(base, b))
+    }
+    for _, b := range in.b {
+        cb = append(cb, v4Block(base, b))
+    }
+    var wantA, wantB bitmap
+    wantA.set(in.a)
+    wantB.set(in.b)
+
+    ra := mergeIPv4Ranges(cidrV4ToRanges(ca))
+    rb := mergeIPv4Ranges(cidrV4ToRanges(cb))
+    if *v4Bitmap(t, base, ra) != wantA {
+        t.Fatalf("merge mismatch for %v", in.a)
+    }
+
+    diff := diffIPv4Ranges(ra, rb)
+    if *v4Bitmap(t, base, diff) != *wantA.minus(&wantB) {
+        t.Fatalf("diff mismatch for %v − %v", in.a, in.b)
+    }
+
+    // 前缀 → 区间 → 前缀：覆盖相同、互不重叠、相邻的同级前缀不可再合并
+    cidrs := ipv4RangesToCIDRs(diff)
+    back := mergeIPv4Ranges(cidrV4ToRanges(cidrs))
+    if *v4Bitmap(t, base, back) != *wantA.minus(&wantB) {
+        t.Fatalf("ipv4RangesToCIDRs mismatch for %+v", diff)
+    }
+    for i := 1; i < len(cidrs); i++ {
+        a, b := cidrs[i-1], cidrs[i]
+        if a.shift == b.shift && a.shifted+1 == b.shifted && a.shifted&1 == 0 {
+            t.Fatalf("cidrs %+v and %+v should have been merged", a, b)
+        }
+    }
+}
+
+func FuzzIPv4Ranges(f *testing.F) {
+    f.Fuzz(checkIPv4Ranges) // 种子语料见 testdata/fuzz/FuzzIPv4Ranges
+}
+
+// ---------------- IPv6 ----------------
+
+// v6At: 窗口起点 + 偏移（可能向高 64 位进位）
+func v6At(base [2]uint64, off int) (uint64, uint64) {
+    lo := base[1] + uint64(off)
+    hi := base[0]
+    if lo < base[1] {
+        hi++
+    }
+    return hi, lo
+}
+
+func v6Block(base [2]uint64, b [2]int) IPv6CIDR {
+    hi, lo := v6At(base, b[0])
+    var buf [16]byte
+    for i := 0; i < 8; i++ {
+        buf[i] = byte(hi >> (56 - 8*i))
+        buf[8+i] = byte(lo >> (56 - 8*i))
+    }
+    a := netip.AddrFrom16(buf)
+    return v6CIDR(netip.PrefixFrom(a, 128-b[1]).Masked())
+}
+
+// v6Offset: 128 位地址 → 窗口内偏移，不在窗口内时 ok 为 false
+func v6Offset(base [2]uint64, hi, lo uint64) (int, bool) {
+    d := lo - base[1]
+    switch {
+    case hi == base[0] && lo >= base[1]:
+    case hi == base[0]+1 && lo < base[1]:
+    default:
+        return 0, false
+    }
+    return int(d), d < rangeWindow
+}
+
+func v6Bitmap(t *testing.T, base [2]uint64, ranges []ipv6Range) *bitmap {
+    t.Helper()
+    var m bitmap
+    for i, r := range ranges {
+        s, ok1 := v6Offset(base, r.startHi, r.startLo)
+        e, ok2 := v6Offset(base, r.endHi, r.endLo)
+        if !ok1 || !ok2 || s > e {
+            t.Fatalf("range %d out of window: %+v", i, r)
+        }
+        if i > 0 {
+            prevEnd, _ := v6Offset(base, ranges[i-1].endHi, ranges[i-1].endLo)
+            if prevEnd+1 >= s {
+                t.Fatalf("ranges %d and %d overlap or touch: %+v %+v", i-1, i, ranges[i-1], r)
+            }
+        }
+        for a := s; a <= e; a++ {
+            m[a] = true
+        }
+    }
+    return &m
+}
+
+func checkIPv6Ranges(t *testing.T, data []byte) {
+    in := decodeRangeInput(data)
+    base := v6Windows[in.window]
+
+    // 窗口起点不一定按块大小对齐，越出窗口的块丢弃
+    keep := func(blocks [][2]int) ([][2]int, []IPv6CIDR) {
+        var kept [][2]int
+        var cidrs []IPv6CIDR
+        for _, b := range blocks {
+            c := v6Block(base, b)
+            r := cidrV6ToRanges([]IPv6CIDR{c})[0]
+            s, ok1 := v6Offset(base, r.startHi, r.startLo)
+            _, ok2 := v6Offset(base, r.endHi, r.endLo)
+            if !ok1 || !ok2 {
+                continue
+            }
+            kept = append(kept, [2]int{s, b[1]})
+            cidrs = append(cidrs, c)
+        }
+        return kept, cidrs
+    }
+    blocksA, ca := keep(in.a)
+    blocksB, cb := keep(in.b)
+
+    var wantA, wantB bitmap
+    wantA.set(blocksA)
+    wantB.set(blocksB)
+
+    ra := mergeIPv6Ranges(cidrV6ToRanges(ca))
+    rb := mergeIPv6Ranges(cidrV6ToRanges(cb))
+    if *v6Bitmap(t, base, ra) != wantA {
+        t.Fatalf("merge mismatch for %v", blocksA)
+    }
+
+    diff := diffIPv6Ranges(ra, rb)
+    if *v6Bitmap(t, base, diff) != *wantA.minus(&wantB) {
+        t.Fatalf("diff mismatch for %v − %v", blocksA, blocksB)
+    }
+
+    cidrs := ipv6RangesToCIDRs(diff)
+    back := mergeIPv6Ranges(cidrV6ToRanges(cidrs))
+    if *v6Bitmap(t, base, back) != *wantA.minus(&wantB) {
+        t.Fatalf("ipv6RangesToCIDRs mismatch for %+v", diff)
+    }
+    for i := 1; i < len(cidrs); i++ {
+        a, b := cidrs[i-1], cidrs[i]
+        if a.prefix == b.prefix && a.shiftedHi == b.shiftedHi && a.prefix > 64 && a.shiftedLo+1 == b.shiftedLo && a.shiftedLo&1 == 0 {
+            t.Fatalf("cidrs %+v and %+v should have been merged", a, b)
+        }
+    }
+}
+
+func FuzzIPv6Ranges(f *testing.F) {
+    f.Fuzz(checkIPv6Ranges) // 种子语料见 testdata/fuzz/FuzzIPv6Ranges
+}
+
+func TestRangesAgainstBitmap(t *testing.T) {
+    rnd := rand.New(rand.NewSource(1))
+    for i := 0; i < 300; i++ {
+        data := make([]byte, 1+3*(1+rnd.Intn(24)))
+        rnd.Read(data)
+        checkIPv4Ranges(t, data)
+        checkIPv6Ranges(t, data)
+    }
+}
+
+// ---------------- 整个地址空间 ----------------
+
+func TestRangesFullSpace(t *testing.T) {
+    all4 := []ipv4Range{{start: 0, end: ^uint32(0)}}
+    if got := mergeIPv4Ranges([]ipv4Range{{start: 1 << 31, end: ^uint32(0)}, {start: 0, end: 1<<31 - 1}}); len(got) != 1 || got[0] != all4[0] {
+        t.Fatalf("unexpected IPv4 merge: %+v", got)
+    }
+    if c := ipv4RangesToCIDRs(all4); len(c) != 1 || c[0].shift != 32 || c[0].shifted != 0 {
+        t.Fatalf("expected 0.0.0.0/0, got %+v", c)
+    }
+    if r := cidrV4ToRanges([]IPv4CIDR{{shift: 32}}); r[0] != all4[0] {
+        t.Fatalf("unexpected range for 0.0.0.0/0: %+v", r)
+    }
+    diff := diffIPv4Ranges(all4, []ipv4Range{{0, 0}, {^uint32(0), ^uint32(0)}})
+    if len(diff) != 1 || diff[0] != (ipv4Range{start: 1, end: ^uint32(0) - 1}) {
+        t.Fatalf("unexpected IPv4 diff: %+v", diff)
+    }
+    if c := ipv4RangesToCIDRs(diff); len(c) != 62 {
+        t.Fatalf("expected 62 prefixes, got %d", len(c))
+    }
+
+    full := ipv6Range{endHi: ^uint64(0), endLo: ^uint64(0)}
+    merged := mergeIPv6Ranges([]ipv6Range{
+        {startHi: 1 << 63, endHi: ^uint64(0), endLo: ^uint64(0)},
+        {endHi: 1<<63 - 1, endLo: ^uint64(0)},
+    })
+    if len(merged) != 1 || merged[0] != full {
+        t.Fatalf("unexpected IPv6 merge: %+v", merged)
+    }
+    if c := ipv6RangesToCIDRs([]ipv6Range{full}); len(c) != 1 || c[0].prefix != 0 {
+        t.Fatalf("expected ::/0, got %+v", c)
+    }
+    diff6 := diffIPv6Ranges([]ipv6Range{full}, []ipv6Range{
+        {},
+        {startHi: ^uint64(0), startLo: ^uint64(0), endHi: ^uint64(0), endLo: ^uint64(0)},
+    })
+    if len(diff6) != 1 || diff6[0] != (ipv6Range{startLo: 1, endHi: ^uint64(0), endLo: ^uint64(0) - 1}) {
+        t.Fatalf("unexpected IPv6 diff: %+v", diff6)
+    }
+    if c := ipv6RangesToCIDRs(diff6); len(c) != 254 {
+        t.Fatalf("expected 254 prefixes, got %d", len(c))
+    }
+}
+
+// ---------------- initBlockList 中的使用 ----------------
+
+func TestExcludeRanges(t *testing.T) {
+    // 跨越 preset iana 中相邻的 224.0.0.0/4 与 240.0.0.0/4
+    p, err := NewPolicy([]*BlockNode{{Kind: RulePreset, Value: "iana", Excl: []string{"224.0.0.0/3"}}}, ActionNxdomain)
+    if err != nil {
+        t.Fatalf("NewPolicy failed: %v", err)
+    }
+    if blocked, _ := p.MatchAddr(netip.MustParseAddr("250.1.2.3")); blocked {
+        t.Fatal("expected 250.1.2.3 to be excluded")
+    }
+
+    // 不相邻的父前缀之间的空隙不算
+    _, err = NewPolicy([]*BlockNode{
+        {Kind: RulePreset, Value: "iana", Excl: []string{"192.0.0.0/22"}},
+    }, ActionNxdomain)
+    if !errors.Is(err, ErrNotSubset) {
+        t.Fatalf("expected ErrNotSubset, got %v", err)
+    }
+
+    _, err = NewPolicy([]*BlockNode{
+        {Kind: RuleInclude, Value: "10.0.0.0/24", Excl: []string{"10.0.0.0/25", "10.0.0.128/25"}},
+    }, ActionNxdomain)
+    if !errors.Is(err, ErrFullyExcluded) {
+        t.Fatalf("expected ErrFullyExcluded, got %v", err)
+    }
+
+    // blockList − allowList，已合并为最少的前缀
+    p, err = NewPolicy([]*BlockNode{
+        {Kind: RuleInclude, Value: "10.0.0.0/24", Excl: []string{"10.0.0.0/25"}},
+        {Kind: RuleInclude, Value: "10.0.1.0/24"},
+        {Kind: RuleInclude, Value: "2001:db8::/32", Excl: []string{"2001:db8:8000::/33"}},
+    }, ActionNxdomain)
+    if err != nil {
+        t.Fatalf("NewPolicy failed: %v", err)
+    }
+    s := p.BlockedSpace()
+    if got := prefixStrings(s.V4); !equalStrings(got, []string{"10.0.0.128/25", "10.0.1.0/24"}) {
+        t.Fatalf("unexpected IPv4 space: %v", got)
+    }
+    if got := prefixStrings(s.V6); !equalStrings(got, []string{"2001:db8::/33"}) {
+        t.Fatalf("unexpected IPv6 space: %v", got)
+    }
+}
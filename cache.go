@@ -0,0 +1,170 @@
+package carbolicacid
+
+import (
+    "container/list"
+    "sync"
+    "time"
+
+    "github.com/miekg/dns"
+)
+
+// verdictCache: 判定结果的 LRU 缓存
+//
+// 键为 responseKey（qname、qtype 与 A/AAAA 记录的 RDATA），条目按各自的 TTL 过期。
+type verdictCache struct {
+    size int
+
+    mu    sync.Mutex
+    ll    *list.List
+    items map[uint64]*list.Element
+}
+
+type cachedVerdict struct {
+    blocked bool
+    reason  string
+}
+
+type cacheEntry struct {
+    key    uint64
+    v      cachedVerdict
+    expire time.Time
+}
+
+func newVerdictCache(size int) *verdictCache {
+    return &verdictCache{
+        size:  size,
+        ll:    list.New(),
+        items: make(map[uint64]*list.Element, size),
+    }
+}
+
+// get: 未命中或已过期时返回 false
+func (vc *verdictCache) get(key uint64, now time.Time) (cachedVerdict, bool) {
+    vc.mu.Lock()
+    defer vc.mu.Unlock()
+
+    el, ok := vc.items[key]
+    if !ok {
+        return cachedVerdict{}, false
+    }
+    e := el.Value.(*cacheEntry)
+    if now.After(e.expire) {
+        vc.ll.Remove(el)
+        delete(vc.items, key)
+        return cachedVerdict{}, false
+    }
+    vc.ll.MoveToFront(el)
+    return e.v, true
+}
+
+// add: 写入或更新条目，超出容量时淘汰最久未使用的条目
+func (vc *verdictCache) add(key uint64, v cachedVerdict, ttl time.Duration, now time.Time) {
+    if ttl <= 0 {
+        return
+    }
+    vc.mu.Lock()
+    defer vc.mu.Unlock()
+
+    if el, ok := vc.items[key]; ok {
+        e := el.Value.(*cacheEntry)
+        e.v, e.expire = v, now.Add(ttl)
+        vc.ll.MoveToFront(el)
+        return
+    }
+
+    vc.items[key] = vc.ll.PushFront(&cacheEntry{key: key, v: v, expire: now.Add(ttl)})
+    if vc.ll.Len() > vc.size {
+        oldest := vc.ll.Back()
+        vc.ll.Remove(oldest)
+        delete(vc.items, oldest.Value.(*cacheEntry).key)
+    }
+}
+
+// len: 当前条目数（含尚未清理的过期条目）
+func (vc *verdictCache) len() int {
+    vc.mu.Lock()
+    defer vc.mu.Unlock()
+    return vc.ll.Len()
+}
+
+// defaultBlockedCacheTTL: cache_blocked 条目的默认最长保存时间
+const defaultBlockedCacheTTL = time.Minute
+
+// blockedVerdict: cache_blocked 中该查询（qname、qtype）最近一次被阻断的判定
+//
+// 查询报文没有 Answer，responseKey 只取 qname 与 qtype。
+func (c *Config) blockedVerdict(r *dns.Msg, now time.Time) (cachedVerdict, bool) {
+    if c.blocked == nil || len(r.Question) == 0 {
+        return cachedVerdict{}, false
+    }
+    return c.blocked.get(responseKey(r), now)
+}
+
+// rememberBlocked: 保存被阻断的判定，保存时间取地址记录的最小 TTL，不超过 BlockedCacheTTL
+func (c *Config) rememberBlocked(r, resp *dns.Msg, reason string, now time.Time) {
+    if c.blocked == nil || len(r.Question) == 0 {
+        return
+    }
+    ttl := time.Duration(minAnswerTTL(resp)) * time.Second
+    if ttl > c.BlockedCacheTTL {
+        ttl = c.BlockedCacheTTL
+    }
+    c.blocked.add(responseKey(r), cachedVerdict{blocked: true, reason: reason}, ttl, now)
+}
+
+// FNV-1a 64 位参数
+const (
+    fnvOffset64 = 14695981039346656037
+    fnvPrime64  = 1099511628211
+)
+
+// responseKey: qname（不区分大小写）、qtype 与 Answer 中 A/AAAA 记录 RDATA 的 FNV-1a
+//
+// 热点路径使用，手写 FNV 以避免分配。
+func responseKey(m *dns.Msg) uint64 {
+    h := uint64(fnvOffset64)
+    add := func(b byte) { h = (h ^ uint64(b)) * fnvPrime64 }
+
+    if len(m.Question) > 0 {
+        q := m.Question[0]
+        for i := 0; i < len(q.Name); i++ {
+            b := q.Name[i]
+            if 'A' <= b && b <= 'Z' {
+                b += 'a' - 'A'
+            }
+            add(b)
+        }
+        add(byte(q.Qtype >> 8))
+        add(byte(q.Qtype))
+    }
+    for _, rr := range m.Answer {
+        switch a := rr.(type) {
+        case *dns.A:
+            add(4)
+            for _, b := range a.A.To4() {
+                add(b)
+            }
+        case *dns.AAAA:
+            add(6)
+            for _, b := range a.AAAA.To16() {
+                add(b)
+            }
+        }
+    }
+    return h
+}
+
+// minAnswerTTL: Answer 中 A/AAAA 记录的最小 TTL；没有地址记录时返回 0
+func minAnswerTTL(m *dns.Msg) uint32 {
+    var ttl uint32
+    found := false
+    for _, rr := range m.Answer {
+        switch rr.(type) {
+        case *dns.A, *dns.AAAA:
+            if t := rr.Header().Ttl; !found || t < ttl {
+                ttl, found = t, true
+            }
+        }
+    }
+    return ttl
+}
@@ -0,0 +1,176 @@
+package carbolicacid
+
+import (
+    "context"
+    "fmt"
+    "net"
+    "testing"
+    "time"
+
+    "github.com/miekg/dns"
+)
+
+func TestVerdictCacheLRU(t *testing.T) {
+    vc := newVerdictCache(2)
+    now := time.Unix(1700000000, 0)
+
+    vc.add(1, cachedVerdict{blocked: true}, time.Minute, now)
+    vc.add(2, cachedVerdict{}, time.Minute, now)
+    vc.get(1, now) // 1 最近使用
+    vc.add(3, cachedVerdict{}, time.Minute, now)
+
+    if _, ok := vc.get(2, now); ok {
+        t.Fatalf("least recently used entry not evicted")
+    }
+    if v, ok := vc.get(1, now); !ok || !v.blocked {
+        t.Fatalf("recently used entry evicted")
+    }
+    if _, ok := vc.get(3, now.Add(2*time.Minute)); ok {
+        t.Fatalf("expired entry returned")
+    }
+    if vc.len() != 1 {
+        t.Fatalf("expected expired entry to be removed, %d left", vc.len())
+    }
+}
+
+func TestResponseKey(t *testing.T) {
+    a := makeA("Example.COM.", "10.1.2.3")
+    b := makeA("example.com.", "10.1.2.3")
+    if responseKey(a) != responseKey(b) {
+        t.Fatalf("key must ignore qname case")
+    }
+    b.Answer[0].Header().Ttl = 1 // TTL 不影响键
+    if responseKey(a) != responseKey(b) {
+        t.Fatalf("key must ignore TTL")
+    }
+    if responseKey(a) == responseKey(makeA("example.com.", "10.1.2.4")) {
+        t.Fatalf("different RDATA must produce a different key")
+    }
+    if n := testing.AllocsPerRun(100, func() { responseKey(a) }); n != 0 {
+        t.Fatalf("responseKey allocates %v times", n)
+    }
+}
+
+func TestVerdictCacheServeDNS(t *testing.T) {
+    cfg := &Config{
+        Blocks:       []*BlockNode{{Kind: RuleInclude, Value: "10.0.0.0/8"}},
+        Action:       ActionServfail,
+        VerdictCache: 16,
+    }
+    ca := &CarbolicAcid{Next: &testNext{resp: makeA("example.com.", "10.1.2.3")}, cfg: cfg}
+
+    for i := 0; i < 2; i++ {
+        rw := &testResponseWriter{}
+        ca.ServeDNS(context.Background(), rw, makeA("example.com.", "10.1.2.3"))
+        if rw.msg == nil || rw.msg.Rcode != dns.RcodeServerFailure {
+            t.Fatalf("round %d: expected SERVFAIL, got %v", i, rw.msg)
+        }
+    }
+    if n := cfg.verdicts.len(); n != 1 {
+        t.Fatalf("expected 1 cached verdict, got %d", n)
+    }
+}
+
+// largePolicyConfig: 大表配置（2 万条 IPv4 /24 + 2 千条 IPv6 /48）
+func largePolicyConfig(cacheSize int) *Config {
+    blocks := make([]*BlockNode, 0, 22000)
+    for i := 0; i < 20000; i++ {
+        blocks = append(blocks, &BlockNode{Kind: RuleInclude, Value: fmt.Sprintf("%d.%d.%d.0/24", 11+i/65536, (i/256)%256, i%256)})
+    }
+    for i := 0; i < 2000; i++ {
+        blocks = append(blocks, &BlockNode{Kind: RuleInclude, Value: fmt.Sprintf("2001:db8:%x::/48", i)})
+    }
+    return &Config{Blocks: blocks, Action: ActionDrop, VerdictCache: cacheSize}
+}
+
+// benchResponse: 不命中任何条目的响应，匹配需要扫描整张表
+func benchResponse() *dns.Msg {
+    m := makeA("www.example.com.", "93.184.216.34")
+    m.Answer = append(m.Answer, &dns.AAAA{
+        Hdr:  dns.RR_Header{Name: "www.example.com.", Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: 300},
+        AAAA: net.ParseIP("2606:2800:220:1::1"),
+    })
+    return m
+}
+
+// 基准：大表下直接匹配（IPSet.HasAny）
+func BenchmarkHasAnyLargeTable(b *testing.B) {
+    cfg := largePolicyConfig(0)
+    if err := cfg.initBlockList(); err != nil {
+        b.Fatal(err)
+    }
+    m := benchResponse()
+
+    b.ReportAllocs()
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        if cfg.blockList.HasAny(m) {
+            b.Fatal("unexpected match")
+        }
+    }
+}
+
+// 基准：大表下经过 verdict_cache 的判定（缓存命中）
+func BenchmarkVerdictCacheLargeTable(b *testing.B) {
+    cfg := largePolicyConfig(1024)
+    if err := cfg.initBlockList(); err != nil {
+        b.Fatal(err)
+    }
+    ca := &CarbolicAcid{cfg: cfg}
+    m := benchResponse()
+    ctx := context.Background()
+
+    b.ReportAllocs()
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        if blocked, _ := ca.decide(ctx, m); blocked {
+            b.Fatal("unexpected match")
+        }
+    }
+}
+
+func TestBlockedCacheServeDNS(t *testing.T) {
+    cfg := &Config{
+        Blocks:          []*BlockNode{{Kind: RuleInclude, Value: "10.0.0.0/8"}},
+        Action:          ActionServfail,
+        BlockedCache:    16,
+        BlockedCacheTTL: time.Minute,
+    }
+    next := &countingNext{testNext: testNext{resp: makeA("example.com.", "10.1.2.3")}}
+    ca := &CarbolicAcid{Next: next, cfg: cfg}
+
+    for i := 0; i < 3; i++ {
+        rw := &testResponseWriter{}
+        ca.ServeDNS(context.Background(), rw, makeA("Example.com.", "10.1.2.3"))
+        if rw.msg == nil || rw.msg.Rcode != dns.RcodeServerFailure {
+            t.Fatalf("round %d: expected SERVFAIL, got %v", i, rw.msg)
+        }
+    }
+    if next.calls != 1 {
+        t.Fatalf("expected repeats to be answered from the stored verdict, upstream called %d times", next.calls)
+    }
+
+    // 放行的应答不保存
+    next.resp = makeA("clean.example.", "93.184.216.34")
+    for i := 0; i < 2; i++ {
+        ca.ServeDNS(context.Background(), &testResponseWriter{}, makeA("clean.example.", "93.184.216.34"))
+    }
+    if next.calls != 3 {
+        t.Fatalf("expected clean answers to reach upstream each time, got %d calls", next.calls)
+    }
+
+    // 保存时间取地址记录的 TTL 与 BlockedCacheTTL 中较小者
+    now := time.Now()
+    short := makeA("short.example.", "10.1.2.3")
+    short.Answer[0].Header().Ttl = 5
+    cfg.rememberBlocked(short, short, "block 10.0.0.0/8", now)
+    if _, ok := cfg.blockedVerdict(short, now.Add(6*time.Second)); ok {
+        t.Fatalf("entry outlived the answer TTL")
+    }
+    long := makeA("long.example.", "10.1.2.3")
+    long.Answer[0].Header().Ttl = 86400
+    cfg.rememberBlocked(long, long, "block 10.0.0.0/8", now)
+    if _, ok := cfg.blockedVerdict(long, now.Add(2*time.Minute)); ok {
+        t.Fatalf("entry outlived cache_blocked ttl")
+    }
+}
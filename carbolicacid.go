@@ -2,8 +2,10 @@ package carbolicacid
 
 import (
     "context"
+    "time"
 
     "github.com/coredns/coredns/plugin"
+    "github.com/coredns/coredns/plugin/metrics"
     "github.com/coredns/coredns/plugin/pkg/log"
     "github.com/miekg/dns"
 )
@@ -11,6 +13,8 @@ import (
 type CarbolicAcid struct {
     Next plugin.Handler
     cfg  *Config
+
+    taps []tapper // v0.3.5: dnstap 插件，由 setup 在 OnStartup 中填充
 }
 
 type respRecorder struct {
@@ -26,21 +30,99 @@ func (r *respRecorder) WriteMsg(m *dns.Msg) error {
 
 func (c *CarbolicAcid) Name() string { return "carbolicacid" }
 
-func (c *CarbolicAcid) Ready() bool { return true }
+// Ready: 实现 ready.Readiness；初始化失败（插件处于 bypass 状态）时返回 false
+//
+// ready 插件在某个插件第一次返回 true 之后不再询问它；匹配表初始化后只读，
+// 因此这里只需反映初始化结果。
+func (c *CarbolicAcid) Ready() bool { return c.cfg.init() == nil }
 
-// ServeDNS: v0.3.4 严格模式 + 显式短路 + allowList 优先
-func (c *CarbolicAcid) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
-    // 初始化 blockList + allowList（只执行一次）
-    c.cfg.initOnce.Do(func() {
-        c.cfg.initErr = c.cfg.initBlockList()
+// Policy: 返回当前生效的 Policy，供其他插件复用匹配逻辑；初始化失败时返回 nil
+func (c *CarbolicAcid) Policy() *Policy {
+    if c.cfg.init() != nil {
+        return nil
+    }
+    return c.cfg.policy
+}
+
+// UnhealthyUpstreams: 因频繁返回被拦截的响应而标记为 unhealthy 的上游（未启用 upstreams 时为 nil）
+func (c *CarbolicAcid) UnhealthyUpstreams() []string {
+    return c.cfg.Upstreams.Unhealthy()
+}
+
+// init: 初始化 blockList + allowList（只执行一次）
+func (c *Config) init() error {
+    c.initOnce.Do(func() {
+        start := time.Now()
+        c.initErr = c.initBlockList()
+
+        if c.initErr == nil && c.LocalZones {
+            c.localZones, c.initErr = buildLocalZones()
+        }
+
+        if c.initErr == nil && c.Retry != nil {
+            c.initErr = c.Retry.init()
+        }
+        if c.initErr == nil && c.Verify != nil {
+            c.initErr = c.Verify.init()
+        }
+
+        // 影子策略失败不影响生效策略
+        if c.initErr == nil && c.Shadow != nil {
+            if err := c.Shadow.init(c); err != nil {
+                log.Errorf("[carbolicacid] shadow init failed: %v, shadow disabled", err)
+            }
+        }
+
+        if c.initErr == nil {
+            c.loadedAt = time.Now()
+            c.loadTime = c.loadedAt.Sub(start)
+        }
+        c.publishStatus()
     })
+    return c.initErr
+}
 
+// ServeDNS: v0.3.4 严格模式 + 显式短路 + allowList 优先
+func (c *CarbolicAcid) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
     // 初始化失败 → 整个插件 bypass
-    if c.cfg.initErr != nil {
-        log.Errorf("[carbolicacid] init failed: %v, fallback to BYPASS mode", c.cfg.initErr)
+    if err := c.cfg.init(); err != nil {
+        log.Errorf("[carbolicacid] init failed: %v, fallback to BYPASS mode", err)
         return plugin.NextOrFailure(c.Name(), c.Next, ctx, w, r)
     }
 
+    start := time.Now()
+    server := metrics.WithServer(ctx)
+
+    // RFC 6303 本地反向区 → 本地权威应答，不转发上游
+    if m := localZoneAnswer(c.cfg.localZones, r); m != nil {
+        localZoneCount.WithLabelValues(server).Inc()
+        c.cfg.TTL.clamp(m)
+        writeSynth(w, r, m)
+        return m.Rcode, nil
+    }
+
+    // 查询侧：PTR 反向查询的地址命中 blockList → 不转发上游
+    if blocked, rule := c.cfg.checkPTR(r); blocked {
+        queryBlockedCount.WithLabelValues(server, c.cfg.PTRAction.String(), rule.String()).Inc()
+        setMetadata(ctx, c.cfg.PTRAction, rule.String())
+        if c.cfg.PTRAction != ActionBypass {
+            return c.intercept(ctx, w, r, nil, dns.RcodeSuccess, c.cfg.PTRAction, rule.String(), start)
+        }
+        log.Warningf("[carbolicacid] bypass PTR %s matched %q", qname(r), rule.String())
+    }
+
+    // cache_blocked：同一 qname / qtype 最近被阻断过 → 直接执行动作，不转发上游
+    if v, ok := c.cfg.blockedVerdict(r, start); ok {
+        blockedCacheHits.WithLabelValues(server, c.cfg.Action.String(), v.reason).Inc()
+        setMetadata(ctx, c.cfg.Action, v.reason)
+        return c.intercept(ctx, w, r, nil, dns.RcodeSuccess, c.cfg.Action, v.reason, start)
+    }
+
+    // 上游归因：forward 通过 metadata 报告选中的上游
+    if c.cfg.Upstreams != nil {
+        ctx = withUpstreamMetadata(ctx)
+    }
+
     // 截获上游响应
     rw := &respRecorder{ResponseWriter: w}
     rc, err := plugin.NextOrFailure(c.Name(), c.Next, ctx, rw, r)
@@ -54,72 +136,173 @@ func (c *CarbolicAcid) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dn
     }
 
     // ---------------------------------------------------------
-    // 1) allowList 优先（仅当 allowList 存在时）
+    // 判定顺序见 Policy.decide：
+    //
+    //    1) allowList 命中 → 放行
+    //    2) preset allip → 全阻断模式，blockList 跳过
+    //    3) blockList 命中 → 阻断
+    //    4) 未命中任何表 → 正常返回上游响应
     // ---------------------------------------------------------
-    if c.cfg.allowList != nil {
-        if c.cfg.allowList.HasAny(resp) {
-            w.WriteMsg(resp)
-            return rc, nil
-        }
+    blocked, reason := c.check(ctx, resp)
+
+    if c.cfg.Upstreams != nil {
+        c.cfg.Upstreams.observe(server, upstreamOf(ctx), blocked, time.Now())
     }
 
-    // ---------------------------------------------------------
-    // 2) preset = allip → 进入“全阻断模式”
-    //
-    //    - allowList 存在且命中 → 已在上面放行
-    //    - allowList 不存在 或 未命中 → 必须阻断
-    //    - blockList 永远跳过
-    // ---------------------------------------------------------
-    if c.cfg.presetAllIP {
-        switch c.cfg.Action {
-        case ActionDrop:
-            return rc, nil
-        case ActionServfail:
-            m := new(dns.Msg)
-            m.SetRcode(r, dns.RcodeServerFailure)
-            w.WriteMsg(m)
-            return dns.RcodeServerFailure, nil
-        case ActionNxdomain:
-            m := new(dns.Msg)
-            m.SetRcode(r, dns.RcodeNameError)
-            w.WriteMsg(m)
-            return dns.RcodeNameError, nil
-        case ActionBypass:
-            w.WriteMsg(resp)
-            return rc, nil
+    enforced := ActionPass
+    if blocked {
+        enforced = c.cfg.Action
+        blockedCount.WithLabelValues(server, enforced.String(), reason).Inc()
+        setMetadata(ctx, enforced, reason)
+        c.quarantine(server, w, r, resp, enforced, reason)
+        c.cfg.rememberBlocked(r, resp, reason, time.Now())
+    }
+    c.cfg.Shadow.observe(server, r, resp, enforced)
+
+    if !blocked {
+        w.WriteMsg(resp)
+        return rc, nil
+    }
+
+    return c.intercept(ctx, w, r, resp, rc, c.cfg.Action, reason, start)
+}
+
+// check: 对上游响应做完整判定（双表 + 共识 + TTL），返回是否阻断及原因
+//
+// TTL clamp 模式下会就地修正 resp。
+func (c *CarbolicAcid) check(ctx context.Context, resp *dns.Msg) (bool, string) {
+    blocked, reason := c.decide(ctx, resp)
+
+    // 共识模式：可信上游给出相同地址 → 放行
+    if blocked && c.cfg.Verify != nil {
+        blocked = c.cfg.Verify.confirm(ctx, resp, reason)
+    }
+
+    // TTL 超出范围：reject → 按阻断处理；clamp → 修正后放行
+    if !blocked && c.cfg.TTL != nil {
+        if c.cfg.TTL.Reject && c.cfg.TTL.outside(resp) {
+            blocked, reason = true, "ttl"
+        } else {
+            c.cfg.TTL.clamp(resp)
         }
     }
+    return blocked, reason
+}
 
-    // ---------------------------------------------------------
-    // 3) preset ≠ allip → 正常双表模型
-    //
-    //    - allowList 已经在上面检查过
-    //    - blockList 命中 → 阻断
-    //    - 否则 → 放行
-    // ---------------------------------------------------------
-    if c.cfg.blockList != nil && c.cfg.blockList.HasAny(resp) {
-        switch c.cfg.Action {
-        case ActionDrop:
-            return rc, nil
-        case ActionServfail:
-            m := new(dns.Msg)
-            m.SetRcode(r, dns.RcodeServerFailure)
-            w.WriteMsg(m)
-            return dns.RcodeServerFailure, nil
-        case ActionNxdomain:
-            m := new(dns.Msg)
-            m.SetRcode(r, dns.RcodeNameError)
-            w.WriteMsg(m)
-            return dns.RcodeNameError, nil
-        case ActionBypass:
-            w.WriteMsg(resp)
-            return rc, nil
+// decide: Policy.decide，启用 verdict_cache 时先查缓存
+//
+// 缓存键为 qname、qtype 与地址记录的 RDATA，条目在地址记录的最小 TTL 后过期；
+// 没有地址记录的响应不缓存。
+func (c *CarbolicAcid) decide(ctx context.Context, resp *dns.Msg) (bool, string) {
+    vc := c.cfg.verdicts
+    if vc == nil {
+        blocked, rule := c.cfg.policy.decide(resp)
+        return blocked, rule.String()
+    }
+
+    now := time.Now()
+    key := responseKey(resp)
+    if v, ok := vc.get(key, now); ok {
+        verdictCacheCount.WithLabelValues(metrics.WithServer(ctx), "hit").Inc()
+        return v.blocked, v.reason
+    }
+    verdictCacheCount.WithLabelValues(metrics.WithServer(ctx), "miss").Inc()
+
+    blocked, rule := c.cfg.policy.decide(resp)
+    v := cachedVerdict{blocked: blocked, reason: rule.String()}
+    vc.add(key, v, time.Duration(minAnswerTTL(resp))*time.Second, now)
+    return v.blocked, v.reason
+}
+
+// intercept: 对命中的响应执行动作，并输出 dnstap
+//
+// upstream 为上游原始响应（查询侧拦截时为 nil），rc 为 bypass 时返回的 rcode。
+func (c *CarbolicAcid) intercept(ctx context.Context, w dns.ResponseWriter, r, upstream *dns.Msg, rc int, action ResponseAction, reason string, start time.Time) (int, error) {
+    var rec *replyRecorder
+    out := w
+    if len(c.taps) > 0 {
+        rec = &replyRecorder{ResponseWriter: w}
+        out = rec
+    }
+
+    var err error
+    switch action {
+    case ActionBypass:
+        log.Warningf("[carbolicacid] bypass %s matched %q", qname(r), reason)
+        out.WriteMsg(upstream)
+    case ActionRetry:
+        rc, err = c.retry(ctx, out, r)
+    default:
+        rc, err = c.block(ctx, out, r, action)
+    }
+
+    if rec != nil {
+        c.tapIntercepted(ctx, w, r, upstream, rec.msg, action, reason, start)
+    }
+    return rc, err
+}
+
+// quarantine: 把被拦截的上游响应交给隔离存储（未配置时不做任何事）
+func (c *CarbolicAcid) quarantine(server string, w dns.ResponseWriter, r, resp *dns.Msg, action ResponseAction, reason string) {
+    q := c.cfg.Quarantine
+    if q == nil {
+        return
+    }
+    query, err := r.Pack()
+    if err != nil {
+        return
+    }
+    wire, err := resp.Pack()
+    if err != nil {
+        return
+    }
+
+    e := &QuarantineEntry{
+        Time:     time.Now(),
+        Server:   server,
+        Action:   action.String(),
+        Rule:     reason,
+        Query:    query,
+        Response: wire,
+    }
+    if addr := w.RemoteAddr(); addr != nil {
+        e.Client = addr.String()
+    }
+
+    result := "stored"
+    if !q.record(e) {
+        result = "dropped"
+    }
+    quarantineCount.WithLabelValues(server, result).Inc()
+}
+
+// block: 执行阻断动作（drop/servfail/nxdomain）
+//
+// 应答已由插件写出，返回值必须满足 plugin.ClientWrite；SERVFAIL 不满足，
+// 服务器会再写一个自己的 SERVFAIL，因此 servfail 返回 dns.RcodeSuccess。
+func (c *CarbolicAcid) block(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, action ResponseAction) (int, error) {
+    switch action {
+    case ActionServfail:
+        m := synthReply(r, dns.RcodeServerFailure)
+        writeSynth(w, r, m)
+        return dns.RcodeSuccess, nil
+    case ActionNxdomain:
+        m := synthReply(r, dns.RcodeNameError)
+        if c.cfg.NegativeTTL > 0 {
+            m.Ns = []dns.RR{negativeSOA(negativeZone(c.cfg.zone, qname(r)), c.cfg.TTL.clampValue(c.cfg.NegativeTTL))}
         }
+        writeSynth(w, r, m)
+        return dns.RcodeNameError, nil
     }
 
-    // ---------------------------------------------------------
-    // 4) 未命中任何表 → 正常返回上游响应
-    // ---------------------------------------------------------
-    w.WriteMsg(resp)
-    return rc, nil
-}
\ No newline at end of file
+    // ActionDrop
+    return c.drop(ctx, w, r)
+}
+
+// qname: 日志用，空 Question 时返回 "."
+func qname(m *dns.Msg) string {
+    if m == nil || len(m.Question) == 0 {
+        return "."
+    }
+    return m.Question[0].Name
+}
@@ -3,6 +3,7 @@ package carbolicacid
 import (
     "context"
     "fmt"
+    "net"
     "testing"
 
     "github.com/miekg/dns"
@@ -36,6 +37,11 @@ func (w *testResponseWriter) WriteMsg(m *dns.Msg) error {
     return nil
 }
 
+// 合成应答需要根据客户端地址判断传输协议
+func (w *testResponseWriter) RemoteAddr() net.Addr {
+    return &net.UDPAddr{IP: net.ParseIP("10.240.0.1"), Port: 40212}
+}
+
 // -------------------------------
 // mock Next plugin
 // -------------------------------
@@ -192,8 +198,12 @@ func TestServfail(t *testing.T) {
         t.Fatalf("ServeDNS error: %v", err)
     }
 
-    if rc != dns.RcodeServerFailure {
-        t.Fatalf("expected SERVFAIL, got %d", rc)
+    // 应答已写出，返回值必须让服务器不再写默认的 SERVFAIL
+    if rc != dns.RcodeSuccess {
+        t.Fatalf("expected RcodeSuccess after writing the reply, got %d", rc)
+    }
+    if rw.msg == nil || rw.msg.Rcode != dns.RcodeServerFailure {
+        t.Fatalf("expected SERVFAIL written to the client, got %v", rw.msg)
     }
 }
 
@@ -638,3 +648,22 @@ func TestBlock_NoExclude_NormalPath(t *testing.T) {
         t.Fatalf("expected NXDOMAIN, got %d", rc)
     }
 }
+
+// ::ffff:0:0/96 不能被当作 IPv4 前缀，否则 preset iana 会命中所有 IPv4
+func TestPresetIANA_PublicIPv4NotBlocked(t *testing.T) {
+    cfg := &Config{
+        Blocks: []*BlockNode{
+            {Kind: RulePreset, Value: "iana"},
+        },
+        Action: ActionDrop,
+    }
+
+    if err := cfg.initBlockList(); err != nil {
+        t.Fatalf("initBlockList failed: %v", err)
+    }
+
+    resp := makeA("example.com.", "8.8.8.8")
+    if cfg.blockList.HasAny(resp) {
+        t.Fatalf("8.8.8.8 should not match preset iana")
+    }
+}
@@ -0,0 +1,171 @@
+package carbolicacid
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "net/netip"
+    "strings"
+
+    "github.com/coredns/caddy"
+    "github.com/coredns/caddy/caddyfile"
+    "github.com/coredns/coredns/plugin"
+)
+
+// Checked: Corefile 中一个 server block 的 carbolicacid 配置，离线检查的结果
+type Checked struct {
+    File  string
+    Line  int      // 第一条 carbolicacid 指令所在行
+    Zones []string // server block 的 zone（已规范化），例如 "." / "server.example.com."
+
+    Action ResponseAction
+    Policy *Policy // 生效策略；Err 非空时为 nil
+
+    Err      error    // 解析或初始化错误，消息带 Corefile 文件名与行号
+    Warnings []string // 见 README 第 1 节的危险配置
+}
+
+// CheckCorefile: 用插件自身的 parseConfig / 初始化流程解析 Corefile 中的所有 carbolicacid 块
+//
+// 输入可以是完整的 Corefile，也可以只是一个 carbolicacid { ... } 片段（视为根区）。
+// 返回的 error 只表示 Corefile 本身无法切分（如括号不匹配）；各块的错误记录在 Checked.Err。
+// 不启动任何监听、不发送任何查询。
+func CheckCorefile(filename string, r io.Reader) ([]*Checked, error) {
+    input, err := io.ReadAll(r)
+    if err != nil {
+        return nil, err
+    }
+
+    d := caddyfile.NewDispenser(filename, bytes.NewReader(input))
+    if d.Next() && d.Val() == "carbolicacid" {
+        ch := checkBlock(filename, []string{"."}, allTokens(filename, input))
+        ch.Warnings = append(ch.Warnings, checkWarnings(ch, nil)...)
+        return []*Checked{ch}, nil
+    }
+
+    blocks, err := caddyfile.Parse(filename, bytes.NewReader(input), nil)
+    if err != nil {
+        return nil, err
+    }
+
+    var list []*Checked
+    for _, sb := range blocks {
+        tokens := sb.Tokens["carbolicacid"]
+        if len(tokens) == 0 {
+            continue
+        }
+        var zones []string
+        for _, k := range sb.Keys {
+            zones = append(zones, plugin.Host(k).NormalizeExact()...)
+        }
+        list = append(list, checkBlock(filename, zones, tokens))
+    }
+    for _, ch := range list {
+        ch.Warnings = append(ch.Warnings, checkWarnings(ch, blocks)...)
+    }
+    return list, nil
+}
+
+// allTokens: 片段输入的全部 token
+func allTokens(filename string, input []byte) []caddyfile.Token {
+    d := caddyfile.NewDispenser(filename, bytes.NewReader(input))
+    var tokens []caddyfile.Token
+    for d.Next() {
+        tokens = append(tokens, caddyfile.Token{File: d.File(), Line: d.Line(), Text: d.Val()})
+    }
+    return tokens
+}
+
+// checkBlock: 对一个 server block 的 carbolicacid token 执行 parseConfig 与 init
+func checkBlock(filename string, zones []string, tokens []caddyfile.Token) *Checked {
+    ch := &Checked{File: tokens[0].File, Line: tokens[0].Line, Zones: zones}
+    if ch.File == "" {
+        ch.File = filename
+    }
+
+    c := &caddy.Controller{Dispenser: caddyfile.NewDispenserTokens(filename, tokens)}
+    cfg, err := parseConfig(c)
+    if err != nil {
+        ch.Err = err
+        return ch
+    }
+    if len(zones) > 0 {
+        cfg.zone = zones[0]
+    }
+    if err := cfg.init(); err != nil {
+        ch.Err = fmt.Errorf("%s:%d - Error during initialization: %w", ch.File, ch.Line, err)
+        return ch
+    }
+    ch.Action = cfg.Action
+    ch.Policy = cfg.policy
+    return ch
+}
+
+var loopbackAddrs = []netip.Addr{netip.MustParseAddr("127.0.0.1"), netip.MustParseAddr("::1")}
+
+// checkWarnings: README 第 1、3 节描述的危险配置；blocks 为整个 Corefile 的 server block
+func checkWarnings(ch *Checked, blocks []caddyfile.ServerBlock) []string {
+    p := ch.Policy
+    if p == nil {
+        return nil
+    }
+
+    var warn []string
+    enforcing := ch.Action != ActionBypass
+
+    // preset allip 不带 exclude：所有 A/AAAA 响应都被阻断
+    for _, b := range p.Blocks {
+        if b.Kind == RulePreset && b.Value == "allip" && len(b.Excl) == 0 && enforcing {
+            warn = append(warn, fmt.Sprintf("preset allip without exclude applies %q to every A/AAAA response", ch.Action))
+        }
+    }
+    if p.allIP && ch.Action == ActionDrop {
+        warn = append(warn, "responses drop with preset allip: clients get no reply for any blocked name and keep retrying until they time out")
+    }
+
+    // 根区阻断 127.0.0.1 / ::1，但没有为服务器自身 FQDN 单独配置 zone
+    if !enforcing || !containsZone(ch.Zones, ".") {
+        return warn
+    }
+    var blocked []string
+    for _, a := range loopbackAddrs {
+        if ok, _ := p.MatchAddr(a); ok {
+            blocked = append(blocked, a.String())
+        }
+    }
+    if len(blocked) == 0 {
+        return warn
+    }
+
+    var fqdn, empty []string
+    for _, sb := range blocks {
+        for _, k := range sb.Keys {
+            for _, z := range plugin.Host(k).NormalizeExact() {
+                if z == "." || strings.HasSuffix(z, ".arpa.") {
+                    continue
+                }
+                if len(sb.Tokens) == 0 {
+                    empty = append(empty, z)
+                } else {
+                    fqdn = append(fqdn, z)
+                }
+            }
+        }
+    }
+    for _, z := range empty {
+        warn = append(warn, fmt.Sprintf("zone %q is empty, so CoreDNS answers it from the root zone, which blocks %s", z, strings.Join(blocked, " and ")))
+    }
+    if len(fqdn) == 0 {
+        warn = append(warn, fmt.Sprintf("the root zone blocks %s but no zone is configured for the server's own FQDN; hostname lookups during boot may be blocked", strings.Join(blocked, " and ")))
+    }
+    return warn
+}
+
+func containsZone(zones []string, z string) bool {
+    for _, x := range zones {
+        if x == z {
+            return true
+        }
+    }
+    return false
+}
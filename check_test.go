@@ -0,0 +1,132 @@
+package carbolicacid
+
+import (
+    "errors"
+    "strings"
+    "testing"
+)
+
+func checkString(t *testing.T, corefile string) []*Checked {
+    t.Helper()
+    list, err := CheckCorefile("Corefile", strings.NewReader(corefile))
+    if err != nil {
+        t.Fatalf("CheckCorefile: %v", err)
+    }
+    return list
+}
+
+func hasWarning(ch *Checked, substr string) bool {
+    for _, w := range ch.Warnings {
+        if strings.Contains(w, substr) {
+            return true
+        }
+    }
+    return false
+}
+
+func TestCheckCorefileRecommended(t *testing.T) {
+    // README 1.5 的推荐配置：不应有任何警告
+    list := checkString(t, `"server.example.com" {
+    carbolicacid {
+        preset allip {
+            exclude 127.0.0.1
+            exclude ::1
+        }
+        responses bypass
+    }
+}
+
+. {
+    forward . 1.1.1.1
+    carbolicacid {
+        preset iana
+        responses nxdomain
+    }
+}
+`)
+    if len(list) != 2 {
+        t.Fatalf("expected 2 blocks, got %d", len(list))
+    }
+    for _, ch := range list {
+        if ch.Err != nil || len(ch.Warnings) != 0 {
+            t.Errorf("%s:%d %v: err=%v warnings=%v", ch.File, ch.Line, ch.Zones, ch.Err, ch.Warnings)
+        }
+    }
+    if list[0].Zones[0] != "server.example.com." || list[1].Line != 13 {
+        t.Fatalf("unexpected position: %+v / %+v", list[0], list[1])
+    }
+
+    block, allow := list[1].Policy.Entries()
+    if len(block) != len(ianaPresetV4)+len(ianaPresetV6) || len(allow) != 0 {
+        t.Fatalf("unexpected tables: %d / %d", len(block), len(allow))
+    }
+    if block[0].CIDR != "0.0.0.0/8" || block[len(block)-1].CIDR != "ff00::/8" {
+        t.Fatalf("tables not sorted: first %s, last %s", block[0].CIDR, block[len(block)-1].CIDR)
+    }
+}
+
+func TestCheckCorefileWarnings(t *testing.T) {
+    list := checkString(t, `"server.example.com" {
+}
+
+. {
+    carbolicacid {
+        preset allip
+        responses drop
+    }
+}
+`)
+    if len(list) != 1 || list[0].Err != nil {
+        t.Fatalf("unexpected result: %+v", list)
+    }
+    ch := list[0]
+    for _, w := range []string{"preset allip without exclude", "responses drop with preset allip", `zone "server.example.com." is empty`} {
+        if !hasWarning(ch, w) {
+            t.Errorf("missing warning %q in %v", w, ch.Warnings)
+        }
+    }
+
+    // 片段输入视为根区，没有服务器自身 FQDN 的 zone
+    list = checkString(t, "carbolicacid {\n    preset iana\n}\n")
+    if len(list) != 1 || !hasWarning(list[0], "no zone is configured for the server's own FQDN") {
+        t.Fatalf("expected FQDN warning, got %+v", list)
+    }
+
+    // bypass 只记录，不警告
+    list = checkString(t, "carbolicacid {\n    preset allip\n    responses bypass\n}\n")
+    if len(list[0].Warnings) != 0 {
+        t.Fatalf("unexpected warnings: %v", list[0].Warnings)
+    }
+}
+
+func TestCheckCorefileErrors(t *testing.T) {
+    list := checkString(t, `. {
+    carbolicacid {
+        preset iana
+    }
+}
+
+example.org {
+    carbolicacid {
+        block 10.0.0.0/8 {
+            exclude 10.1.0.0/16
+        }
+        block 10.1.2.3/8
+    }
+}
+`)
+    if len(list) != 2 || list[0].Err != nil {
+        t.Fatalf("unexpected result: %+v", list)
+    }
+    err := list[1].Err
+    if !errors.Is(err, ErrNonCanonical) || !strings.HasPrefix(err.Error(), "Corefile:12 ") {
+        t.Fatalf("expected positioned ErrNonCanonical, got %v", err)
+    }
+    if list[1].Policy != nil {
+        t.Fatal("expected no policy for a failed block")
+    }
+
+    if _, err := CheckCorefile("Corefile", strings.NewReader(". {\n    carbolicacid {\n")); err == nil {
+        t.Fatal("expected error for unbalanced braces")
+    }
+}
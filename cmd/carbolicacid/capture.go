@@ -0,0 +1,283 @@
+package main
+
+import (
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "time"
+
+    tap "github.com/dnstap/golang-dnstap"
+    "google.golang.org/protobuf/proto"
+)
+
+// capturedMsg: 抓包或 dnstap 文件中的一个 DNS 报文（未解码）
+type capturedMsg struct {
+    Time time.Time
+    Wire []byte
+}
+
+// captureStats: 读取过程中跳过的报文
+type captureStats struct {
+    Fragments int // IP 分片，不做重组
+    Partial   int // 跨多个 TCP 段的报文，不做重组
+    Other     int // 非 IP、非 UDP/TCP、端口不符或链路层不支持
+}
+
+// pcap 链路层类型，见 https://www.tcpdump.org/linktypes.html
+const (
+    linkNull     = 0
+    linkEthernet = 1
+    linkRaw      = 101
+    linkLoop     = 108
+    linkSLL      = 113
+    linkIPv4     = 228
+    linkIPv6     = 229
+    linkSLL2     = 276
+)
+
+// pcapMaxRecord: 单条记录的长度上限；头部的 snaplen 为 0 或更大时使用（与 tcpdump 的最大 snaplen 一致）
+const pcapMaxRecord = 262144
+
+// readPcap: 读取经典 pcap 文件（非 pcapng），对源端口为 port 的 UDP 载荷与 TCP 段中的完整报文调用 fn
+func readPcap(r io.Reader, port uint16, stats *captureStats, fn func(capturedMsg)) error {
+    var hdr [24]byte
+    if _, err := io.ReadFull(r, hdr[:]); err != nil {
+        return fmt.Errorf("pcap header: %v", err)
+    }
+
+    var order binary.ByteOrder
+    nano := false
+    switch m := binary.LittleEndian.Uint32(hdr[:4]); m {
+    case 0xa1b2c3d4, 0xa1b23c4d:
+        order, nano = binary.LittleEndian, m == 0xa1b23c4d
+    case 0xd4c3b2a1, 0x4d3cb2a1:
+        order, nano = binary.BigEndian, m == 0x4d3cb2a1
+    case 0x0a0d0d0a:
+        return errors.New("pcapng is not supported, convert with: editcap -F pcap in.pcapng out.pcap")
+    default:
+        return fmt.Errorf("not a pcap file (magic %#x)", m)
+    }
+    link := order.Uint32(hdr[20:24]) & 0x0fffffff
+    limit := order.Uint32(hdr[16:20])
+    if limit == 0 || limit > pcapMaxRecord {
+        limit = pcapMaxRecord
+    }
+
+    var rec [16]byte
+    for n := 1; ; n++ {
+        if _, err := io.ReadFull(r, rec[:]); err != nil {
+            if err == io.EOF || err == io.ErrUnexpectedEOF {
+                return nil // 末尾不完整的记录（抓包被中断）忽略
+            }
+            return err
+        }
+        sec, frac := order.Uint32(rec[0:4]), order.Uint32(rec[4:8])
+        // incl_len 来自文件本身，先检查再分配，损坏或恶意的文件不能要求任意大的内存
+        size := order.Uint32(rec[8:12])
+        if size > limit {
+            return fmt.Errorf("pcap record %d: captured length %d exceeds snaplen %d", n, size, limit)
+        }
+        data := make([]byte, size)
+        if _, err := io.ReadFull(r, data); err != nil {
+            return nil
+        }
+
+        ts := time.Unix(int64(sec), int64(frac)*1000)
+        if nano {
+            ts = time.Unix(int64(sec), int64(frac))
+        }
+        for _, wire := range packetPayloads(link, data, port, stats) {
+            fn(capturedMsg{Time: ts.UTC(), Wire: wire})
+        }
+    }
+}
+
+// packetPayloads: 一个链路层帧中的 DNS 报文
+func packetPayloads(link uint32, b []byte, port uint16, stats *captureStats) [][]byte {
+    var ethertype uint16
+    switch link {
+    case linkEthernet:
+        if len(b) < 14 {
+            stats.Other++
+            return nil
+        }
+        ethertype, b = binary.BigEndian.Uint16(b[12:14]), b[14:]
+        for (ethertype == 0x8100 || ethertype == 0x88a8) && len(b) >= 4 { // VLAN 标签
+            ethertype, b = binary.BigEndian.Uint16(b[2:4]), b[4:]
+        }
+    case linkSLL:
+        if len(b) < 16 {
+            stats.Other++
+            return nil
+        }
+        ethertype, b = binary.BigEndian.Uint16(b[14:16]), b[16:]
+    case linkSLL2:
+        if len(b) < 20 {
+            stats.Other++
+            return nil
+        }
+        ethertype, b = binary.BigEndian.Uint16(b[0:2]), b[20:]
+    case linkNull, linkLoop:
+        if len(b) < 4 {
+            stats.Other++
+            return nil
+        }
+        // AF_INET 为 2；AF_INET6 因平台而异（24 / 28 / 30），按 IP 版本号判断即可
+        b = b[4:]
+    case linkRaw, linkIPv4, linkIPv6:
+    default:
+        stats.Other++
+        return nil
+    }
+
+    if ethertype != 0 && ethertype != 0x0800 && ethertype != 0x86dd {
+        stats.Other++
+        return nil
+    }
+    if len(b) == 0 {
+        stats.Other++
+        return nil
+    }
+
+    var proto byte
+    var payload []byte
+    switch b[0] >> 4 {
+    case 4:
+        proto, payload = ipv4Payload(b, stats)
+    case 6:
+        proto, payload = ipv6Payload(b, stats)
+    }
+
+    switch {
+    case payload == nil:
+        return nil
+    case proto == 17:
+        return udpPayload(payload, port, stats)
+    case proto == 6:
+        return tcpPayload(payload, port, stats)
+    }
+    stats.Other++
+    return nil
+}
+
+func ipv4Payload(b []byte, stats *captureStats) (byte, []byte) {
+    if len(b) < 20 {
+        stats.Other++
+        return 0, nil
+    }
+    ihl := int(b[0]&0x0f) * 4
+    total := int(binary.BigEndian.Uint16(b[2:4]))
+    if ihl < 20 || total < ihl || len(b) < total {
+        stats.Other++
+        return 0, nil
+    }
+    if flags := binary.BigEndian.Uint16(b[6:8]); flags&0x2000 != 0 || flags&0x1fff != 0 {
+        stats.Fragments++
+        return 0, nil
+    }
+    return b[9], b[ihl:total] // 去掉以太网填充
+}
+
+func ipv6Payload(b []byte, stats *captureStats) (byte, []byte) {
+    if len(b) < 40 {
+        stats.Other++
+        return 0, nil
+    }
+    n := 40 + int(binary.BigEndian.Uint16(b[4:6]))
+    if len(b) < n {
+        stats.Other++
+        return 0, nil
+    }
+    next, b := b[6], b[40:n]
+
+    // 扩展头：hop-by-hop / routing / destination options；分片不做重组
+    for {
+        switch next {
+        case 0, 43, 60:
+            if len(b) < 8 || len(b) < (int(b[1])+1)*8 {
+                stats.Other++
+                return 0, nil
+            }
+            next, b = b[0], b[(int(b[1])+1)*8:]
+        case 44:
+            stats.Fragments++
+            return 0, nil
+        default:
+            return next, b
+        }
+    }
+}
+
+func udpPayload(b []byte, port uint16, stats *captureStats) [][]byte {
+    if len(b) < 8 || binary.BigEndian.Uint16(b[0:2]) != port {
+        stats.Other++
+        return nil
+    }
+    return [][]byte{b[8:]}
+}
+
+// tcpPayload: 段内完整的报文（2 字节长度前缀），跨段的报文计入 Partial
+func tcpPayload(b []byte, port uint16, stats *captureStats) [][]byte {
+    if len(b) < 20 || binary.BigEndian.Uint16(b[0:2]) != port {
+        stats.Other++
+        return nil
+    }
+    off := int(b[12]>>4) * 4
+    if off < 20 || len(b) < off {
+        stats.Other++
+        return nil
+    }
+    b = b[off:]
+
+    var msgs [][]byte
+    for len(b) > 0 {
+        if len(b) < 2 {
+            stats.Partial++
+            break
+        }
+        n := int(binary.BigEndian.Uint16(b))
+        if len(b) < 2+n {
+            stats.Partial++
+            break
+        }
+        msgs = append(msgs, b[2:2+n])
+        b = b[2+n:]
+    }
+    return msgs
+}
+
+// readDnstap: 读取 dnstap 文件（Frame Streams），对 types 中各类型消息的 response_message 调用 fn
+func readDnstap(r io.Reader, types map[tap.Message_Type]bool, stats *captureStats, fn func(capturedMsg)) error {
+    fr, err := tap.NewReader(r, nil)
+    if err != nil {
+        return fmt.Errorf("dnstap: %v", err)
+    }
+
+    buf := make([]byte, 1<<20)
+    for {
+        n, err := fr.ReadFrame(buf)
+        if err != nil {
+            if err == io.EOF {
+                return nil
+            }
+            return fmt.Errorf("dnstap: %v", err)
+        }
+
+        var d tap.Dnstap
+        if err := proto.Unmarshal(buf[:n], &d); err != nil {
+            return fmt.Errorf("dnstap: %v", err)
+        }
+        m := d.GetMessage()
+        if m == nil || !types[m.GetType()] || len(m.GetResponseMessage()) == 0 {
+            stats.Other++
+            continue
+        }
+        wire := make([]byte, len(m.GetResponseMessage()))
+        copy(wire, m.GetResponseMessage())
+        fn(capturedMsg{
+            Time: time.Unix(int64(m.GetResponseTimeSec()), int64(m.GetResponseTimeNsec())).UTC(),
+            Wire: wire,
+        })
+    }
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+
+    carbolicacid "github.com/arizuka/coredns-carbolicacid"
+)
+
+// errCheckFailed: 已输出具体错误，只需以非零状态退出
+var errCheckFailed = errors.New("check failed")
+
+// runCheck: 离线解析 Corefile，报告错误与危险配置，并输出生效的 blockList / allowList
+//
+// 任一 carbolicacid 块解析或初始化失败时返回错误；-strict 时警告也视为失败。
+func runCheck(args []string, out io.Writer) error {
+    fs := flag.NewFlagSet("check", flag.ContinueOnError)
+    strict := fs.Bool("strict", false, "treat warnings as errors")
+    quiet := fs.Bool("q", false, "do not print the effective tables")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+    if fs.NArg() != 1 {
+        return fmt.Errorf("expected exactly one Corefile (- for stdin)")
+    }
+
+    name := fs.Arg(0)
+    var in io.Reader = os.Stdin
+    if name != "-" {
+        f, err := os.Open(name)
+        if err != nil {
+            return err
+        }
+        defer f.Close()
+        in = f
+    } else {
+        name = "stdin"
+    }
+
+    list, err := carbolicacid.CheckCorefile(name, in)
+    if err != nil {
+        return err
+    }
+    if len(list) == 0 {
+        return fmt.Errorf("%s: no carbolicacid block found", name)
+    }
+
+    failed, warned := false, false
+    for _, ch := range list {
+        fmt.Fprintf(out, "%s:%d: carbolicacid in zone %s\n", ch.File, ch.Line, strings.Join(ch.Zones, " "))
+        if ch.Err != nil {
+            fmt.Fprintf(out, "  error: %v\n", ch.Err)
+            failed = true
+            continue
+        }
+        for _, w := range ch.Warnings {
+            fmt.Fprintf(out, "  warning: %s\n", w)
+            warned = true
+        }
+        if !*quiet {
+            printTables(out, ch)
+        }
+    }
+
+    if failed || (*strict && warned) {
+        return errCheckFailed
+    }
+    return nil
+}
+
+func printTables(out io.Writer, ch *carbolicacid.Checked) {
+    block, allow := ch.Policy.Entries()
+    fmt.Fprintf(out, "  responses %s\n", ch.Action)
+    space := ch.Policy.BlockedSpace()
+    fmt.Fprintf(out, "  blocked address space: %s IPv4 / %s IPv6 addresses\n",
+        formatCount(carbolicacid.AddressCount(space.V4).String()), formatCount(carbolicacid.AddressCount(space.V6).String()))
+    for _, t := range []struct {
+        name  string
+        rules []*carbolicacid.Rule
+    }{{"blockList", block}, {"allowList", allow}} {
+        fmt.Fprintf(out, "  %s (%d):\n", t.name, len(t.rules))
+        for _, r := range t.rules {
+            fmt.Fprintf(out, "    %-20s %s\n", r.CIDR, r)
+        }
+    }
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+    "bytes"
+    "flag"
+    "fmt"
+    "io"
+    "net/netip"
+    "os"
+    "sort"
+    "strings"
+
+    carbolicacid "github.com/arizuka/coredns-carbolicacid"
+)
+
+// runDiff: 比较两个 Corefile 中各 zone 的策略，输出阻断 / exclude 地址空间的增减与规则动作的变化
+//
+// 按 zone 对应两边的 carbolicacid 块；只出现在一边的 zone 视为另一边不阻断任何地址。
+func runDiff(args []string, out io.Writer) error {
+    fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+    exitCode := fs.Bool("exit-code", false, "exit with status 1 if the policies differ")
+    list := fs.Int("list", 20, "prefixes to list per address family (0 = none, -1 = all)")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+    if fs.NArg() != 2 {
+        return fmt.Errorf("usage: diff [-exit-code] OLD NEW")
+    }
+
+    oldZones, err := loadPolicies(fs.Arg(0))
+    if err != nil {
+        return err
+    }
+    newZones, err := loadPolicies(fs.Arg(1))
+    if err != nil {
+        return err
+    }
+
+    var zones []string
+    for z := range oldZones {
+        zones = append(zones, z)
+    }
+    for z := range newZones {
+        if _, ok := oldZones[z]; !ok {
+            zones = append(zones, z)
+        }
+    }
+    sort.Strings(zones)
+
+    differ := false
+    for _, z := range zones {
+        d := carbolicacid.DiffPolicies(oldZones[z], newZones[z])
+        if d.Empty() {
+            continue
+        }
+        differ = true
+        fmt.Fprintf(out, "zone %s\n", z)
+        printDiff(out, d, *list)
+    }
+
+    if !differ {
+        fmt.Fprintln(out, "no policy changes")
+        return nil
+    }
+    if *exitCode {
+        return errCheckFailed // 与 git diff --exit-code 相同：有差异时以 1 退出
+    }
+    return nil
+}
+
+// loadPolicies: zone → 生效策略；任一 carbolicacid 块有错误时返回错误
+func loadPolicies(name string) (map[string]*carbolicacid.Policy, error) {
+    input, err := os.ReadFile(name)
+    if err != nil {
+        return nil, err
+    }
+    list, err := carbolicacid.CheckCorefile(name, bytes.NewReader(input))
+    if err != nil {
+        return nil, err
+    }
+
+    zones := make(map[string]*carbolicacid.Policy)
+    for _, ch := range list {
+        if ch.Err != nil {
+            return nil, ch.Err
+        }
+        for _, z := range ch.Zones {
+            if _, ok := zones[z]; !ok {
+                zones[z] = ch.Policy
+            }
+        }
+    }
+    return zones, nil
+}
+
+func printDiff(out io.Writer, d *carbolicacid.PolicyDiff, limit int) {
+    for _, s := range []struct {
+        title string
+        sign  string
+        space carbolicacid.AddressSpace
+    }{
+        {"newly blocked", "+", d.Blocked},
+        {"no longer blocked", "-", d.Unblocked},
+        {"newly excluded", "+", d.Allowed},
+        {"no longer excluded", "-", d.Unallowed},
+    } {
+        if s.space.Empty() {
+            continue
+        }
+        fmt.Fprintf(out, "  %s:\n", s.title)
+        for _, f := range []struct {
+            name string
+            list []netip.Prefix
+        }{{"IPv4", s.space.V4}, {"IPv6", s.space.V6}} {
+            if len(f.list) == 0 {
+                continue
+            }
+            fmt.Fprintf(out, "    %s: %s addresses in %d prefix(es)\n", f.name, formatCount(carbolicacid.AddressCount(f.list).String()), len(f.list))
+            for i, p := range f.list {
+                if limit >= 0 && i >= limit {
+                    fmt.Fprintf(out, "      ... and %d more\n", len(f.list)-limit)
+                    break
+                }
+                fmt.Fprintf(out, "      %s %-43s %s\n", s.sign, p, formatCount(carbolicacid.AddressCount([]netip.Prefix{p}).String()))
+            }
+        }
+    }
+
+    if len(d.Rules) == 0 {
+        return
+    }
+    fmt.Fprintf(out, "  rules:\n")
+    for _, c := range d.Rules {
+        var notes []string
+        for _, e := range c.ExcludesAdded {
+            notes = append(notes, "+exclude "+e)
+        }
+        for _, e := range c.ExcludesRemoved {
+            notes = append(notes, "-exclude "+e)
+        }
+        line := fmt.Sprintf("    %-30s %-10s -> %-10s %s", c.Rule, actionOrNone(c.Old), actionOrNone(c.New), strings.Join(notes, " "))
+        fmt.Fprintln(out, strings.TrimRight(line, " "))
+    }
+}
+
+func actionOrNone(a string) string {
+    if a == "" {
+        return "(none)"
+    }
+    return a
+}
+
+// formatCount: 十进制数字按千位分组，IPv6 的地址数动辄几十位
+func formatCount(s string) string {
+    if len(s) <= 3 {
+        return s
+    }
+    var b strings.Builder
+    for i, c := range s {
+        if i > 0 && (len(s)-i)%3 == 0 {
+            b.WriteByte(',')
+        }
+        b.WriteRune(c)
+    }
+    return b.String()
+}
@@ -0,0 +1,55 @@
+// Command carbolicacid: CarbolicAcid 插件的离线工具
+//
+//    carbolicacid quarantine [flags] DIR    读取 quarantine 目录中的隔离记录
+//    carbolicacid check [flags] COREFILE    离线检查 Corefile 中的 carbolicacid 配置
+//    carbolicacid replay -config COREFILE (-pcap FILE | -dnstap FILE)
+//                                           用抓包或 dnstap 文件评估策略的命中情况
+//    carbolicacid diff [flags] OLD NEW      比较两个 Corefile 生效的阻断地址空间与规则动作
+package main
+
+import (
+    "fmt"
+    "os"
+)
+
+const usage = `usage: carbolicacid <command> [flags] [args]
+
+commands:
+  quarantine   dump entries from a quarantine directory
+  check        validate the carbolicacid blocks of a Corefile and print the effective tables
+  replay       evaluate a Corefile's policy against responses from a pcap or dnstap file
+  diff         compare the effective blocked address space and rule actions of two Corefiles
+`
+
+func main() {
+    if len(os.Args) < 2 {
+        fmt.Fprint(os.Stderr, usage)
+        os.Exit(2)
+    }
+
+    var err error
+    switch os.Args[1] {
+    case "quarantine":
+        err = runQuarantine(os.Args[2:], os.Stdout)
+    case "check":
+        err = runCheck(os.Args[2:], os.Stdout)
+    case "replay":
+        err = runReplay(os.Args[2:], os.Stdout)
+    case "diff":
+        err = runDiff(os.Args[2:], os.Stdout)
+    case "-h", "-help", "--help", "help":
+        fmt.Fprint(os.Stdout, usage)
+        return
+    default:
+        fmt.Fprintf(os.Stderr, "carbolicacid: unknown command %q\n\n%s", os.Args[1], usage)
+        os.Exit(2)
+    }
+
+    if err == errCheckFailed {
+        os.Exit(1)
+    }
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "carbolicacid %s: %v\n", os.Args[1], err)
+        os.Exit(1)
+    }
+}
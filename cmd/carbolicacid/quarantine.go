@@ -0,0 +1,73 @@
+package main
+
+import (
+    "encoding/hex"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "time"
+
+    carbolicacid "github.com/arizuka/coredns-carbolicacid"
+    "github.com/miekg/dns"
+)
+
+// errLimit: 达到 -n 限制后停止读取
+var errLimit = errors.New("limit reached")
+
+// runQuarantine: 按时间顺序输出隔离记录
+//
+// 默认以 dig 风格输出上游响应；-wire 额外输出原始报文的十六进制，便于逐字节重放。
+func runQuarantine(args []string, out io.Writer) error {
+    fs := flag.NewFlagSet("quarantine", flag.ContinueOnError)
+    since := fs.Duration("since", 0, "only show entries newer than this duration (e.g. 1h)")
+    rule := fs.String("rule", "", "only show entries matched by this rule")
+    limit := fs.Int("n", 0, "stop after this many entries (0 = all)")
+    wire := fs.Bool("wire", false, "also print the raw query and response in hex")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+    if fs.NArg() != 1 {
+        return fmt.Errorf("expected exactly one quarantine directory")
+    }
+
+    var after time.Time
+    if *since > 0 {
+        after = time.Now().Add(-*since)
+    }
+
+    n := 0
+    err := carbolicacid.ReadQuarantine(fs.Arg(0), func(e *carbolicacid.QuarantineEntry) error {
+        if e.Time.Before(after) || (*rule != "" && e.Rule != *rule) {
+            return nil
+        }
+        printQuarantineEntry(out, e, *wire)
+        n++
+        if *limit > 0 && n >= *limit {
+            return errLimit
+        }
+        return nil
+    })
+    if err != nil && err != errLimit {
+        return err
+    }
+    return nil
+}
+
+func printQuarantineEntry(out io.Writer, e *carbolicacid.QuarantineEntry, wire bool) {
+    fmt.Fprintf(out, ";; %s client=%s server=%s action=%s rule=%q\n",
+        e.Time.Format(time.RFC3339Nano), e.Client, e.Server, e.Action, e.Rule)
+
+    m := new(dns.Msg)
+    if err := m.Unpack(e.Response); err != nil {
+        fmt.Fprintf(out, ";; response does not decode: %v\n", err)
+    } else {
+        fmt.Fprintln(out, m.String())
+    }
+
+    if wire {
+        fmt.Fprintf(out, ";; query %s\n", hex.EncodeToString(e.Query))
+        fmt.Fprintf(out, ";; response %s\n", hex.EncodeToString(e.Response))
+    }
+    fmt.Fprintln(out)
+}
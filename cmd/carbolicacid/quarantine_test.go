@@ -0,0 +1,109 @@
+package main
+
+import (
+    "bytes"
+    "encoding/binary"
+    "encoding/hex"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/miekg/dns"
+)
+
+// quarantineRecord: 按 quarantine.go 中的记录格式编码一条记录，独立于插件内部的编码器
+func quarantineRecord(ts time.Time, client, rule string, query, resp []byte) []byte {
+    body := binary.BigEndian.AppendUint64(nil, uint64(ts.UnixNano()))
+    for _, s := range []string{client, "dns://:53", "nxdomain", rule} {
+        body = binary.BigEndian.AppendUint16(body, uint16(len(s)))
+        body = append(body, s...)
+    }
+    for _, b := range [][]byte{query, resp} {
+        body = binary.BigEndian.AppendUint32(body, uint32(len(b)))
+        body = append(body, b...)
+    }
+    return append(binary.BigEndian.AppendUint32(nil, uint32(len(body))), body...)
+}
+
+func writeSegment(t *testing.T, dir string, records ...[]byte) {
+    t.Helper()
+    data := []byte("CAQ1")
+    for _, r := range records {
+        data = append(data, r...)
+    }
+    if err := os.WriteFile(filepath.Join(dir, "00000000000000000001.caq"), data, 0o640); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestRunQuarantine(t *testing.T) {
+    dir := t.TempDir()
+    now := time.Now()
+
+    q := new(dns.Msg)
+    q.SetQuestion("poisoned.example.", dns.TypeA)
+    query, _ := q.Pack()
+    resp := answer(t, "poisoned.example.", "poisoned.example. 300 IN A 127.0.0.1")
+
+    writeSegment(t, dir,
+        quarantineRecord(now.Add(-2*time.Hour), "192.0.2.1:53000", "preset iana 127.0.0.0/8", query, resp),
+        quarantineRecord(now.Add(-time.Minute), "192.0.2.2:53000", "block 10.0.0.0/8", query, resp),
+        quarantineRecord(now, "192.0.2.3:53000", "block 10.0.0.0/8", query, []byte{1, 2, 3}),
+    )
+
+    tests := []struct {
+        name    string
+        args    []string
+        entries int
+        want    []string
+    }{
+        {"all", nil, 3, []string{"192.0.2.1:53000", "poisoned.example.\t300\tIN\tA\t127.0.0.1", "response does not decode"}},
+        {"rule", []string{"-rule", "block 10.0.0.0/8"}, 2, []string{"192.0.2.2:53000", "192.0.2.3:53000"}},
+        {"since", []string{"-since", "1h"}, 2, []string{"192.0.2.2:53000"}},
+        {"limit", []string{"-n", "1"}, 1, []string{"192.0.2.1:53000"}},
+        {"wire", []string{"-wire", "-n", "1"}, 1, []string{";; query " + hex.EncodeToString(query), ";; response " + hex.EncodeToString(resp)}},
+    }
+
+    for _, tc := range tests {
+        var out bytes.Buffer
+        if err := runQuarantine(append(tc.args, dir), &out); err != nil {
+            t.Fatalf("%s: %v", tc.name, err)
+        }
+        if n := strings.Count(out.String(), " client="); n != tc.entries {
+            t.Errorf("%s: expected %d entries, got %d:\n%s", tc.name, tc.entries, n, out.String())
+        }
+        for _, w := range tc.want {
+            if !strings.Contains(out.String(), w) {
+                t.Errorf("%s: output does not contain %q:\n%s", tc.name, w, out.String())
+            }
+        }
+    }
+}
+
+func TestRunQuarantineCorruptSegment(t *testing.T) {
+    good := quarantineRecord(time.Now(), "192.0.2.1:53000", "block 10.0.0.0/8", nil, nil)
+    tests := []struct {
+        name string
+        tail []byte
+        err  string
+    }{
+        {"huge length", []byte{0xff, 0xff, 0xff, 0xff}, "exceeds"},
+        {"malformed record", []byte{0, 0, 0, 3, 1, 2, 3}, "malformed"},
+    }
+
+    for _, tc := range tests {
+        dir := t.TempDir()
+        writeSegment(t, dir, good, tc.tail)
+        var out bytes.Buffer
+        err := runQuarantine([]string{dir}, &out)
+        if err == nil || !strings.Contains(err.Error(), tc.err) {
+            t.Errorf("%s: expected error containing %q, got %v", tc.name, tc.err, err)
+        }
+        // 损坏之前的记录照常输出
+        if !strings.Contains(out.String(), "192.0.2.1:53000") {
+            t.Errorf("%s: entries before the corruption were not printed:\n%s", tc.name, out.String())
+        }
+    }
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+    "bytes"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "sort"
+    "strings"
+    "time"
+
+    carbolicacid "github.com/arizuka/coredns-carbolicacid"
+    "github.com/coredns/caddy/caddyfile"
+    "github.com/coredns/coredns/plugin"
+    tap "github.com/dnstap/golang-dnstap"
+    "github.com/miekg/dns"
+)
+
+// defaultDnstapTypes: 默认只重放上游应答
+//
+// 同一查询在 CoreDNS 的 dnstap 中还会以 CLIENT_RESPONSE（写给客户端的应答）出现，
+// 递归解析器还会产生 RESOLVER_RESPONSE；默认一并重放会把同一个应答计数多次，因此需要时用 -dnstap-type 显式加入。
+const defaultDnstapTypes = "FORWARDER_RESPONSE"
+
+// runReplay: 把抓包或 dnstap 文件中的每个响应交给 Corefile 中的策略，报告各规则的命中
+//
+// 只评估 blockList / allowList（Policy.Evaluate）；ttl、verify、retry 等依赖运行时的检查不参与。
+func runReplay(args []string, out io.Writer) error {
+    fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+    config := fs.String("config", "", "Corefile with the policy to evaluate")
+    pcapFile := fs.String("pcap", "", "classic pcap capture to replay")
+    dnstapFile := fs.String("dnstap", "", "dnstap file (Frame Streams) to replay")
+    dnstapTypes := fs.String("dnstap-type", defaultDnstapTypes, "comma-separated dnstap message types to replay (e.g. FORWARDER_RESPONSE,RESOLVER_RESPONSE,CLIENT_RESPONSE)")
+    port := fs.Uint("port", 53, "pcap: only replay responses sent from this port")
+    samples := fs.Int("samples", 3, "sample qnames to show per rule")
+    list := fs.Int("list", 20, "blocked responses to list (0 = none, -1 = all)")
+    if err := fs.Parse(args); err != nil {
+        return err
+    }
+    if *config == "" || (*pcapFile == "") == (*dnstapFile == "") || fs.NArg() != 0 {
+        return fmt.Errorf("usage: replay -config Corefile (-pcap FILE | -dnstap FILE)")
+    }
+    if *port == 0 || *port > 0xffff {
+        return fmt.Errorf("invalid port %d", *port)
+    }
+
+    rp, err := newReplayer(*config)
+    if err != nil {
+        return err
+    }
+    rp.samples = *samples
+
+    var stats captureStats
+    if *pcapFile != "" {
+        f, err := os.Open(*pcapFile)
+        if err != nil {
+            return err
+        }
+        defer f.Close()
+        err = readPcap(f, uint16(*port), &stats, rp.replay)
+        if err != nil {
+            return err
+        }
+    } else {
+        types, err := parseDnstapTypes(*dnstapTypes)
+        if err != nil {
+            return err
+        }
+        f, err := os.Open(*dnstapFile)
+        if err != nil {
+            return err
+        }
+        defer f.Close()
+        if err := readDnstap(f, types, &stats, rp.replay); err != nil {
+            return err
+        }
+    }
+
+    rp.print(out, stats, *list)
+    return nil
+}
+
+func parseDnstapTypes(s string) (map[tap.Message_Type]bool, error) {
+    types := make(map[tap.Message_Type]bool)
+    for _, name := range strings.Split(s, ",") {
+        v, ok := tap.Message_Type_value[strings.TrimSpace(name)]
+        if !ok {
+            return nil, fmt.Errorf("unknown dnstap message type %q", name)
+        }
+        types[tap.Message_Type(v)] = true
+    }
+    return types, nil
+}
+
+// replayer: 按 qname 把响应路由到对应 server block 的策略，并汇总结果
+type replayer struct {
+    zones    plugin.Zones                     // Corefile 中所有 server block 的 zone
+    policies map[string]*carbolicacid.Checked // zone → 该 zone 的 carbolicacid 块
+    samples  int
+
+    total, undecodable, unfiltered, evaluated int
+    blocked, allowed                          int
+
+    rules       map[string]*ruleHits // zone + rule → 命中
+    blockedList []blockedResponse
+}
+
+type ruleHits struct {
+    zone    string
+    kind    string // block / allow
+    rule    string
+    hits    int
+    samples []string
+}
+
+type blockedResponse struct {
+    time   time.Time
+    zone   string
+    qname  string
+    qtype  string
+    action string
+    rule   string
+}
+
+// newReplayer: 解析 Corefile；任一 carbolicacid 块有错误时返回错误
+func newReplayer(name string) (*replayer, error) {
+    input, err := os.ReadFile(name)
+    if err != nil {
+        return nil, err
+    }
+    list, err := carbolicacid.CheckCorefile(name, bytes.NewReader(input))
+    if err != nil {
+        return nil, err
+    }
+    if len(list) == 0 {
+        return nil, fmt.Errorf("%s: no carbolicacid block found", name)
+    }
+
+    rp := &replayer{policies: make(map[string]*carbolicacid.Checked), rules: make(map[string]*ruleHits)}
+    for _, ch := range list {
+        if ch.Err != nil {
+            return nil, ch.Err
+        }
+        for _, z := range ch.Zones {
+            if _, ok := rp.policies[z]; !ok {
+                rp.policies[z] = ch
+            }
+        }
+    }
+
+    // 没有 carbolicacid 的 server block 也参与路由：例如服务器自身 FQDN 的 zone
+    rp.zones, err = corefileZones(name, input)
+    if err != nil {
+        return nil, err
+    }
+    return rp, nil
+}
+
+// corefileZones: 所有 server block 的 zone；carbolicacid 片段视为根区
+func corefileZones(name string, input []byte) (plugin.Zones, error) {
+    d := caddyfile.NewDispenser(name, bytes.NewReader(input))
+    if d.Next() && d.Val() == "carbolicacid" {
+        return plugin.Zones{"."}, nil
+    }
+    blocks, err := caddyfile.Parse(name, bytes.NewReader(input), nil)
+    if err != nil {
+        return nil, err
+    }
+    var zones plugin.Zones
+    for _, sb := range blocks {
+        for _, k := range sb.Keys {
+            zones = append(zones, plugin.Host(k).NormalizeExact()...)
+        }
+    }
+    return zones, nil
+}
+
+func (rp *replayer) replay(c capturedMsg) {
+    rp.total++
+
+    m := new(dns.Msg)
+    if err := m.Unpack(c.Wire); err != nil || !m.Response || len(m.Question) == 0 {
+        rp.undecodable++
+        return
+    }
+
+    q := m.Question[0]
+    zone := rp.zones.Matches(q.Name)
+    ch := rp.policies[zone]
+    if ch == nil {
+        rp.unfiltered++
+        return
+    }
+    rp.evaluated++
+
+    v := ch.Policy.Evaluate(m)
+    kind := "allow"
+    switch {
+    case v.Blocked:
+        rp.blocked++
+        kind = "block"
+    case len(v.Rules) > 0:
+        rp.allowed++
+    }
+    for _, r := range v.Rules {
+        rp.hit(zone, kind, r.String(), q.Name)
+    }
+
+    if v.Blocked {
+        b := blockedResponse{
+            time:   c.Time,
+            zone:   zone,
+            qname:  q.Name,
+            qtype:  dns.TypeToString[q.Qtype],
+            action: v.Action.String(),
+        }
+        if len(v.Rules) > 0 {
+            b.rule = v.Rules[0].String()
+        }
+        rp.blockedList = append(rp.blockedList, b)
+    }
+}
+
+func (rp *replayer) hit(zone, kind, rule, qname string) {
+    key := zone + "\x00" + kind + "\x00" + rule
+    h := rp.rules[key]
+    if h == nil {
+        h = &ruleHits{zone: zone, kind: kind, rule: rule}
+        rp.rules[key] = h
+    }
+    h.hits++
+    if len(h.samples) >= rp.samples {
+        return
+    }
+    for _, s := range h.samples {
+        if s == qname {
+            return
+        }
+    }
+    h.samples = append(h.samples, qname)
+}
+
+// sortedRules: 按命中次数从多到少
+func (rp *replayer) sortedRules() []*ruleHits {
+    list := make([]*ruleHits, 0, len(rp.rules))
+    for _, h := range rp.rules {
+        list = append(list, h)
+    }
+    sort.Slice(list, func(i, j int) bool {
+        a, b := list[i], list[j]
+        if a.hits != b.hits {
+            return a.hits > b.hits
+        }
+        if a.zone != b.zone {
+            return a.zone < b.zone
+        }
+        if a.kind != b.kind {
+            return a.kind > b.kind // block 在前
+        }
+        return a.rule < b.rule
+    })
+    return list
+}
+
+func (rp *replayer) print(out io.Writer, stats captureStats, limit int) {
+    fmt.Fprintf(out, "responses:   %d\n", rp.total)
+    fmt.Fprintf(out, "  evaluated: %d\n", rp.evaluated)
+    fmt.Fprintf(out, "  blocked:   %d\n", rp.blocked)
+    fmt.Fprintf(out, "  allowed by exclude: %d\n", rp.allowed)
+    fmt.Fprintf(out, "  zone without carbolicacid: %d\n", rp.unfiltered)
+    fmt.Fprintf(out, "  not a DNS response: %d\n", rp.undecodable)
+    if stats.Fragments+stats.Partial > 0 {
+        fmt.Fprintf(out, "skipped: %d IP fragments, %d TCP messages spanning segments\n", stats.Fragments, stats.Partial)
+    }
+
+    if rules := rp.sortedRules(); len(rules) > 0 {
+        fmt.Fprintf(out, "\n%-8s %-6s %-50s %s\n", "HITS", "KIND", "RULE", "SAMPLES")
+        for _, h := range rules {
+            rule := h.rule
+            if len(rp.zones) > 1 {
+                rule = h.zone + " " + rule
+            }
+            fmt.Fprintf(out, "%-8d %-6s %-50s %s\n", h.hits, h.kind, rule, strings.Join(h.samples, " "))
+        }
+    }
+
+    if limit == 0 || len(rp.blockedList) == 0 {
+        return
+    }
+    fmt.Fprintf(out, "\nblocked responses:\n")
+    for i, b := range rp.blockedList {
+        if limit > 0 && i >= limit {
+            fmt.Fprintf(out, "  ... and %d more\n", len(rp.blockedList)-limit)
+            break
+        }
+        qname := b.qname
+        if len(rp.zones) > 1 {
+            qname = b.zone + " " + qname
+        }
+        fmt.Fprintf(out, "  %s %s %s %s rule=%q\n", b.time.Format(time.RFC3339Nano), qname, b.qtype, b.action, b.rule)
+    }
+}
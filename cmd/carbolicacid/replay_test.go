@@ -0,0 +1,264 @@
+package main
+
+import (
+    "bytes"
+    "encoding/binary"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+
+    tap "github.com/dnstap/golang-dnstap"
+    "github.com/miekg/dns"
+    "google.golang.org/protobuf/proto"
+)
+
+const replayCorefile = `server.example.com {
+    log
+}
+
+. {
+    carbolicacid {
+        preset iana
+        block 203.0.113.0/24 {
+            exclude 203.0.113.8/29
+        }
+        responses nxdomain
+    }
+}
+`
+
+func answer(t *testing.T, name, rr string) []byte {
+    t.Helper()
+    m := new(dns.Msg)
+    m.SetQuestion(name, dns.TypeA)
+    m.Response = true
+    r, err := dns.NewRR(rr)
+    if err != nil {
+        t.Fatal(err)
+    }
+    m.Answer = append(m.Answer, r)
+    wire, err := m.Pack()
+    if err != nil {
+        t.Fatal(err)
+    }
+    return wire
+}
+
+// udp4Frame: Ethernet + IPv4 + UDP，源端口 53
+func udp4Frame(payload []byte) []byte {
+    eth := make([]byte, 14)
+    binary.BigEndian.PutUint16(eth[12:], 0x0800)
+
+    ip := make([]byte, 20)
+    ip[0] = 0x45
+    binary.BigEndian.PutUint16(ip[2:], uint16(20+8+len(payload)))
+    ip[9] = 17
+
+    udp := make([]byte, 8)
+    binary.BigEndian.PutUint16(udp[0:], 53)
+    binary.BigEndian.PutUint16(udp[2:], 40000)
+    binary.BigEndian.PutUint16(udp[4:], uint16(8+len(payload)))
+
+    return append(append(append(eth, ip...), udp...), payload...)
+}
+
+// tcp6Frame: Linux cooked (SLL) + IPv6 + TCP，段内为带长度前缀的报文
+func tcp6Frame(msgs ...[]byte) []byte {
+    var stream []byte
+    for _, m := range msgs {
+        stream = binary.BigEndian.AppendUint16(stream, uint16(len(m)))
+        stream = append(stream, m...)
+    }
+
+    sll := make([]byte, 16)
+    binary.BigEndian.PutUint16(sll[14:], 0x86dd)
+
+    ip := make([]byte, 40)
+    ip[0] = 0x60
+    binary.BigEndian.PutUint16(ip[4:], uint16(20+len(stream)))
+    ip[6] = 6
+
+    tcp := make([]byte, 20)
+    binary.BigEndian.PutUint16(tcp[0:], 53)
+    tcp[12] = 5 << 4
+
+    return append(append(append(sll, ip...), tcp...), stream...)
+}
+
+func pcapFile(link uint32, frames ...[]byte) []byte {
+    var b []byte
+    b = binary.LittleEndian.AppendUint32(b, 0xa1b2c3d4)
+    b = binary.LittleEndian.AppendUint16(b, 2)
+    b = binary.LittleEndian.AppendUint16(b, 4)
+    b = append(b, make([]byte, 8)...)
+    b = binary.LittleEndian.AppendUint32(b, 65535)
+    b = binary.LittleEndian.AppendUint32(b, link)
+    for i, f := range frames {
+        b = binary.LittleEndian.AppendUint32(b, uint32(1700000000+i))
+        b = binary.LittleEndian.AppendUint32(b, 0)
+        b = binary.LittleEndian.AppendUint32(b, uint32(len(f)))
+        b = binary.LittleEndian.AppendUint32(b, uint32(len(f)))
+        b = append(b, f...)
+    }
+    return b
+}
+
+func newTestReplayer(t *testing.T) *replayer {
+    t.Helper()
+    name := filepath.Join(t.TempDir(), "Corefile")
+    if err := os.WriteFile(name, []byte(replayCorefile), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    rp, err := newReplayer(name)
+    if err != nil {
+        t.Fatal(err)
+    }
+    rp.samples = 2
+    return rp
+}
+
+func TestReplayPcap(t *testing.T) {
+    rp := newTestReplayer(t)
+
+    poisoned := answer(t, "a.example.org.", "a.example.org. 60 IN A 203.0.113.1")
+    excluded := answer(t, "b.example.org.", "b.example.org. 60 IN A 203.0.113.9")
+    clean := answer(t, "c.example.org.", "c.example.org. 60 IN A 93.184.216.34")
+    self := answer(t, "server.example.com.", "server.example.com. 60 IN A 127.0.0.1")
+    loop := answer(t, "d.example.org.", "d.example.org. 60 IN A 127.0.0.1")
+
+    var stats captureStats
+    if err := readPcap(bytes.NewReader(pcapFile(linkEthernet,
+        udp4Frame(poisoned), udp4Frame(excluded), udp4Frame(clean), udp4Frame(self),
+    )), 53, &stats, rp.replay); err != nil {
+        t.Fatal(err)
+    }
+    if err := readPcap(bytes.NewReader(pcapFile(linkSLL,
+        tcp6Frame(poisoned, loop),
+    )), 53, &stats, rp.replay); err != nil {
+        t.Fatal(err)
+    }
+
+    if rp.total != 6 || rp.evaluated != 5 || rp.unfiltered != 1 || rp.blocked != 3 || rp.allowed != 1 {
+        t.Fatalf("unexpected totals: %+v", rp)
+    }
+
+    rules := rp.sortedRules()
+    if len(rules) != 3 {
+        t.Fatalf("expected 3 rules, got %d", len(rules))
+    }
+    if r := rules[0]; r.rule != "block 203.0.113.0/24" || r.hits != 2 || len(r.samples) != 1 {
+        t.Fatalf("unexpected top rule: %+v", r)
+    }
+
+    var out strings.Builder
+    rp.print(&out, stats, 1)
+    for _, want := range []string{"blocked:   3", "preset iana 127.0.0.0/8", "a.example.org. A nxdomain", "... and 2 more"} {
+        if !strings.Contains(out.String(), want) {
+            t.Errorf("report lacks %q:\n%s", want, out.String())
+        }
+    }
+}
+
+func TestReplayDnstap(t *testing.T) {
+    rp := newTestReplayer(t)
+
+    var buf bytes.Buffer
+    w, err := tap.NewWriter(&buf, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    now := time.Now()
+    for _, m := range []struct {
+        typ  tap.Message_Type
+        wire []byte
+    }{
+        {tap.Message_FORWARDER_RESPONSE, answer(t, "a.example.org.", "a.example.org. 60 IN A 203.0.113.1")},
+        {tap.Message_CLIENT_QUERY, nil},
+        {tap.Message_CLIENT_RESPONSE, answer(t, "c.example.org.", "c.example.org. 60 IN A 93.184.216.34")},
+    } {
+        typ, dt := m.typ, tap.Dnstap_MESSAGE
+        sec, nsec := uint64(now.Unix()), uint32(now.Nanosecond())
+        frame, err := proto.Marshal(&tap.Dnstap{
+            Type: &dt,
+            Message: &tap.Message{
+                Type:             &typ,
+                ResponseMessage:  m.wire,
+                ResponseTimeSec:  &sec,
+                ResponseTimeNsec: &nsec,
+            },
+        })
+        if err != nil {
+            t.Fatal(err)
+        }
+        if _, err := w.WriteFrame(frame); err != nil {
+            t.Fatal(err)
+        }
+    }
+    w.Close()
+    frames := append([]byte(nil), buf.Bytes()...)
+
+    // 默认只重放上游应答，CLIENT_RESPONSE 不重复计数
+    types, err := parseDnstapTypes(defaultDnstapTypes)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var stats captureStats
+    if err := readDnstap(&buf, types, &stats, rp.replay); err != nil {
+        t.Fatal(err)
+    }
+    if rp.total != 1 || rp.blocked != 1 || stats.Other != 2 {
+        t.Fatalf("unexpected totals: %+v %+v", rp, stats)
+    }
+
+    // 显式加入 CLIENT_RESPONSE
+    buf.Reset()
+    buf.Write(frames)
+    rp = newTestReplayer(t)
+    if types, err = parseDnstapTypes("FORWARDER_RESPONSE,CLIENT_RESPONSE"); err != nil {
+        t.Fatal(err)
+    }
+    stats = captureStats{}
+    if err := readDnstap(&buf, types, &stats, rp.replay); err != nil {
+        t.Fatal(err)
+    }
+    if rp.total != 2 || rp.blocked != 1 || stats.Other != 1 {
+        t.Fatalf("unexpected totals with CLIENT_RESPONSE: %+v %+v", rp, stats)
+    }
+}
+
+func TestReadPcapSkips(t *testing.T) {
+    resp := answer(t, "a.example.org.", "a.example.org. 60 IN A 203.0.113.1")
+
+    frag := udp4Frame(resp)
+    binary.BigEndian.PutUint16(frag[14+6:], 0x2000) // MF
+    query := udp4Frame(resp)
+    binary.BigEndian.PutUint16(query[14+20:], 40000) // 源端口不是 53
+    partial := tcp6Frame(resp)
+    partial = partial[:len(partial)-4]
+    binary.BigEndian.PutUint16(partial[16+4:], uint16(len(partial)-16-40))
+
+    var stats captureStats
+    n := 0
+    if err := readPcap(bytes.NewReader(pcapFile(linkEthernet, frag, query)), 53, &stats, func(capturedMsg) { n++ }); err != nil {
+        t.Fatal(err)
+    }
+    if err := readPcap(bytes.NewReader(pcapFile(linkSLL, partial)), 53, &stats, func(capturedMsg) { n++ }); err != nil {
+        t.Fatal(err)
+    }
+    if n != 0 || stats.Fragments != 1 || stats.Partial != 1 || stats.Other != 1 {
+        t.Fatalf("unexpected result: %d messages, %+v", n, stats)
+    }
+
+    // incl_len 超过 snaplen：报错而不是按该长度分配
+    bad := pcapFile(linkEthernet, query)
+    binary.LittleEndian.PutUint32(bad[24+8:], 0xfffffff0)
+    if err := readPcap(bytes.NewReader(bad), 53, &stats, func(capturedMsg) { n++ }); err == nil || !strings.Contains(err.Error(), "exceeds snaplen 65535") {
+        t.Fatalf("expected snaplen error, got %v", err)
+    }
+
+    if err := readPcap(bytes.NewReader([]byte{0x0a, 0x0d, 0x0d, 0x0a, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}), 53, &stats, nil); err == nil || !strings.Contains(err.Error(), "pcapng") {
+        t.Fatalf("expected pcapng error, got %v", err)
+    }
+}
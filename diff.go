@@ -0,0 +1,173 @@
+package carbolicacid
+
+import (
+    "encoding/binary"
+    "math/big"
+    "net/netip"
+    "sort"
+)
+
+// AddressSpace: 一段地址空间，表示为最少的不重叠前缀，按地址排序
+type AddressSpace struct {
+    V4 []netip.Prefix
+    V6 []netip.Prefix
+}
+
+// Empty: 是否不含任何地址
+func (s AddressSpace) Empty() bool {
+    return len(s.V4) == 0 && len(s.V6) == 0
+}
+
+// RuleChange: 一条 preset/block 规则在两个配置之间的变化
+type RuleChange struct {
+    Rule string // "preset iana" / "block 10.0.0.0/8"
+    Old  string // 旧配置中的动作；规则不存在时为 ""
+    New  string // 新配置中的动作；规则不存在时为 ""
+
+    ExcludesAdded   []string
+    ExcludesRemoved []string
+}
+
+// PolicyDiff: 两个 Policy 生效地址空间与规则动作的差异
+//
+// 阻断地址空间为 blockList 减去 allowList（与 MatchAddr 一致），exclude 地址空间为 allowList 的并集。
+// IPv4 与 IPv6 分别计算（::ffff:0:0/96 属于 IPv6）；AAAA 内嵌 IPv4 检查不计入。
+// 两边的地址空间在 NewPolicy 时已规范化，这里只做区间差集。
+type PolicyDiff struct {
+    Blocked   AddressSpace // 新配置中新增的阻断地址空间
+    Unblocked AddressSpace // 新配置中不再阻断的地址空间
+    Allowed   AddressSpace // 新增的 exclude 地址空间
+    Unallowed AddressSpace // 不再 exclude 的地址空间
+
+    Rules []RuleChange // 新增、删除、动作或 exclude 有变化的规则，按规则名排序
+}
+
+// Empty: 两个 Policy 是否等价
+func (d *PolicyDiff) Empty() bool {
+    return d.Blocked.Empty() && d.Unblocked.Empty() && d.Allowed.Empty() && d.Unallowed.Empty() && len(d.Rules) == 0
+}
+
+// DiffPolicies: 比较 old 与 new；任一为 nil 视为不阻断任何地址
+func DiffPolicies(old, new *Policy) *PolicyDiff {
+    var ob, oa, nb, na addrRanges
+    if old != nil {
+        ob, oa = old.blocked, old.excluded
+    }
+    if new != nil {
+        nb, na = new.blocked, new.excluded
+    }
+
+    return &PolicyDiff{
+        Blocked:   nb.minus(ob).space(),
+        Unblocked: ob.minus(nb).space(),
+        Allowed:   na.minus(oa).space(),
+        Unallowed: oa.minus(na).space(),
+        Rules:     diffRules(old, new),
+    }
+}
+
+// BlockedSpace: 生效的阻断地址空间（blockList − allowList），AAAA 内嵌 IPv4 检查不计入
+func (p *Policy) BlockedSpace() AddressSpace {
+    if p == nil {
+        return AddressSpace{}
+    }
+    return p.blocked.space()
+}
+
+// AddressCount: 一组前缀包含的地址数（前缀不重叠）
+func AddressCount(list []netip.Prefix) *big.Int {
+    n := new(big.Int)
+    for _, p := range list {
+        n.Add(n, new(big.Int).Lsh(big.NewInt(1), uint(p.Addr().BitLen()-p.Bits())))
+    }
+    return n
+}
+
+// space: 区间 → 最少的前缀
+func (a addrRanges) space() AddressSpace {
+    var s AddressSpace
+    for _, c := range ipv4RangesToCIDRs(a.v4) {
+        var b [4]byte
+        binary.BigEndian.PutUint32(b[:], uint32(uint64(c.shifted)<<c.shift))
+        s.V4 = append(s.V4, netip.PrefixFrom(netip.AddrFrom4(b), 32-int(c.shift)))
+    }
+
+    cidrs := ipv6RangesToCIDRs(a.v6)
+    for i, r := range cidrV6ToRanges(cidrs) {
+        var b [16]byte
+        binary.BigEndian.PutUint64(b[:8], r.startHi)
+        binary.BigEndian.PutUint64(b[8:], r.startLo)
+        s.V6 = append(s.V6, netip.PrefixFrom(netip.AddrFrom16(b), int(cidrs[i].prefix)))
+    }
+    return s
+}
+
+// diffRules: 按 BlockNode.String() 对应两边的规则
+func diffRules(old, new *Policy) []RuleChange {
+    type side struct {
+        action string
+        excl   []string
+    }
+    collect := func(p *Policy) map[string]side {
+        m := make(map[string]side)
+        if p == nil {
+            return m
+        }
+        for _, b := range p.Blocks {
+            s := m[b.String()]
+            s.action = p.Action.String()
+            for _, e := range b.Excl {
+                if pfx, err := parsePrefix(e); err == nil {
+                    e = pfx.String() // 127.0.0.1 与 127.0.0.1/32 视为同一条
+                }
+                s.excl = append(s.excl, e)
+            }
+            m[b.String()] = s
+        }
+        return m
+    }
+    om, nm := collect(old), collect(new)
+
+    var changes []RuleChange
+    seen := make(map[string]bool)
+    for _, m := range []map[string]side{om, nm} {
+        for rule := range m {
+            if seen[rule] {
+                continue
+            }
+            seen[rule] = true
+
+            o, n := om[rule], nm[rule]
+            c := RuleChange{
+                Rule:            rule,
+                Old:             o.action,
+                New:             n.action,
+                ExcludesAdded:   stringsMissing(n.excl, o.excl),
+                ExcludesRemoved: stringsMissing(o.excl, n.excl),
+            }
+            if c.Old != c.New || len(c.ExcludesAdded) > 0 || len(c.ExcludesRemoved) > 0 {
+                changes = append(changes, c)
+            }
+        }
+    }
+    sort.Slice(changes, func(i, j int) bool { return changes[i].Rule < changes[j].Rule })
+    return changes
+}
+
+// stringsMissing: a 中不在 b 里的元素（保持 a 的顺序）
+func stringsMissing(a, b []string) []string {
+    var out []string
+    for _, s := range a {
+        found := false
+        for _, t := range b {
+            if s == t {
+                found = true
+                break
+            }
+        }
+        if !found {
+            out = append(out, s)
+        }
+    }
+    return out
+}
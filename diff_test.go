@@ -0,0 +1,110 @@
+package carbolicacid
+
+import (
+    "net/netip"
+    "testing"
+)
+
+func mustPolicy(t *testing.T, action ResponseAction, blocks ...*BlockNode) *Policy {
+    t.Helper()
+    p, err := NewPolicy(blocks, action)
+    if err != nil {
+        t.Fatalf("NewPolicy failed: %v", err)
+    }
+    return p
+}
+
+func prefixStrings(list []netip.Prefix) []string {
+    out := make([]string, len(list))
+    for i, p := range list {
+        out[i] = p.String()
+    }
+    return out
+}
+
+func equalStrings(a, b []string) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    for i := range a {
+        if a[i] != b[i] {
+            return false
+        }
+    }
+    return true
+}
+
+func TestDiffPolicies(t *testing.T) {
+    old := mustPolicy(t, ActionNxdomain,
+        &BlockNode{Kind: RuleInclude, Value: "10.0.0.0/8", Excl: []string{"10.1.0.0/16"}},
+        &BlockNode{Kind: RuleInclude, Value: "2001:db8::/32"},
+    )
+    new := mustPolicy(t, ActionDrop,
+        &BlockNode{Kind: RuleInclude, Value: "10.0.0.0/8", Excl: []string{"10.1.0.0/17"}},
+        &BlockNode{Kind: RuleInclude, Value: "192.0.2.0/24"},
+    )
+
+    d := DiffPolicies(old, new)
+    for _, c := range []struct {
+        name      string
+        got, want []string
+    }{
+        {"blocked v4", prefixStrings(d.Blocked.V4), []string{"10.1.128.0/17", "192.0.2.0/24"}},
+        {"blocked v6", prefixStrings(d.Blocked.V6), []string{}},
+        {"unblocked v6", prefixStrings(d.Unblocked.V6), []string{"2001:db8::/32"}},
+        {"allowed v4", prefixStrings(d.Allowed.V4), []string{}},
+        {"unallowed v4", prefixStrings(d.Unallowed.V4), []string{"10.1.128.0/17"}},
+    } {
+        if !equalStrings(c.got, c.want) {
+            t.Errorf("%s: got %v, want %v", c.name, c.got, c.want)
+        }
+    }
+    if n := AddressCount(d.Blocked.V4).Int64(); n != 32768+256 {
+        t.Errorf("unexpected blocked count %d", n)
+    }
+
+    if len(d.Rules) != 3 {
+        t.Fatalf("expected 3 rule changes, got %+v", d.Rules)
+    }
+    if c := d.Rules[0]; c.Rule != "block 10.0.0.0/8" || c.Old != "nxdomain" || c.New != "drop" ||
+        !equalStrings(c.ExcludesAdded, []string{"10.1.0.0/17"}) || !equalStrings(c.ExcludesRemoved, []string{"10.1.0.0/16"}) {
+        t.Errorf("unexpected change: %+v", c)
+    }
+    if c := d.Rules[1]; c.Rule != "block 192.0.2.0/24" || c.Old != "" || c.New != "drop" {
+        t.Errorf("unexpected change: %+v", c)
+    }
+    if c := d.Rules[2]; c.Rule != "block 2001:db8::/32" || c.Old != "nxdomain" || c.New != "" {
+        t.Errorf("unexpected change: %+v", c)
+    }
+
+    if d := DiffPolicies(old, old); !d.Empty() {
+        t.Fatalf("expected no difference, got %+v", d)
+    }
+}
+
+func TestDiffPoliciesAllIP(t *testing.T) {
+    // 整个地址空间：区间末尾为最大地址，不能溢出
+    all := mustPolicy(t, ActionBypass, &BlockNode{Kind: RulePreset, Value: "allip", Excl: []string{"127.0.0.1", "::1"}})
+
+    d := DiffPolicies(nil, all)
+    if n := len(d.Blocked.V4); n != 32 {
+        t.Fatalf("expected 32 IPv4 prefixes, got %d: %v", n, d.Blocked.V4)
+    }
+    if n := len(d.Blocked.V6); n != 128 {
+        t.Fatalf("expected 128 IPv6 prefixes, got %d", n)
+    }
+    if got := AddressCount(d.Blocked.V4).String(); got != "4294967295" {
+        t.Fatalf("unexpected IPv4 count %s", got)
+    }
+    if got := AddressCount(d.Blocked.V6).String(); got != "340282366920938463463374607431768211455" {
+        t.Fatalf("unexpected IPv6 count %s", got)
+    }
+
+    d = DiffPolicies(all, mustPolicy(t, ActionBypass, &BlockNode{Kind: RulePreset, Value: "allip"}))
+    if !equalStrings(prefixStrings(d.Blocked.V4), []string{"127.0.0.1/32"}) || !equalStrings(prefixStrings(d.Unallowed.V6), []string{"::1/128"}) {
+        t.Fatalf("unexpected diff: %+v", d)
+    }
+    if len(d.Rules) != 1 || !equalStrings(d.Rules[0].ExcludesRemoved, []string{"127.0.0.1/32", "::1/128"}) {
+        t.Fatalf("unexpected rule changes: %+v", d.Rules)
+    }
+}
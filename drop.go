@@ -0,0 +1,54 @@
+package carbolicacid
+
+import (
+    "context"
+
+    "github.com/coredns/coredns/plugin/metadata"
+    "github.com/coredns/coredns/plugin/metrics"
+    "github.com/coredns/coredns/request"
+    "github.com/miekg/dns"
+)
+
+// DropMode: drop 动作在流式传输（TCP / DoT / DoH）上的行为
+type DropMode int
+
+const (
+    DropClose    DropMode = iota // 关闭连接（DoH 返回 HTTP 错误）
+    DropServfail                 // 返回 SERVFAIL
+)
+
+// drop: 执行 drop 动作
+//
+// - UDP：不写任何应答，客户端自行超时重试
+// - TCP / DoT / DoH：按 drop_stream 关闭连接或返回 SERVFAIL，避免客户端挂起
+//
+// CoreDNS 没有表示“已丢弃”的 rcode。与 acl 插件的 drop 一致，返回 dns.RcodeSuccess
+// 表示插件已自行处理、服务器不要再写默认应答；丢弃本身通过指标和 metadata 记录。
+// 写出 SERVFAIL 时同样返回 dns.RcodeSuccess，否则服务器会再写一个 SERVFAIL。
+func (c *CarbolicAcid) drop(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+    state := request.Request{W: w, Req: r}
+    proto := state.Proto()
+
+    droppedCount.WithLabelValues(metrics.WithServer(ctx), proto).Inc()
+
+    if proto == "udp" {
+        return dns.RcodeSuccess, nil
+    }
+
+    if c.cfg.DropStream == DropServfail {
+        m := synthReply(r, dns.RcodeServerFailure)
+        writeSynth(w, r, m)
+        return dns.RcodeSuccess, nil
+    }
+
+    w.Close()
+    return dns.RcodeSuccess, nil
+}
+
+// setMetadata: 记录拦截结果，供 log 等插件通过 {/carbolicacid/action}、{/carbolicacid/rule} 读取
+//
+// 仅当 metadata 插件启用时生效。
+func setMetadata(ctx context.Context, action ResponseAction, rule string) {
+    metadata.SetValueFunc(ctx, "carbolicacid/action", func() string { return action.String() })
+    metadata.SetValueFunc(ctx, "carbolicacid/rule", func() string { return rule })
+}
@@ -0,0 +1,108 @@
+package carbolicacid
+
+import (
+    "context"
+    "net"
+    "testing"
+
+    "github.com/miekg/dns"
+)
+
+func TestDropPerTransport(t *testing.T) {
+    udp := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 53000}
+    tcp := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 53000}
+
+    tests := []struct {
+        name   string
+        remote net.Addr
+        mode   DropMode
+        rc     int
+        wrote  bool
+        closed bool
+    }{
+        {"udp", udp, DropClose, dns.RcodeSuccess, false, false},
+        {"udp ignores stream mode", udp, DropServfail, dns.RcodeSuccess, false, false},
+        {"tcp close", tcp, DropClose, dns.RcodeSuccess, false, true},
+        {"tcp servfail", tcp, DropServfail, dns.RcodeSuccess, true, false},
+    }
+
+    for _, tc := range tests {
+        ca := blockedServer(ActionDrop)
+        ca.cfg.DropStream = tc.mode
+
+        w := &wireResponseWriter{remote: tc.remote}
+        r := new(dns.Msg)
+        r.SetQuestion("example.com.", dns.TypeA)
+
+        rc, err := ca.ServeDNS(context.Background(), w, r)
+        if err != nil {
+            t.Fatalf("%s: ServeDNS error: %v", tc.name, err)
+        }
+        if rc != tc.rc {
+            t.Errorf("%s: expected rc %d, got %d", tc.name, tc.rc, rc)
+        }
+        if (w.wire != nil) != tc.wrote {
+            t.Errorf("%s: expected wrote=%v", tc.name, tc.wrote)
+        }
+        if w.closed != tc.closed {
+            t.Errorf("%s: expected closed=%v", tc.name, tc.closed)
+        }
+        if tc.wrote && w.received(t).Rcode != dns.RcodeServerFailure {
+            t.Errorf("%s: expected SERVFAIL on the wire", tc.name)
+        }
+    }
+}
+
+// 通过真实的 CoreDNS 服务器读取 TCP 连接上的全部报文：servfail 只写一次，close 什么也不写
+func TestIntegrationDropStream(t *testing.T) {
+    skipIntegration(t)
+    placeDirective(t, "forward", false)
+    up := newScriptedUpstream(t, integrationAnswers)
+
+    for _, tc := range []struct {
+        mode    string
+        replies int
+    }{
+        {"servfail", 1},
+        {"close", 0},
+    } {
+        _, tcp := startCoreDNS(t, integrationCorefile(up.addr, "drop", false, "drop_stream "+tc.mode))
+
+        r := new(dns.Msg)
+        r.SetQuestion("poisoned.example.", dns.TypeA)
+        replies := exchangeTCP(t, tcp, r)
+        if len(replies) != tc.replies {
+            t.Errorf("drop_stream %s: client received %d messages, want %d: %v", tc.mode, len(replies), tc.replies, replies)
+            continue
+        }
+        if tc.replies == 1 && (replies[0].Id != r.Id || replies[0].Rcode != dns.RcodeServerFailure) {
+            t.Errorf("drop_stream %s: unexpected reply %v", tc.mode, replies[0].MsgHdr)
+        }
+    }
+}
+
+// 上游返回非 ClientWrite 的 rcode 时，drop 也不能让服务器补写默认应答
+func TestDropIgnoresUpstreamRcode(t *testing.T) {
+    ca := blockedServer(ActionDrop)
+    ca.Next = &servfailNext{resp: makeA("example.com.", "10.1.2.3")}
+
+    rw := &testResponseWriter{}
+    rc, err := ca.ServeDNS(context.Background(), rw, makeA("example.com.", "10.1.2.3"))
+    if err != nil {
+        t.Fatalf("ServeDNS error: %v", err)
+    }
+    if rc != dns.RcodeSuccess || rw.msg != nil {
+        t.Fatalf("drop must return RcodeSuccess without writing, got rc=%d", rc)
+    }
+}
+
+type servfailNext struct {
+    resp *dns.Msg
+}
+
+func (t *servfailNext) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+    w.WriteMsg(t.resp)
+    return dns.RcodeServerFailure, nil
+}
+
+func (t *servfailNext) Name() string { return "servfailNext" }
@@ -0,0 +1,128 @@
+package carbolicacid
+
+import (
+    "fmt"
+    "net"
+    "sort"
+)
+
+// RFC 6052 允许的 NAT64 前缀长度
+var nat64PrefixLens = map[int]bool{32: true, 40: true, 48: true, 56: true, 64: true, 96: true}
+
+// 默认识别的 NAT64 前缀：RFC 6052 well-known + RFC 8215 local-use
+var wellKnownNAT64 = []string{
+    "64:ff9b::/96",
+    "64:ff9b:1::/48",
+}
+
+type nat64Prefix struct {
+    prefix [16]byte
+    bits   int
+}
+
+// embeddedIPv4: 从 IPv6 地址中提取内嵌的 IPv4 地址
+//
+// 支持：NAT64（RFC 6052）、IPv4-mapped（::ffff:0:0/96）、6to4（2002::/16）、
+// Teredo（2001::/32，取混淆后的客户端地址）。
+type embeddedIPv4 struct {
+    nat64 []nat64Prefix
+}
+
+// newEmbeddedIPv4: 在 well-known 前缀基础上追加配置的 NAT64 前缀
+func newEmbeddedIPv4(extra []string) (*embeddedIPv4, error) {
+    e := &embeddedIPv4{}
+    for _, s := range append(append([]string{}, wellKnownNAT64...), extra...) {
+        p, err := parseNAT64Prefix(s)
+        if err != nil {
+            return nil, err
+        }
+        e.nat64 = append(e.nat64, p)
+    }
+
+    // 前缀可能重叠，最长前缀优先
+    sort.SliceStable(e.nat64, func(i, j int) bool { return e.nat64[i].bits > e.nat64[j].bits })
+    return e, nil
+}
+
+func parseNAT64Prefix(s string) (nat64Prefix, error) {
+    pfx, err := parsePrefix(s)
+    if err != nil {
+        return nat64Prefix{}, fmt.Errorf("invalid NAT64 prefix: %v", err)
+    }
+    if pfx.Addr().Is4() {
+        return nat64Prefix{}, fmt.Errorf("invalid NAT64 prefix %q: not an IPv6 prefix", s)
+    }
+    if !nat64PrefixLens[pfx.Bits()] {
+        return nat64Prefix{}, fmt.Errorf("invalid NAT64 prefix %q: length must be one of 32, 40, 48, 56, 64, 96", s)
+    }
+
+    return nat64Prefix{prefix: pfx.Addr().As16(), bits: pfx.Bits()}, nil
+}
+
+// extract: 返回内嵌的 IPv4（大端 uint32），不分配内存
+func (e *embeddedIPv4) extract(ip net.IP) (uint32, bool) {
+    if e == nil || len(ip) != net.IPv6len {
+        return 0, false
+    }
+
+    // IPv4-mapped ::ffff:a.b.c.d
+    if isZero(ip[:10]) && ip[10] == 0xff && ip[11] == 0xff {
+        return be32(ip[12], ip[13], ip[14], ip[15]), true
+    }
+
+    // NAT64（RFC 6052 §2.2，第 8 字节 u-octet 跳过）
+    for i := range e.nat64 {
+        p := &e.nat64[i]
+        if !hasBytePrefix(ip, p.prefix[:], p.bits/8) {
+            continue
+        }
+        switch p.bits {
+        case 32:
+            return be32(ip[4], ip[5], ip[6], ip[7]), true
+        case 40:
+            return be32(ip[5], ip[6], ip[7], ip[9]), true
+        case 48:
+            return be32(ip[6], ip[7], ip[9], ip[10]), true
+        case 56:
+            return be32(ip[7], ip[9], ip[10], ip[11]), true
+        case 64:
+            return be32(ip[9], ip[10], ip[11], ip[12]), true
+        case 96:
+            return be32(ip[12], ip[13], ip[14], ip[15]), true
+        }
+    }
+
+    // 6to4 2002:AABB:CCDD::/48
+    if ip[0] == 0x20 && ip[1] == 0x02 {
+        return be32(ip[2], ip[3], ip[4], ip[5]), true
+    }
+
+    // Teredo 2001:0000::/32，客户端地址按位取反存放在最后 32 bit
+    if ip[0] == 0x20 && ip[1] == 0x01 && ip[2] == 0 && ip[3] == 0 {
+        return ^be32(ip[12], ip[13], ip[14], ip[15]), true
+    }
+
+    return 0, false
+}
+
+func hasBytePrefix(ip net.IP, prefix []byte, n int) bool {
+    for i := 0; i < n; i++ {
+        if ip[i] != prefix[i] {
+            return false
+        }
+    }
+    return true
+}
+
+func isZero(b []byte) bool {
+    for _, v := range b {
+        if v != 0 {
+            return false
+        }
+    }
+    return true
+}
+
+func be32(a, b, c, d byte) uint32 {
+    return uint32(a)<<24 | uint32(b)<<16 | uint32(c)<<8 | uint32(d)
+}
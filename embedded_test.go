@@ -0,0 +1,81 @@
+package carbolicacid
+
+import (
+    "net"
+    "testing"
+
+    "github.com/miekg/dns"
+)
+
+func TestEmbeddedIPv4Extract(t *testing.T) {
+    e, err := newEmbeddedIPv4([]string{"2001:db8:100::/40", "2001:db8:122::/48"})
+    if err != nil {
+        t.Fatalf("newEmbeddedIPv4 failed: %v", err)
+    }
+
+    tests := []struct {
+        ip   string
+        want string
+        ok   bool
+    }{
+        {"64:ff9b::7f00:1", "127.0.0.1", true},
+        {"::ffff:127.0.0.1", "127.0.0.1", true},
+        {"2002:7f00:1::", "127.0.0.1", true},
+        {"2001:0:4136:e378:8000:63bf:3fff:fdd2", "192.0.2.45", true}, // RFC 4380 示例
+        {"2001:db8:1c0:2:21::", "192.0.2.33", true},                  // RFC 6052 /40 示例
+        {"2001:db8:122:c000:2:2100::", "192.0.2.33", true},           // RFC 6052 /48 示例
+        {"2001:db8::1", "", false},
+        {"2606:4700::1111", "", false},
+    }
+
+    for _, tc := range tests {
+        v, ok := e.extract(net.ParseIP(tc.ip))
+        if ok != tc.ok {
+            t.Fatalf("%s: expected ok=%v, got %v", tc.ip, tc.ok, ok)
+        }
+        if !ok {
+            continue
+        }
+        got := net.IPv4(byte(v>>24), byte(v>>16), byte(v>>8), byte(v)).String()
+        if got != tc.want {
+            t.Errorf("%s: expected %s, got %s", tc.ip, tc.want, got)
+        }
+    }
+}
+
+func TestEmbeddedIPv4Blocked(t *testing.T) {
+    cfg := &Config{
+        Blocks: []*BlockNode{
+            {Kind: RuleInclude, Value: "127.0.0.0/8", Excl: []string{"127.0.0.53/32"}},
+        },
+        Action:       ActionDrop,
+        EmbeddedIPv4: true,
+    }
+    if err := cfg.initBlockList(); err != nil {
+        t.Fatalf("initBlockList failed: %v", err)
+    }
+
+    aaaa := func(ip string) *dns.Msg {
+        m := new(dns.Msg)
+        m.SetQuestion("example.com.", dns.TypeAAAA)
+        rr, _ := dns.NewRR("example.com. 60 IN AAAA " + ip)
+        m.Answer = append(m.Answer, rr)
+        return m
+    }
+
+    if blocked, _ := cfg.policy.decide(aaaa("64:ff9b::7f00:1")); !blocked {
+        t.Fatalf("expected NAT64-embedded 127.0.0.1 to be blocked")
+    }
+    if blocked, _ := cfg.policy.decide(aaaa("2002:7f00:35::")); blocked {
+        t.Fatalf("expected embedded 127.0.0.53 to match allowList")
+    }
+
+    // 未开启时保持旧行为
+    cfg2 := &Config{Blocks: cfg.Blocks, Action: ActionDrop}
+    if err := cfg2.initBlockList(); err != nil {
+        t.Fatalf("initBlockList failed: %v", err)
+    }
+    if blocked, _ := cfg2.policy.decide(aaaa("64:ff9b::7f00:1")); blocked {
+        t.Fatalf("embedded IPv4 must not be checked unless enabled")
+    }
+}
@@ -0,0 +1,47 @@
+package carbolicacid
+
+import (
+    "errors"
+    "fmt"
+
+    "github.com/coredns/caddy"
+)
+
+// CIDR 校验的错误类型，可用 errors.Is 判断
+var (
+    ErrInvalidCIDR   = errors.New("invalid CIDR")
+    ErrNonCanonical  = errors.New("non-canonical CIDR")
+    ErrNotSubset     = errors.New("exclude outside its parent")
+    ErrDuplicate     = errors.New("duplicate CIDR")
+    ErrFullyExcluded = errors.New("excludes cover the whole parent")
+)
+
+// CIDRError: 单个 CIDR 的校验错误
+type CIDRError struct {
+    Kind   error  // ErrInvalidCIDR / ErrNonCanonical / ErrNotSubset / ErrDuplicate / ErrFullyExcluded
+    CIDR   string // 出错的原始写法
+    Detail string // 补充说明，可为空
+}
+
+func (e *CIDRError) Error() string {
+    if e.Detail == "" {
+        return fmt.Sprintf("%v %q", e.Kind, e.CIDR)
+    }
+    return fmt.Sprintf("%v %q: %s", e.Kind, e.CIDR, e.Detail)
+}
+
+func (e *CIDRError) Unwrap() error { return e.Kind }
+
+// configError: 与 c.Err 相同的消息（带 Corefile 文件名与行号），同时保留原始错误
+type configError struct {
+    msg string
+    err error
+}
+
+func (e *configError) Error() string { return e.msg }
+func (e *configError) Unwrap() error { return e.err }
+
+// positioned: 给错误加上当前 token 的 Corefile 位置
+func positioned(c *caddy.Controller, err error) error {
+    return &configError{msg: c.Err(err.Error()).Error(), err: err}
+}
@@ -0,0 +1,229 @@
+package carbolicacid
+
+import (
+    "encoding/binary"
+    "net"
+    "net/netip"
+    "strings"
+    "testing"
+)
+
+// 位运算匹配器的模糊测试，以 netip.Prefix.Contains 为参照
+//
+// 种子语料在 testdata/fuzz/<Target>/ 下，go test 时会逐条运行；
+// 发现的新问题用 go test -fuzz=<Target> 复现后，把最小化的输入一并提交。
+
+func addrFrom128(hi, lo uint64) netip.Addr {
+    var b [16]byte
+    binary.BigEndian.PutUint64(b[:8], hi)
+    binary.BigEndian.PutUint64(b[8:], lo)
+    return netip.AddrFrom16(b)
+}
+
+func addrFrom32(v uint32) netip.Addr {
+    var b [4]byte
+    binary.BigEndian.PutUint32(b[:], v)
+    return netip.AddrFrom4(b)
+}
+
+// lastAddr: 前缀中的最后一个地址
+func lastAddr(p netip.Prefix) netip.Addr {
+    b := p.Masked().Addr().AsSlice()
+    for i := p.Bits(); i < len(b)*8; i++ {
+        b[i/8] |= 0x80 >> (i % 8)
+    }
+    a, _ := netip.AddrFromSlice(b)
+    return a
+}
+
+// buildTestSet: 由前缀构建匹配表，各前缀的来源规则为 block 本身
+func buildTestSet(t *testing.T, list ...netip.Prefix) *IPSet {
+    t.Helper()
+    var cs CIDRSet
+    for _, p := range list {
+        if err := cs.addRule(Rule{Node: &BlockNode{Kind: RuleInclude, Value: p.String()}, CIDR: p.String()}); err != nil {
+            t.Fatalf("addRule(%s): %v", p, err)
+        }
+    }
+    return buildIPSet(&cs)
+}
+
+// probe: 匹配表的结果应与 Contains 一致；地址为 IPv4 时走 matchIPv4，否则走 matchIPv6
+func probe(t *testing.T, s *IPSet, list []netip.Prefix, a netip.Addr) {
+    t.Helper()
+    if !a.IsValid() {
+        return
+    }
+    want := false
+    for _, p := range list {
+        if p.Contains(a) {
+            want = true
+        }
+    }
+    var got bool
+    if a.Is4() {
+        got = matchIPv4(net.IP(a.AsSlice()), s)
+    } else {
+        got = matchIPv6(net.IP(a.AsSlice()), s)
+    }
+    if got != want {
+        t.Fatalf("%s in %v: matcher says %v, Contains says %v", a, list, got, want)
+    }
+}
+
+// probeEdges: 每个前缀的首尾地址以及紧邻的外侧地址
+func probeEdges(t *testing.T, s *IPSet, list []netip.Prefix) {
+    t.Helper()
+    for _, p := range list {
+        first, last := p.Addr(), lastAddr(p)
+        for _, a := range []netip.Addr{first, last, first.Prev(), last.Next()} {
+            probe(t, s, list, a)
+        }
+    }
+}
+
+func FuzzParseCIDRs(f *testing.F) {
+    f.Fuzz(func(t *testing.T, s string) {
+        cs, err := parseCIDRs([]string{s})
+
+        // 参照：不带 zone 的单个地址，或主机位为零的前缀
+        var want netip.Prefix
+        ok := false
+        if !strings.Contains(s, "%") {
+            if !strings.Contains(s, "/") {
+                if a, err := netip.ParseAddr(s); err == nil {
+                    want, ok = netip.PrefixFrom(a, a.BitLen()), true
+                }
+            } else if p, err := netip.ParsePrefix(s); err == nil && p.Masked() == p {
+                want, ok = p, true
+            }
+        }
+        if (err == nil) != ok {
+            t.Fatalf("parseCIDRs(%q): err=%v, reference accepts=%v", s, err, ok)
+        }
+        if !ok {
+            return
+        }
+
+        if len(cs.v4)+len(cs.v6) != 1 || (len(cs.v4) == 1) != want.Addr().Is4() {
+            t.Fatalf("parseCIDRs(%q): %d IPv4 / %d IPv6 entries", s, len(cs.v4), len(cs.v6))
+        }
+        cs.rules = []Rule{{Node: &BlockNode{Kind: RuleInclude, Value: s}, CIDR: s}}
+        probeEdges(t, buildIPSet(cs), []netip.Prefix{want})
+    })
+}
+
+func FuzzMatchIPv4(f *testing.F) {
+    f.Fuzz(func(t *testing.T, a, base1 uint32, bits1 uint8, base2 uint32, bits2 uint8) {
+        list := []netip.Prefix{
+            netip.PrefixFrom(addrFrom32(base1), int(bits1%33)).Masked(),
+            netip.PrefixFrom(addrFrom32(base2), int(bits2%33)).Masked(),
+        }
+        s := buildTestSet(t, list...)
+        probe(t, s, list, addrFrom32(a))
+        probeEdges(t, s, list)
+    })
+}
+
+func FuzzMatchIPv6(f *testing.F) {
+    f.Fuzz(func(t *testing.T, hi, lo, base1Hi, base1Lo uint64, bits1 uint8, base2Hi, base2Lo uint64, bits2 uint8) {
+        list := []netip.Prefix{
+            netip.PrefixFrom(addrFrom128(base1Hi, base1Lo), int(bits1%129)).Masked(),
+            netip.PrefixFrom(addrFrom128(base2Hi, base2Lo), int(bits2%129)).Masked(),
+        }
+        s := buildTestSet(t, list...)
+        probe(t, s, list, addrFrom128(hi, lo))
+        probeEdges(t, s, list)
+    })
+}
+
+// coveredBy: child 是否包含于 parents 的并集（参照实现：不被单个父前缀包含时对半拆分）
+func coveredBy(child netip.Prefix, parents []netip.Prefix) bool {
+    overlap := false
+    for _, p := range parents {
+        if p.Bits() <= child.Bits() && p.Contains(child.Addr()) {
+            return true
+        }
+        if p.Overlaps(child) {
+            overlap = true
+        }
+    }
+    if !overlap || child.Bits() == child.Addr().BitLen() {
+        return false
+    }
+    lower := netip.PrefixFrom(child.Addr(), child.Bits()+1)
+    upper := netip.PrefixFrom(lastAddr(lower).Next(), child.Bits()+1)
+    return coveredBy(lower, parents) && coveredBy(upper, parents)
+}
+
+// prefixFromFuzz: IPv4 直接使用 v；IPv6 时 v 放在最高 32 位，便于与 IPv4 共用语料
+func prefixFromFuzz(v6 bool, v uint32, bits uint8) netip.Prefix {
+    if v6 {
+        return netip.PrefixFrom(addrFrom128(uint64(v)<<32, 0), int(bits%129)).Masked()
+    }
+    return netip.PrefixFrom(addrFrom32(v), int(bits%33)).Masked()
+}
+
+func FuzzCIDRSubsetOfAny(f *testing.F) {
+    f.Fuzz(func(t *testing.T, childV6 bool, c uint32, cBits uint8, p1V6 bool, p1 uint32, p1Bits uint8, p2V6 bool, p2 uint32, p2Bits uint8) {
+        child := prefixFromFuzz(childV6, c, cBits)
+        parents := []netip.Prefix{prefixFromFuzz(p1V6, p1, p1Bits), prefixFromFuzz(p2V6, p2, p2Bits)}
+
+        got, err := cidrSubsetOfAny(child.String(), []string{parents[0].String(), parents[1].String()})
+        if err != nil {
+            t.Fatalf("cidrSubsetOfAny(%s): %v", child, err)
+        }
+        if want := coveredBy(child, parents); got != want {
+            t.Fatalf("cidrSubsetOfAny(%s, %v) = %v, want %v", child, parents, got, want)
+        }
+    })
+}
+
+// inRanges: 地址是否落在区间中（IPv4 / IPv6 分开）
+func inRanges(r addrRanges, a netip.Addr) bool {
+    if a.Is4() {
+        b := a.As4()
+        v := binary.BigEndian.Uint32(b[:])
+        for _, x := range r.v4 {
+            if x.start <= v && v <= x.end {
+                return true
+            }
+        }
+        return false
+    }
+    hi, lo := addrToUint128(a)
+    for _, x := range r.v6 {
+        if le128(x.startHi, x.startLo, hi, lo) && le128(hi, lo, x.endHi, x.endLo) {
+            return true
+        }
+    }
+    return false
+}
+
+func FuzzPrefixRanges(f *testing.F) {
+    f.Fuzz(func(t *testing.T, v6 bool, baseHi, baseLo uint64, bits uint8, hi, lo uint64) {
+        var p netip.Prefix
+        var a netip.Addr
+        if v6 {
+            p = netip.PrefixFrom(addrFrom128(baseHi, baseLo), int(bits%129)).Masked()
+            a = addrFrom128(hi, lo)
+        } else {
+            p = netip.PrefixFrom(addrFrom32(uint32(baseLo)), int(bits%33)).Masked()
+            a = addrFrom32(uint32(lo))
+        }
+
+        r := prefixRanges(p)
+        for _, x := range []netip.Addr{a, p.Addr(), lastAddr(p), p.Addr().Prev(), lastAddr(p).Next()} {
+            if x.IsValid() && inRanges(r, x) != p.Contains(x) {
+                t.Fatalf("%s in ranges of %s: %v, Contains says %v", x, p, inRanges(r, x), p.Contains(x))
+            }
+        }
+
+        // 区间 → 前缀应还原为同一个前缀
+        s := r.space()
+        back := append(s.V4, s.V6...)
+        if len(back) != 1 || back[0] != p {
+            t.Fatalf("%s round-trips to %v", p, back)
+        }
+    })
+}
@@ -29,32 +29,47 @@ var ianaPresetV6 = []string{
     "ff00::/8",
 }
 
-func loadPresetBit(name string) (*CIDRSet, error) {
-    cs := &CIDRSet{}
+// RFC 6303 本地服务反向区对应的前缀（RFC1918、环回、链路本地、文档地址、ULA 等）
+// Source: https://www.rfc-editor.org/rfc/rfc6303
+var rfc6303PresetV4 = []string{
+    "0.0.0.0/8",
+    "10.0.0.0/8",
+    "127.0.0.0/8",
+    "169.254.0.0/16",
+    "172.16.0.0/12",
+    "192.0.2.0/24",
+    "192.168.0.0/16",
+    "198.51.100.0/24",
+    "203.0.113.0/24",
+    "255.255.255.255/32",
+}
 
+var rfc6303PresetV6 = []string{
+    "::/128",
+    "::1/128",
+    "fd00::/8",
+    "fe80::/10",
+    "2001:db8::/32",
+}
+
+// presetCIDRs: preset 名称 → 展开后的前缀列表
+func presetCIDRs(name string) ([]string, error) {
     switch name {
     case "none":
-        return cs, nil
+        return nil, nil
 
     case "iana":
-        v4 := parseCIDRs(ianaPresetV4)
-        // if err != nil { return nil, err }
-        v6 := parseCIDRs(ianaPresetV6)
-        // if err != nil { return nil, err }
-        cs.v4 = append(cs.v4, v4.v4...)
-        cs.v6 = append(cs.v6, v6.v6...)
-        return cs, nil
+        out := make([]string, 0, len(ianaPresetV4)+len(ianaPresetV6))
+        out = append(out, ianaPresetV4...)
+        out = append(out, ianaPresetV6...)
+        return out, nil
 
     case "allip":
         // v0.3.2 新增 preset：全网匹配
         // 等价于 include 0.0.0.0/0 + include ::/0
-        v4 := parseCIDRs([]string{"0.0.0.0/0"})
-        v6 := parseCIDRs([]string{"::/0"})
-        cs.v4 = append(cs.v4, v4.v4...)
-        cs.v6 = append(cs.v6, v6.v6...)
-        return cs, nil
+        return []string{"0.0.0.0/0", "::/0"}, nil
 
     default:
         return nil, fmt.Errorf("unknown preset: %s", name)
     }
-}
\ No newline at end of file
+}
@@ -0,0 +1,420 @@
+package carbolicacid
+
+import (
+    "context"
+    "net"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/coredns/caddy"
+    "github.com/coredns/coredns/core/dnsserver"
+    "github.com/coredns/coredns/plugin"
+    _ "github.com/coredns/coredns/plugin/cache"
+    _ "github.com/coredns/coredns/plugin/forward"
+    "github.com/miekg/dns"
+)
+
+// Corefile 级别的集成测试：真实的 CoreDNS 服务器 + forward 到进程内的假上游，
+// 断言 UDP/TCP 客户端实际收到的应答。插件顺序由 dnsserver.Directives 决定（即 plugin.cfg）。
+
+// scriptedUpstream: 进程内的 dns.Server（UDP + TCP），按 qname 返回预设的记录，并统计每个 qname 的查询次数
+type scriptedUpstream struct {
+    addr string
+
+    mu      sync.Mutex
+    answers map[string][]dns.RR // qname → 预设记录；应答中使用副本，不与其他查询共享
+    hits    map[string]int
+}
+
+// newScriptedUpstream: answers 为 qname → RR 文本，例如 "a.example. 300 IN A 127.0.0.1"
+func newScriptedUpstream(t *testing.T, answers map[string][]string) *scriptedUpstream {
+    t.Helper()
+    u := &scriptedUpstream{answers: make(map[string][]dns.RR, len(answers)), hits: make(map[string]int)}
+    for name, list := range answers {
+        rrs := []dns.RR{} // 非 nil：有名称但没有记录时返回 NODATA
+        for _, s := range list {
+            rr, err := dns.NewRR(s)
+            if err != nil {
+                t.Fatalf("bad record %q: %v", s, err)
+            }
+            rrs = append(rrs, rr)
+        }
+        u.answers[name] = rrs
+    }
+
+    pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("listen: %v", err)
+    }
+    l, err := net.Listen("tcp", pc.LocalAddr().String())
+    if err != nil {
+        t.Fatalf("listen: %v", err)
+    }
+    u.addr = pc.LocalAddr().String()
+
+    for _, srv := range []*dns.Server{{PacketConn: pc, Handler: u}, {Listener: l, Handler: u}} {
+        started := make(chan struct{})
+        srv.NotifyStartedFunc = func() { close(started) }
+        go srv.ActivateAndServe()
+        <-started
+        t.Cleanup(func() { srv.Shutdown() })
+    }
+    return u
+}
+
+func (u *scriptedUpstream) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+    name := strings.ToLower(r.Question[0].Name)
+
+    u.mu.Lock()
+    u.hits[name]++
+    records := u.answers[name]
+    u.mu.Unlock()
+
+    m := new(dns.Msg)
+    m.SetReply(r)
+    for _, rr := range records {
+        if rr.Header().Rrtype == r.Question[0].Qtype {
+            m.Answer = append(m.Answer, dns.Copy(rr))
+        }
+    }
+    if records == nil {
+        m.Rcode = dns.RcodeNameError
+    }
+    w.WriteMsg(m)
+}
+
+func (u *scriptedUpstream) count(name string) int {
+    u.mu.Lock()
+    defer u.mu.Unlock()
+    return u.hits[name]
+}
+
+// serialize: 测试用插件，位于插件链最前面，串行处理查询
+//
+// cache 命中时会原地改写缓存条目中 RR 的 TTL（plugin/cache 的 filterRRSlice）。前后两个查询之间
+// 只经过套接字，没有 Go 层面的同步，go test -race 会把它们报告为数据竞争。
+type serialize struct {
+    Next plugin.Handler
+}
+
+var serializeMu sync.Mutex
+
+func init() {
+    plugin.Register("serialize", func(c *caddy.Controller) error {
+        c.Next()
+        dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+            return serialize{Next: next}
+        })
+        return nil
+    })
+}
+
+func (s serialize) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+    serializeMu.Lock()
+    defer serializeMu.Unlock()
+    return plugin.NextOrFailure(s.Name(), s.Next, ctx, w, r)
+}
+
+func (s serialize) Name() string { return "serialize" }
+
+// placeDirective: 把 carbolicacid 放进插件链，紧挨在 anchor 之前或之后；serialize 放在最前面（测试结束时恢复）
+//
+// 插件链中靠前的插件先处理查询、后看到响应；例如放在 cache 之后，carbolicacid 先于 cache 看到上游响应。
+func placeDirective(t *testing.T, anchor string, after bool) {
+    t.Helper()
+    saved := dnsserver.Directives
+
+    list := []string{"serialize"}
+    for _, d := range saved {
+        if d == "carbolicacid" {
+            continue
+        }
+        if d == anchor && after {
+            list = append(list, d, "carbolicacid")
+            continue
+        }
+        if d == anchor {
+            list = append(list, "carbolicacid")
+        }
+        list = append(list, d)
+    }
+    if len(list) == len(saved)+1 {
+        t.Fatalf("directive %q not found", anchor)
+    }
+
+    dnsserver.Directives = list
+    t.Cleanup(func() { dnsserver.Directives = saved })
+}
+
+// startCoreDNS: 由 Corefile 字符串启动 CoreDNS，返回第一个服务器的 UDP / TCP 地址
+func startCoreDNS(t *testing.T, corefile string) (udp, tcp string) {
+    t.Helper()
+    caddy.Quiet = true
+    dnsserver.Quiet = true
+
+    inst, err := caddy.Start(caddy.CaddyfileInput{Contents: []byte(corefile), Filepath: "Corefile", ServerTypeName: "dns"})
+    if err != nil {
+        t.Fatalf("start CoreDNS: %v", err)
+    }
+    t.Cleanup(func() { inst.Stop() })
+
+    srvs := inst.Servers()
+    if len(srvs) == 0 || srvs[0].LocalAddr() == nil || srvs[0].Addr() == nil {
+        t.Fatal("CoreDNS has no listeners")
+    }
+    return srvs[0].LocalAddr().String(), srvs[0].Addr().String()
+}
+
+// query: 以 network（udp / tcp）发送一次 A 查询；drop 时返回超时错误
+func query(t *testing.T, network, addr, name string) (*dns.Msg, error) {
+    t.Helper()
+    c := &dns.Client{Net: network, Timeout: 500 * time.Millisecond}
+    m := new(dns.Msg)
+    m.SetQuestion(name, dns.TypeA)
+    r, _, err := c.Exchange(m, addr)
+    return r, err
+}
+
+// exchangeTCP: 在一条 TCP 连接上发送 r，解码服务器在这条连接上写出的全部报文（直到读超时或连接关闭）
+//
+// 用于断言客户端只收到一个应答：插件返回 ClientWrite 为 false 的 rcode 时，服务器会再写一个 SERVFAIL。
+func exchangeTCP(t *testing.T, addr string, r *dns.Msg) []*dns.Msg {
+    t.Helper()
+    co, err := dns.Dial("tcp", addr)
+    if err != nil {
+        t.Fatalf("dial %s: %v", addr, err)
+    }
+    defer co.Close()
+    if err := co.WriteMsg(r); err != nil {
+        t.Fatalf("write query: %v", err)
+    }
+
+    var out []*dns.Msg
+    buf := make([]byte, dns.MaxMsgSize)
+    for {
+        co.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+        n, err := co.Read(buf)
+        if err != nil {
+            return out // 超时或服务器关闭连接
+        }
+        m := new(dns.Msg)
+        if err := m.Unpack(buf[:n]); err != nil {
+            t.Fatalf("message %d on the connection cannot be decoded: %v", len(out)+1, err)
+        }
+        out = append(out, m)
+    }
+}
+
+func mustQuery(t *testing.T, network, addr, name string) *dns.Msg {
+    t.Helper()
+    r, err := query(t, network, addr, name)
+    if err != nil {
+        t.Fatalf("%s query %s: %v", network, name, err)
+    }
+    return r
+}
+
+var integrationAnswers = map[string][]string{
+    "poisoned.example.": {"poisoned.example. 300 IN A 127.0.0.1"},
+    "mixed.example.":    {"mixed.example. 300 IN A 93.184.216.34", "mixed.example. 300 IN A 10.1.2.3"},
+    "clean.example.":    {"clean.example. 300 IN A 93.184.216.34"},
+    "excluded.example.": {"excluded.example. 300 IN A 10.8.0.1"},
+}
+
+// integrationCorefile: extra 为额外写入 carbolicacid block 的指令行
+func integrationCorefile(upstream, action string, withCache bool, extra ...string) string {
+    cache := ""
+    if withCache {
+        cache = "    cache 300\n"
+    }
+    directives := ""
+    for _, d := range extra {
+        directives += "        " + d + "\n"
+    }
+    return ".:0 {\n" +
+        "    serialize\n" +
+        "    carbolicacid {\n" +
+        "        preset iana {\n" +
+        "            exclude 10.8.0.0/16\n" +
+        "        }\n" +
+        "        responses " + action + "\n" +
+        "        negative_ttl 60\n" +
+        directives +
+        "    }\n" +
+        cache +
+        "    forward . " + upstream + "\n" +
+        "}\n"
+}
+
+func skipIntegration(t *testing.T) {
+    if testing.Short() {
+        t.Skip("starts CoreDNS servers")
+    }
+}
+
+func TestIntegrationUDPAndTCP(t *testing.T) {
+    skipIntegration(t)
+    placeDirective(t, "forward", false)
+    up := newScriptedUpstream(t, integrationAnswers)
+    udp, tcp := startCoreDNS(t, integrationCorefile(up.addr, "nxdomain", false))
+
+    for _, c := range []struct {
+        network, addr string
+    }{{"udp", udp}, {"tcp", tcp}} {
+        for _, tc := range []struct {
+            name    string
+            rcode   int
+            answers int
+        }{
+            {"poisoned.example.", dns.RcodeNameError, 0},
+            {"mixed.example.", dns.RcodeNameError, 0}, // 一条记录中毒，整报文阻断
+            {"clean.example.", dns.RcodeSuccess, 1},
+            {"excluded.example.", dns.RcodeSuccess, 1},
+        } {
+            r := mustQuery(t, c.network, c.addr, tc.name)
+            if r.Rcode != tc.rcode || len(r.Answer) != tc.answers {
+                t.Errorf("%s %s: rcode %s with %d answers, want %s with %d",
+                    c.network, tc.name, dns.RcodeToString[r.Rcode], len(r.Answer), dns.RcodeToString[tc.rcode], tc.answers)
+            }
+            if tc.rcode == dns.RcodeNameError && (len(r.Ns) != 1 || r.Ns[0].Header().Rrtype != dns.TypeSOA) {
+                t.Errorf("%s %s: expected an SOA in the authority section, got %v", c.network, tc.name, r.Ns)
+            }
+        }
+    }
+}
+
+func TestIntegrationDropAnswersNothing(t *testing.T) {
+    skipIntegration(t)
+    placeDirective(t, "forward", false)
+    up := newScriptedUpstream(t, integrationAnswers)
+    udp, tcp := startCoreDNS(t, integrationCorefile(up.addr, "drop", false))
+
+    for _, addr := range []struct{ network, addr string }{{"udp", udp}, {"tcp", tcp}} {
+        if r, err := query(t, addr.network, addr.addr, "poisoned.example."); err == nil {
+            t.Errorf("%s: expected no reply, got %v", addr.network, r)
+        }
+        if r := mustQuery(t, addr.network, addr.addr, "clean.example."); len(r.Answer) != 1 {
+            t.Errorf("%s: clean answer not passed through: %v", addr.network, r)
+        }
+    }
+}
+
+// carbolicacid 在 cache 之后（先于 cache 看到上游响应）：中毒的上游应答不会进入缓存，
+// 缓存的是 carbolicacid 实际写出的应答。
+func TestIntegrationAfterCache(t *testing.T) {
+    skipIntegration(t)
+    placeDirective(t, "cache", true)
+
+    t.Run("nxdomain", func(t *testing.T) {
+        up := newScriptedUpstream(t, integrationAnswers)
+        udp, _ := startCoreDNS(t, integrationCorefile(up.addr, "nxdomain", true))
+
+        for i := 0; i < 3; i++ {
+            if r := mustQuery(t, "udp", udp, "poisoned.example."); r.Rcode != dns.RcodeNameError {
+                t.Fatalf("query %d: expected NXDOMAIN, got %v", i, r)
+            }
+        }
+        // 合成的 NXDOMAIN 带 SOA，按负缓存保存，重复查询不再到上游
+        if n := up.count("poisoned.example."); n != 1 {
+            t.Fatalf("expected 1 upstream query, got %d", n)
+        }
+    })
+
+    t.Run("drop", func(t *testing.T) {
+        up := newScriptedUpstream(t, integrationAnswers)
+        udp, _ := startCoreDNS(t, integrationCorefile(up.addr, "drop", true))
+
+        for i := 0; i < 2; i++ {
+            if _, err := query(t, "udp", udp, "poisoned.example."); err == nil {
+                t.Fatalf("query %d: expected no reply", i)
+            }
+        }
+        // drop 不写出任何应答，缓存中没有条目，每次都到上游
+        if n := up.count("poisoned.example."); n != 2 {
+            t.Fatalf("expected 2 upstream queries, got %d", n)
+        }
+
+        mustQuery(t, "udp", udp, "clean.example.")
+        mustQuery(t, "udp", udp, "clean.example.")
+        if n := up.count("clean.example."); n != 1 {
+            t.Fatalf("expected clean answer to be cached, got %d upstream queries", n)
+        }
+    })
+}
+
+// cache_blocked：drop 不写出应答、cache 没有可保存的内容，由 carbolicacid 保存被阻断的判定
+func TestIntegrationCacheBlocked(t *testing.T) {
+    skipIntegration(t)
+    placeDirective(t, "cache", true)
+    up := newScriptedUpstream(t, integrationAnswers)
+    udp, tcp := startCoreDNS(t, integrationCorefile(up.addr, "drop", true, "cache_blocked 100"))
+
+    for i, network := range []string{"udp", "tcp", "udp"} {
+        addr := udp
+        if network == "tcp" {
+            addr = tcp
+        }
+        if _, err := query(t, network, addr, "poisoned.example."); err == nil {
+            t.Fatalf("query %d: expected no reply", i)
+        }
+    }
+    if n := up.count("poisoned.example."); n != 1 {
+        t.Fatalf("expected 1 upstream query, got %d", n)
+    }
+}
+
+// order_check fail：carbolicacid 在 cache 之前时拒绝启动
+func TestIntegrationOrderCheck(t *testing.T) {
+    skipIntegration(t)
+    placeDirective(t, "cache", false)
+    up := newScriptedUpstream(t, integrationAnswers)
+    caddy.Quiet = true
+    dnsserver.Quiet = true
+
+    corefile := integrationCorefile(up.addr, "nxdomain", true, "order_check fail")
+    inst, err := caddy.Start(caddy.CaddyfileInput{Contents: []byte(corefile), Filepath: "Corefile", ServerTypeName: "dns"})
+    if err == nil {
+        inst.Stop()
+        t.Fatal("expected CoreDNS to refuse to start")
+    }
+    if !strings.Contains(err.Error(), ErrPluginOrder.Error()) || !strings.Contains(err.Error(), "before cache") {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    // 没有启用 cache 时不受影响
+    startCoreDNS(t, integrationCorefile(up.addr, "nxdomain", false, "order_check fail"))
+}
+
+// carbolicacid 在 cache 之前（cache 先看到上游响应）：缓存保存的是未经过滤的上游应答，
+// 客户端仍然被拦截，因为每次命中缓存的应答都会再经过 carbolicacid。
+func TestIntegrationBeforeCache(t *testing.T) {
+    skipIntegration(t)
+    placeDirective(t, "cache", false)
+    up := newScriptedUpstream(t, integrationAnswers)
+    udp, tcp := startCoreDNS(t, integrationCorefile(up.addr, "nxdomain", true))
+
+    if r := mustQuery(t, "udp", udp, "poisoned.example."); r.Rcode != dns.RcodeNameError {
+        t.Fatalf("expected NXDOMAIN, got %v", r)
+    }
+    if r := mustQuery(t, "tcp", tcp, "poisoned.example."); r.Rcode != dns.RcodeNameError {
+        t.Fatalf("expected NXDOMAIN from the cached answer, got %v", r)
+    }
+    if n := up.count("poisoned.example."); n != 1 {
+        t.Fatalf("expected the unfiltered answer to be cached, got %d upstream queries", n)
+    }
+}
+
+// carbolicacid 在 forward 之后：forward 直接应答，carbolicacid 永远不会被调用
+func TestIntegrationAfterForward(t *testing.T) {
+    skipIntegration(t)
+    placeDirective(t, "forward", true)
+    up := newScriptedUpstream(t, integrationAnswers)
+    udp, _ := startCoreDNS(t, integrationCorefile(up.addr, "nxdomain", false))
+
+    r := mustQuery(t, "udp", udp, "poisoned.example.")
+    if r.Rcode != dns.RcodeSuccess || len(r.Answer) != 1 {
+        t.Fatalf("expected the poisoned answer to pass through unfiltered, got %v", r)
+    }
+}
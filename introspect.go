@@ -0,0 +1,183 @@
+package carbolicacid
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net"
+    "net/http"
+    "net/netip"
+    "sync"
+
+    "github.com/coredns/coredns/plugin/pkg/log"
+    "github.com/coredns/coredns/plugin/pkg/reuseport"
+)
+
+const defaultIntrospectAddr = "127.0.0.1:9154"
+
+// Introspect: 只读的 HTTP 调试接口，查询当前生效的策略
+//
+//    GET /carbolicacid/lookup?ip=ADDR   单个地址命中哪张表、哪条规则，以及会执行的动作
+//    GET /carbolicacid/rules            规范化后的 blockList / allowList
+//    GET /carbolicacid/status           Status
+//
+// 只允许监听环回地址；接口不做认证，暴露的是完整的拦截策略。
+type Introspect struct {
+    Addr string
+
+    mu sync.Mutex
+    ln net.Listener
+}
+
+// checkIntrospectAddr: 地址必须是 HOST:PORT，HOST 为 localhost 或环回 IP
+func checkIntrospectAddr(addr string) error {
+    host, _, err := net.SplitHostPort(addr)
+    if err != nil {
+        return err
+    }
+    if host == "localhost" {
+        return nil
+    }
+    if a, err := netip.ParseAddr(host); err == nil && a.IsLoopback() {
+        return nil
+    }
+    return fmt.Errorf("introspect must listen on a loopback address, got %q", addr)
+}
+
+// start: 开始监听（OnStartup）
+//
+// 与 ready 插件一样使用 reuseport，reload 时新旧实例可以短暂同时监听。
+func (i *Introspect) start(ca *CarbolicAcid) error {
+    ln, err := reuseport.Listen("tcp", i.Addr)
+    if err != nil {
+        return err
+    }
+    i.mu.Lock()
+    i.ln = ln
+    i.mu.Unlock()
+
+    go func() {
+        if err := http.Serve(ln, ca.introspectMux()); err != nil && !errors.Is(err, net.ErrClosed) {
+            log.Errorf("[carbolicacid] introspect: %v", err)
+        }
+    }()
+    return nil
+}
+
+// stop: 关闭监听（OnShutdown）
+func (i *Introspect) stop() error {
+    i.mu.Lock()
+    defer i.mu.Unlock()
+    if i.ln == nil {
+        return nil
+    }
+    err := i.ln.Close()
+    i.ln = nil
+    return err
+}
+
+func (c *CarbolicAcid) introspectMux() *http.ServeMux {
+    mux := http.NewServeMux()
+    mux.HandleFunc("/carbolicacid/lookup", c.serveLookup)
+    mux.HandleFunc("/carbolicacid/rules", c.serveRules)
+    mux.HandleFunc("/carbolicacid/status", func(w http.ResponseWriter, r *http.Request) {
+        writeJSON(w, http.StatusOK, c.Status())
+    })
+    return mux
+}
+
+// ruleJSON: 表中的一条前缀及其来源
+type ruleJSON struct {
+    CIDR string `json:"cidr"`
+    Node string `json:"node"` // 贡献该前缀的 preset/block 节点
+    Rule string `json:"rule"` // Rule.String()，与日志和指标中的 rule 一致
+}
+
+func newRuleJSON(r *Rule) *ruleJSON {
+    if r == nil {
+        return nil
+    }
+    return &ruleJSON{CIDR: r.CIDR, Node: r.Node.String(), Rule: r.String()}
+}
+
+// lookupJSON: /carbolicacid/lookup 的应答
+type lookupJSON struct {
+    IP        string    `json:"ip"`
+    BlockList *ruleJSON `json:"blockList"` // 各表中命中的规则，未命中为 null
+    AllowList *ruleJSON `json:"allowList"`
+    Blocked   bool      `json:"blocked"`
+    Action    string    `json:"action"` // 响应只含该地址时执行的动作，未阻断为 "pass"
+    Rule      string    `json:"rule,omitempty"`
+}
+
+func (c *CarbolicAcid) serveLookup(w http.ResponseWriter, r *http.Request) {
+    p := c.Policy()
+    if p == nil {
+        writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": c.Status().LastError})
+        return
+    }
+    a, err := netip.ParseAddr(r.URL.Query().Get("ip"))
+    if err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": "ip: " + err.Error()})
+        return
+    }
+    a = a.WithZone("")
+
+    res := lookupJSON{
+        IP:        a.String(),
+        BlockList: newRuleJSON(p.lookupAddr(p.blockList, a)),
+        AllowList: newRuleJSON(p.lookupAddr(p.allowList, a)),
+        Action:    ActionPass.String(),
+    }
+    blocked, rule := p.MatchAddr(a)
+    if blocked {
+        res.Blocked = true
+        res.Action = p.Action.String()
+    }
+    res.Rule = rule.String()
+    writeJSON(w, http.StatusOK, res)
+}
+
+// rulesJSON: /carbolicacid/rules 的应答
+type rulesJSON struct {
+    Action       string     `json:"action"`
+    AllIP        bool       `json:"allip"`
+    EmbeddedIPv4 bool       `json:"embeddedIPv4"`
+    Digest       string     `json:"digest"`
+    BlockList    []ruleJSON `json:"blockList"`
+    AllowList    []ruleJSON `json:"allowList"`
+}
+
+func (c *CarbolicAcid) serveRules(w http.ResponseWriter, r *http.Request) {
+    p := c.Policy()
+    if p == nil {
+        writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": c.Status().LastError})
+        return
+    }
+    writeJSON(w, http.StatusOK, rulesJSON{
+        Action:       p.Action.String(),
+        AllIP:        p.allIP,
+        EmbeddedIPv4: p.embed != nil,
+        Digest:       policyDigest(p.Action, p.Blocks),
+        BlockList:    tableJSON(p.blockList),
+        AllowList:    tableJSON(p.allowList),
+    })
+}
+
+// tableJSON: 表中所有前缀，顺序同 IPSet.sorted
+func tableJSON(s *IPSet) []ruleJSON {
+    rules := s.sorted()
+    list := make([]ruleJSON, len(rules))
+    for i, r := range rules {
+        list[i] = *newRuleJSON(r)
+    }
+    return list
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(code)
+    enc := json.NewEncoder(w)
+    enc.SetIndent("", "  ")
+    enc.Encode(v)
+}
@@ -0,0 +1,152 @@
+package carbolicacid
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/coredns/caddy"
+)
+
+func introspectGet(t *testing.T, ca *CarbolicAcid, url string, v interface{}) int {
+    t.Helper()
+    rec := httptest.NewRecorder()
+    ca.introspectMux().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+    if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+        t.Fatalf("%s: invalid JSON %q: %v", url, rec.Body.String(), err)
+    }
+    return rec.Code
+}
+
+func introspectServer() *CarbolicAcid {
+    return &CarbolicAcid{cfg: &Config{
+        Action: ActionNxdomain,
+        Blocks: []*BlockNode{
+            {Kind: RuleInclude, Value: "10.0.0.0/8", Excl: []string{"10.1.0.0/16"}},
+            {Kind: RulePreset, Value: "iana"},
+        },
+    }}
+}
+
+func TestIntrospectLookup(t *testing.T) {
+    ca := introspectServer()
+
+    tests := []struct {
+        ip      string
+        block   string // 命中的 blockList 规则，"" 表示未命中
+        allow   string
+        blocked bool
+        action  string
+    }{
+        {"10.2.3.4", "block 10.0.0.0/8", "", true, "nxdomain"},
+        {"10.1.2.3", "block 10.0.0.0/8", "block 10.0.0.0/8 exclude 10.1.0.0/16", false, "pass"},
+        {"::ffff:127.0.0.1", "preset iana ::ffff:0:0/96", "", true, "nxdomain"}, // 按 AAAA 记录判定
+        {"2001:db8::1", "preset iana 2001:db8::/32", "", true, "nxdomain"},
+        {"93.184.216.34", "", "", false, "pass"},
+    }
+    for _, tt := range tests {
+        var res lookupJSON
+        if code := introspectGet(t, ca, "/carbolicacid/lookup?ip="+tt.ip, &res); code != http.StatusOK {
+            t.Fatalf("%s: status %d", tt.ip, code)
+        }
+        var block, allow string
+        if res.BlockList != nil {
+            block = res.BlockList.Rule
+        }
+        if res.AllowList != nil {
+            allow = res.AllowList.Rule
+        }
+        if block != tt.block || allow != tt.allow || res.Blocked != tt.blocked || res.Action != tt.action {
+            t.Errorf("%s: got %+v (block %q, allow %q)", tt.ip, res, block, allow)
+        }
+    }
+
+    var e map[string]string
+    if code := introspectGet(t, ca, "/carbolicacid/lookup?ip=example.com", &e); code != http.StatusBadRequest || e["error"] == "" {
+        t.Fatalf("expected 400 with error, got %d %v", code, e)
+    }
+}
+
+func TestIntrospectRules(t *testing.T) {
+    var res rulesJSON
+    if code := introspectGet(t, introspectServer(), "/carbolicacid/rules", &res); code != http.StatusOK {
+        t.Fatalf("status %d", code)
+    }
+    if res.Action != "nxdomain" || res.AllIP {
+        t.Fatalf("unexpected header: %+v", res)
+    }
+    if want := 1 + len(ianaPresetV4) + len(ianaPresetV6); len(res.BlockList) != want {
+        t.Fatalf("expected %d blockList entries, got %d", want, len(res.BlockList))
+    }
+
+    // 按地址排序：0.0.0.0/8 在前；10.0.0.0/8 来自 block 而非 preset
+    if res.BlockList[0].CIDR != "0.0.0.0/8" {
+        t.Fatalf("blockList not sorted: %+v", res.BlockList[:2])
+    }
+    if res.BlockList[1].CIDR != "10.0.0.0/8" || res.BlockList[1].Node != "block 10.0.0.0/8" {
+        t.Fatalf("unexpected second entry: %+v", res.BlockList[1])
+    }
+    if len(res.AllowList) != 1 || res.AllowList[0].CIDR != "10.1.0.0/16" {
+        t.Fatalf("unexpected allowList: %+v", res.AllowList)
+    }
+}
+
+func TestIntrospectInitFailure(t *testing.T) {
+    ca := &CarbolicAcid{cfg: &Config{Action: ActionDrop}}
+
+    var e map[string]string
+    if code := introspectGet(t, ca, "/carbolicacid/rules", &e); code != http.StatusServiceUnavailable || e["error"] == "" {
+        t.Fatalf("expected 503 with error, got %d %v", code, e)
+    }
+    var s Status
+    if introspectGet(t, ca, "/carbolicacid/status", &s); s.Ready || s.LastError == "" {
+        t.Fatalf("unexpected status: %+v", s)
+    }
+}
+
+func TestIntrospectListen(t *testing.T) {
+    ca := introspectServer()
+    i := &Introspect{Addr: "127.0.0.1:0"}
+    if err := i.start(ca); err != nil {
+        t.Fatal(err)
+    }
+    defer i.stop()
+
+    resp, err := http.Get("http://" + i.ln.Addr().String() + "/carbolicacid/lookup?ip=10.2.3.4")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer resp.Body.Close()
+    var res lookupJSON
+    if err := json.NewDecoder(resp.Body).Decode(&res); err != nil || !res.Blocked {
+        t.Fatalf("unexpected response: %+v, %v", res, err)
+    }
+}
+
+func TestParseConfigIntrospect(t *testing.T) {
+    c := caddy.NewTestController("dns", `carbolicacid {
+        preset iana
+        introspect
+    }`)
+    cfg, err := parseConfig(c)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if cfg.Introspect == nil || cfg.Introspect.Addr != defaultIntrospectAddr {
+        t.Fatalf("unexpected introspect: %+v", cfg.Introspect)
+    }
+
+    for _, addr := range []string{"127.0.0.2:8080", "[::1]:8080", "localhost:8080"} {
+        c := caddy.NewTestController("dns", "carbolicacid {\npreset iana\nintrospect "+addr+"\n}")
+        if _, err := parseConfig(c); err != nil {
+            t.Errorf("%s: unexpected error: %v", addr, err)
+        }
+    }
+    for _, addr := range []string{"0.0.0.0:8080", ":8080", "192.0.2.1:8080", "127.0.0.1"} {
+        c := caddy.NewTestController("dns", "carbolicacid {\npreset iana\nintrospect "+addr+"\n}")
+        if _, err := parseConfig(c); err == nil {
+            t.Errorf("%s: expected error", addr)
+        }
+    }
+}
@@ -0,0 +1,172 @@
+package carbolicacid
+
+import (
+    "strconv"
+    "strings"
+
+    "github.com/coredns/coredns/plugin"
+    "github.com/miekg/dns"
+)
+
+// RFC 6303 §3 建议的本地区 SOA 参数
+const (
+    localZoneTTL     = 10800
+    localZoneMbox    = "nobody.invalid."
+    localZoneRefresh = 604800
+    localZoneRetry   = 86400
+    localZoneExpire  = 2419200
+)
+
+// buildLocalZones: 由 RFC 6303 前缀表生成反向区名
+func buildLocalZones() (plugin.Zones, error) {
+    var list []string
+    list = append(list, rfc6303PresetV4...)
+    list = append(list, rfc6303PresetV6...)
+
+    cs, err := parseCIDRs(list)
+    if err != nil {
+        return nil, err
+    }
+    zones := reverseZones(cs)
+    plugin.Zones(zones).Normalize()
+    return zones, nil
+}
+
+// reverseZones: CIDRSet → 反向区名
+//
+// IPv4 按 8 bit、IPv6 按 4 bit 对齐；不对齐的前缀展开为多个区，
+// 例如 172.16.0.0/12 → 16.172.in-addr.arpa. … 31.172.in-addr.arpa.
+func reverseZones(cs *CIDRSet) []string {
+    var out []string
+
+    for _, c := range cs.v4 {
+        p := 32 - int(c.shift)
+        if p <= 0 {
+            continue // 不生成 in-addr.arpa. 本身
+        }
+        aligned := (p + 7) / 8 * 8
+        base := c.shifted << c.shift
+        for i := uint32(0); i < 1<<(aligned-p); i++ {
+            v := base | i<<(32-aligned)
+            out = append(out, reverseV4(v, aligned/8))
+        }
+    }
+
+    for _, c := range cs.v6 {
+        p := int(c.prefix)
+        if p <= 0 {
+            continue
+        }
+        aligned := (p + 3) / 4 * 4
+        hi, lo := cidrV6Start(c)
+        for i := uint64(0); i < 1<<(aligned-p); i++ {
+            h, l := hi, lo
+            if aligned <= 64 {
+                h |= i << (64 - aligned)
+            } else {
+                l |= i << (128 - aligned)
+            }
+            out = append(out, reverseV6(h, l, aligned/4))
+        }
+    }
+
+    return out
+}
+
+// cidrV6Start: IPv6CIDR 的起始地址
+func cidrV6Start(c IPv6CIDR) (hi, lo uint64) {
+    p := c.prefix
+    switch {
+    case p == 0:
+        return 0, 0
+    case p <= 64:
+        return c.shiftedHi << (64 - p), 0
+    case p >= 128:
+        return c.shiftedHi, c.shiftedLo
+    default:
+        return c.shiftedHi, c.shiftedLo << (128 - p)
+    }
+}
+
+// reverseV4: 前 n 个字节 → "c.b.a.in-addr.arpa."
+func reverseV4(v uint32, n int) string {
+    var sb strings.Builder
+    for i := n - 1; i >= 0; i-- {
+        sb.WriteString(strconv.Itoa(int(v >> (24 - 8*i) & 0xff)))
+        sb.WriteByte('.')
+    }
+    sb.WriteString("in-addr.arpa.")
+    return sb.String()
+}
+
+// reverseV6: 前 n 个 nibble → "x.y.z.ip6.arpa."
+func reverseV6(hi, lo uint64, n int) string {
+    const hex = "0123456789abcdef"
+    var sb strings.Builder
+    for i := n - 1; i >= 0; i-- {
+        var nib uint64
+        if i < 16 {
+            nib = hi >> (60 - 4*i) & 0xf
+        } else {
+            nib = lo >> (60 - 4*(i-16)) & 0xf
+        }
+        sb.WriteByte(hex[nib])
+        sb.WriteByte('.')
+    }
+    sb.WriteString("ip6.arpa.")
+    return sb.String()
+}
+
+// localZoneAnswer: 查询名落在本地反向区时，生成权威应答；否则返回 nil
+//
+// - 区顶点 SOA/NS 查询 → 返回对应记录
+// - 区顶点其他类型 → NODATA + SOA
+// - 区内其他名称 → NXDOMAIN + SOA
+func localZoneAnswer(zones plugin.Zones, r *dns.Msg) *dns.Msg {
+    if len(zones) == 0 || r == nil || len(r.Question) == 0 {
+        return nil
+    }
+    q := r.Question[0]
+    if q.Qclass != dns.ClassINET {
+        return nil
+    }
+
+    name := strings.ToLower(q.Name)
+    zone := zones.Matches(name)
+    if zone == "" {
+        return nil
+    }
+
+    m := synthReply(r, dns.RcodeSuccess)
+    m.Authoritative = true
+
+    soa := &dns.SOA{
+        Hdr:     dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: localZoneTTL},
+        Ns:      zone,
+        Mbox:    localZoneMbox,
+        Serial:  1,
+        Refresh: localZoneRefresh,
+        Retry:   localZoneRetry,
+        Expire:  localZoneExpire,
+        Minttl:  localZoneTTL,
+    }
+
+    if name != zone {
+        m.Rcode = dns.RcodeNameError
+        m.Ns = []dns.RR{soa}
+        return m
+    }
+
+    switch q.Qtype {
+    case dns.TypeSOA:
+        m.Answer = []dns.RR{soa}
+    case dns.TypeNS:
+        m.Answer = []dns.RR{&dns.NS{
+            Hdr: dns.RR_Header{Name: zone, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: localZoneTTL},
+            Ns:  zone,
+        }}
+    default:
+        m.Ns = []dns.RR{soa}
+    }
+    return m
+}
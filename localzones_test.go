@@ -0,0 +1,96 @@
+package carbolicacid
+
+import (
+    "context"
+    "fmt"
+    "sort"
+    "testing"
+
+    "github.com/miekg/dns"
+)
+
+func TestReverseZones(t *testing.T) {
+    cs, err := parseCIDRs([]string{"172.16.0.0/12", "fe80::/10", "::1/128", "10.0.0.0/8"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    got := reverseZones(cs)
+    sort.Strings(got)
+
+    want := []string{
+        "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.ip6.arpa.",
+        "10.in-addr.arpa.",
+        "8.e.f.ip6.arpa.",
+        "9.e.f.ip6.arpa.",
+        "a.e.f.ip6.arpa.",
+        "b.e.f.ip6.arpa.",
+    }
+    for i := 16; i <= 31; i++ {
+        want = append(want, fmt.Sprintf("%d.172.in-addr.arpa.", i))
+    }
+    sort.Strings(want)
+
+    if len(got) != len(want) {
+        t.Fatalf("expected %d zones, got %d: %v", len(want), len(got), got)
+    }
+    for i := range want {
+        if got[i] != want[i] {
+            t.Fatalf("zone %d: expected %s, got %s", i, want[i], got[i])
+        }
+    }
+}
+
+func TestLocalZoneAnswer(t *testing.T) {
+    cfg := &Config{
+        Blocks: []*BlockNode{
+            {Kind: RulePreset, Value: "none"},
+        },
+        LocalZones: true,
+    }
+
+    tests := []struct {
+        qname  string
+        qtype  uint16
+        rcode  int
+        answer int
+        local  bool
+    }{
+        {"1.0.168.192.in-addr.arpa.", dns.TypePTR, dns.RcodeNameError, 0, true},
+        {"168.192.in-addr.arpa.", dns.TypeSOA, dns.RcodeSuccess, 1, true},
+        {"168.192.in-addr.arpa.", dns.TypeNS, dns.RcodeSuccess, 1, true},
+        {"168.192.in-addr.arpa.", dns.TypePTR, dns.RcodeSuccess, 0, true},
+        {"8.8.8.8.in-addr.arpa.", dns.TypePTR, dns.RcodeSuccess, 0, false},
+    }
+
+    for _, tc := range tests {
+        next := &countingNext{testNext: testNext{resp: new(dns.Msg)}}
+        ca := &CarbolicAcid{Next: next, cfg: cfg}
+
+        r := new(dns.Msg)
+        r.SetQuestion(tc.qname, tc.qtype)
+
+        rw := &testResponseWriter{}
+        if _, err := ca.ServeDNS(context.Background(), rw, r); err != nil {
+            t.Fatalf("%s: ServeDNS error: %v", tc.qname, err)
+        }
+
+        if !tc.local {
+            if next.calls != 1 {
+                t.Errorf("%s: expected query to be forwarded", tc.qname)
+            }
+            continue
+        }
+        if next.calls != 0 {
+            t.Errorf("%s: local zone query must not reach upstream", tc.qname)
+        }
+        m := rw.msg
+        if m == nil || !m.Authoritative || m.Rcode != tc.rcode || len(m.Answer) != tc.answer {
+            t.Fatalf("%s/%d: unexpected reply %v", tc.qname, tc.qtype, m)
+        }
+        if tc.answer == 0 {
+            if len(m.Ns) != 1 || m.Ns[0].Header().Rrtype != dns.TypeSOA {
+                t.Errorf("%s: expected SOA in authority section", tc.qname)
+            }
+        }
+    }
+}
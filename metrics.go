@@ -0,0 +1,144 @@
+package carbolicacid
+
+import (
+    "github.com/coredns/coredns/plugin"
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+    // blockedCount: 命中并执行动作的响应数
+    blockedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+        Namespace: plugin.Namespace,
+        Subsystem: "carbolicacid",
+        Name:      "blocked_responses_total",
+        Help:      "Counter of responses matched by the enforced policy, by action and rule.",
+    }, []string{"server", "action", "rule"})
+
+    // droppedCount: drop 动作按传输协议统计
+    droppedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+        Namespace: plugin.Namespace,
+        Subsystem: "carbolicacid",
+        Name:      "dropped_total",
+        Help:      "Counter of dropped replies, by transport protocol.",
+    }, []string{"server", "proto"})
+
+    // queryBlockedCount: 查询侧（PTR）命中并执行动作的查询数
+    queryBlockedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+        Namespace: plugin.Namespace,
+        Subsystem: "carbolicacid",
+        Name:      "blocked_queries_total",
+        Help:      "Counter of PTR queries for blocked addresses stopped before reaching upstream, by action and rule.",
+    }, []string{"server", "action", "rule"})
+
+    // localZoneCount: RFC 6303 本地反向区直接应答的查询数
+    localZoneCount = promauto.NewCounterVec(prometheus.CounterOpts{
+        Namespace: plugin.Namespace,
+        Subsystem: "carbolicacid",
+        Name:      "local_zone_answers_total",
+        Help:      "Counter of queries answered locally for RFC 6303 reverse zones.",
+    }, []string{"server"})
+
+    // shadowCount: 影子策略的判定，与生效策略的判定并列记录
+    shadowCount = promauto.NewCounterVec(prometheus.CounterOpts{
+        Namespace: plugin.Namespace,
+        Subsystem: "carbolicacid",
+        Name:      "shadow_responses_total",
+        Help:      "Counter of responses evaluated by the shadow policy, by enforced action, shadow action and shadow rule.",
+    }, []string{"server", "enforced", "shadow", "rule"})
+
+    // quarantineCount: 隔离记录的投递结果（stored / dropped）
+    quarantineCount = promauto.NewCounterVec(prometheus.CounterOpts{
+        Namespace: plugin.Namespace,
+        Subsystem: "carbolicacid",
+        Name:      "quarantine_entries_total",
+        Help:      "Counter of intercepted responses handed to the quarantine store, by result.",
+    }, []string{"server", "result"})
+
+    // upstreamBlockedCount: 按上游统计被拦截的响应（需启用 upstreams）
+    upstreamBlockedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+        Namespace: plugin.Namespace,
+        Subsystem: "carbolicacid",
+        Name:      "upstream_blocked_responses_total",
+        Help:      "Counter of intercepted responses, by the forward upstream that returned them.",
+    }, []string{"server", "upstream"})
+
+    // upstreamUnhealthy: 上游是否因频繁返回被拦截的响应而标记为 unhealthy
+    upstreamUnhealthy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+        Namespace: plugin.Namespace,
+        Subsystem: "carbolicacid",
+        Name:      "upstream_unhealthy",
+        Help:      "Whether an upstream is marked unhealthy for returning too many intercepted responses (1 = unhealthy).",
+    }, []string{"server", "upstream"})
+
+    // retryCount: responses retry 的结果（answered / blocked / failed）
+    retryCount = promauto.NewCounterVec(prometheus.CounterOpts{
+        Namespace: plugin.Namespace,
+        Subsystem: "carbolicacid",
+        Name:      "retries_total",
+        Help:      "Counter of queries re-issued to the retry upstream, by result.",
+    }, []string{"server", "result"})
+
+    // verifyCount: 共识模式的确认结果（agree / differ / error），cache 为 hit / miss
+    verifyCount = promauto.NewCounterVec(prometheus.CounterOpts{
+        Namespace: plugin.Namespace,
+        Subsystem: "carbolicacid",
+        Name:      "verifications_total",
+        Help:      "Counter of matched responses checked against the trusted resolver, by result and cache use.",
+    }, []string{"server", "result", "cache"})
+
+    // verdictCacheCount: verdict_cache 的命中情况（hit / miss）
+    verdictCacheCount = promauto.NewCounterVec(prometheus.CounterOpts{
+        Namespace: plugin.Namespace,
+        Subsystem: "carbolicacid",
+        Name:      "verdict_cache_total",
+        Help:      "Counter of verdict cache lookups, by result.",
+    }, []string{"server", "result"})
+
+    // blockedCacheHits: 由 cache_blocked 保存的判定直接应答、未转发上游的查询数
+    blockedCacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
+        Namespace: plugin.Namespace,
+        Subsystem: "carbolicacid",
+        Name:      "blocked_cache_hits_total",
+        Help:      "Counter of queries answered from a stored blocked verdict without reaching upstream, by action and rule.",
+    }, []string{"server", "action", "rule"})
+
+    // readyGauge: 初始化是否成功（0 表示插件处于 bypass 状态）
+    readyGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+        Namespace: plugin.Namespace,
+        Subsystem: "carbolicacid",
+        Name:      "ready",
+        Help:      "Whether the block/allow tables are loaded and enforced (0 = initialization failed, bypassing everything).",
+    }, []string{"zone"})
+
+    // tableEntries: 匹配表的前缀条数
+    tableEntries = promauto.NewGaugeVec(prometheus.GaugeOpts{
+        Namespace: plugin.Namespace,
+        Subsystem: "carbolicacid",
+        Name:      "table_entries",
+        Help:      "Number of prefixes in the enforced tables, by table and address family.",
+    }, []string{"zone", "table", "family"})
+
+    // loadTimestamp / loadDuration: 最近一次初始化完成的时间与耗时
+    loadTimestamp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+        Namespace: plugin.Namespace,
+        Subsystem: "carbolicacid",
+        Name:      "load_timestamp_seconds",
+        Help:      "Unix time at which the enforced tables were built.",
+    }, []string{"zone"})
+
+    loadDuration = promauto.NewGaugeVec(prometheus.GaugeOpts{
+        Namespace: plugin.Namespace,
+        Subsystem: "carbolicacid",
+        Name:      "load_duration_seconds",
+        Help:      "Time taken to build the enforced tables.",
+    }, []string{"zone"})
+
+    // policyInfo: 生效策略的摘要，值恒为 1
+    policyInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+        Namespace: plugin.Namespace,
+        Subsystem: "carbolicacid",
+        Name:      "policy_info",
+        Help:      "Digest of the enforced policy (action and preset/block/exclude rules); always 1.",
+    }, []string{"zone", "digest"})
+)
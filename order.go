@@ -0,0 +1,79 @@
+package carbolicacid
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+
+    "github.com/coredns/coredns/plugin/pkg/log"
+)
+
+// OrderMode: 启动时发现插件顺序问题后的处理方式
+type OrderMode int
+
+const (
+    OrderWarn OrderMode = iota // 默认：记录警告，照常启动
+    OrderFail                  // 拒绝启动
+    OrderOff                   // 不检查
+)
+
+func (m OrderMode) String() string {
+    switch m {
+    case OrderWarn:
+        return "warn"
+    case OrderFail:
+        return "fail"
+    case OrderOff:
+        return "off"
+    default:
+        return "unknown"
+    }
+}
+
+// ErrPluginOrder: order_check fail 时 OnStartup 返回的错误，可用 errors.Is 判断
+var ErrPluginOrder = errors.New("carbolicacid: plugin order")
+
+// upstreamPlugins: 直接向上游转发并写出应答、不再调用后续插件的插件
+var upstreamPlugins = []string{"forward", "grpc"}
+
+// orderProblems: 按插件链顺序（plugin.cfg，即 dnsserver.Directives）检查 carbolicacid 的位置
+//
+// enabled 报告插件是否出现在同一个 server block 中。插件链中靠前的插件先处理查询、后看到响应：
+//
+//    - carbolicacid 在 cache 之前：cache 先看到上游响应，保存的是未经过滤的应答
+//    - carbolicacid 在 forward / grpc 之后：上游应答直接写回客户端，carbolicacid 永远不会被调用
+func orderProblems(directives []string, enabled func(string) bool) []string {
+    index := make(map[string]int, len(directives))
+    for i, d := range directives {
+        index[d] = i
+    }
+    self, ok := index["carbolicacid"]
+    if !ok {
+        return nil
+    }
+
+    var out []string
+    if i, ok := index["cache"]; ok && self < i && enabled("cache") {
+        out = append(out, "carbolicacid is listed before cache in plugin.cfg, so cache stores unfiltered upstream answers; list it after cache")
+    }
+    for _, name := range upstreamPlugins {
+        if i, ok := index[name]; ok && i < self && enabled(name) {
+            out = append(out, fmt.Sprintf("carbolicacid is listed after %s in plugin.cfg and never sees its answers; list it before %s", name, name))
+        }
+    }
+    return out
+}
+
+// checkOrder: 按 mode 处理 orderProblems 的结果；fail 时返回错误，使 CoreDNS 拒绝启动
+func checkOrder(mode OrderMode, zone string, problems []string) error {
+    if mode == OrderOff || len(problems) == 0 {
+        return nil
+    }
+    if mode == OrderFail {
+        return fmt.Errorf("%w in %s: %s", ErrPluginOrder, zone, strings.Join(problems, "; "))
+    }
+    for _, p := range problems {
+        log.Warningf("[carbolicacid] %s: %s", zone, p)
+    }
+    return nil
+}
@@ -0,0 +1,95 @@
+package carbolicacid
+
+import (
+    "errors"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/coredns/caddy"
+)
+
+func TestOrderProblems(t *testing.T) {
+    all := func(string) bool { return true }
+    tests := []struct {
+        directives []string
+        enabled    func(string) bool
+        want       []string // 每条问题应包含的片段
+    }{
+        {[]string{"cache", "carbolicacid", "forward"}, all, nil},
+        {[]string{"carbolicacid", "cache", "forward"}, all, []string{"before cache"}},
+        {[]string{"cache", "forward", "carbolicacid"}, all, []string{"after forward"}},
+        {[]string{"carbolicacid", "cache", "grpc", "forward"}, all, []string{"before cache"}},
+        {[]string{"forward", "carbolicacid", "cache"}, all, []string{"before cache", "after forward"}},
+        // 未在 server block 中启用的插件不参与检查
+        {[]string{"carbolicacid", "cache", "forward"}, func(n string) bool { return n != "cache" }, nil},
+        {[]string{"cache", "forward"}, all, nil},
+    }
+
+    for i, tc := range tests {
+        got := orderProblems(tc.directives, tc.enabled)
+        if len(got) != len(tc.want) {
+            t.Errorf("test %d: expected %d problems, got %q", i, len(tc.want), got)
+            continue
+        }
+        for j, w := range tc.want {
+            if !strings.Contains(got[j], w) {
+                t.Errorf("test %d: problem %q does not mention %q", i, got[j], w)
+            }
+        }
+    }
+}
+
+func TestCheckOrder(t *testing.T) {
+    problems := []string{"carbolicacid is listed before cache"}
+    if err := checkOrder(OrderWarn, "example.org.", problems); err != nil {
+        t.Fatalf("warn must not fail: %v", err)
+    }
+    if err := checkOrder(OrderOff, "example.org.", problems); err != nil {
+        t.Fatalf("off must not fail: %v", err)
+    }
+    if err := checkOrder(OrderFail, "example.org.", nil); err != nil {
+        t.Fatalf("fail without problems: %v", err)
+    }
+    err := checkOrder(OrderFail, "example.org.", problems)
+    if !errors.Is(err, ErrPluginOrder) || !strings.Contains(err.Error(), "example.org.") {
+        t.Fatalf("expected ErrPluginOrder naming the zone, got %v", err)
+    }
+}
+
+func TestParseConfigCacheCooperation(t *testing.T) {
+    cfg, err := parseConfig(caddy.NewTestController("dns", `carbolicacid {
+        preset iana
+        order_check fail
+        cache_blocked 1000 5m
+        responses servfail
+    }`))
+    if err != nil {
+        t.Fatalf("parseConfig failed: %v", err)
+    }
+    if cfg.OrderCheck != OrderFail || cfg.BlockedCache != 1000 || cfg.BlockedCacheTTL != 5*time.Minute {
+        t.Fatalf("unexpected config: %s %d %s", cfg.OrderCheck, cfg.BlockedCache, cfg.BlockedCacheTTL)
+    }
+
+    cfg, err = parseConfig(caddy.NewTestController("dns", "carbolicacid {\n    preset iana\n    cache_blocked 10\n}"))
+    if err != nil {
+        t.Fatalf("parseConfig failed: %v", err)
+    }
+    if cfg.OrderCheck != OrderWarn || cfg.BlockedCacheTTL != defaultBlockedCacheTTL {
+        t.Fatalf("unexpected defaults: %s %s", cfg.OrderCheck, cfg.BlockedCacheTTL)
+    }
+
+    for i, input := range []string{
+        "carbolicacid {\n    order_check strict\n}",
+        "carbolicacid {\n    order_check\n}",
+        "carbolicacid {\n    cache_blocked -1\n}",
+        "carbolicacid {\n    cache_blocked 10 0s\n}",
+        "carbolicacid {\n    cache_blocked 10 5m 1\n}",
+        "carbolicacid {\n    cache_blocked 10\n    responses bypass\n}",
+        "carbolicacid {\n    shadow {\n        cache_blocked 10\n    }\n}",
+    } {
+        if _, err := parseConfig(caddy.NewTestController("dns", input)); err == nil {
+            t.Errorf("test %d: expected error for input %s", i, input)
+        }
+    }
+}
@@ -0,0 +1,274 @@
+package carbolicacid
+
+import (
+    "net"
+    "net/netip"
+
+    "github.com/miekg/dns"
+)
+
+// Policy: 双表模型的可复用形式
+//
+// 与 ServeDNS 使用同一套匹配逻辑，供其他 CoreDNS 插件或离线分析工具直接调用，
+// 不需要经过插件链。Policy 构建完成后只读，可并发使用。
+type Policy struct {
+    Action ResponseAction
+    Blocks []*BlockNode
+
+    blockList *IPSet
+    allowList *IPSet
+
+    allIP     bool  // 是否使用 preset allip
+    allIPRule *Rule // allip 模式下的归因规则
+
+    embed *embeddedIPv4 // v0.3.5: AAAA 内嵌 IPv4 检查，nil 表示关闭
+
+    blocked  addrRanges // 生效的阻断地址空间（blockList − allowList），已合并
+    excluded addrRanges // allowList 合并后的地址空间
+}
+
+// MatchKind: 单条 A/AAAA 记录的判定
+type MatchKind int
+
+const (
+    MatchNone  MatchKind = iota // 未命中任何表
+    MatchAllow                  // 命中 allowList
+    MatchBlock                  // 命中 blockList
+)
+
+func (k MatchKind) String() string {
+    switch k {
+    case MatchAllow:
+        return "allow"
+    case MatchBlock:
+        return "block"
+    default:
+        return "none"
+    }
+}
+
+// RecordVerdict: 单条 A/AAAA 记录的判定结果
+type RecordVerdict struct {
+    RR    dns.RR
+    IP    net.IP
+    Match MatchKind
+    Rule  *Rule // Match == MatchNone 时为 nil
+}
+
+// Verdict: Policy.Evaluate 的结果
+type Verdict struct {
+    Records []RecordVerdict // 每条 A/AAAA 记录的判定，按 Answer 顺序
+    Rules   []*Rule         // 决定最终结果的规则（去重，按首次命中顺序）
+    Blocked bool
+    Action  ResponseAction // Blocked 时为配置的动作，否则为 ActionPass
+}
+
+// NewPolicy: 由 preset/block 节点构建 Policy
+func NewPolicy(blocks []*BlockNode, action ResponseAction) (*Policy, error) {
+    p := &Policy{
+        Action: action,
+        Blocks: blocks,
+    }
+    if err := p.build(); err != nil {
+        return nil, err
+    }
+    return p, nil
+}
+
+// Evaluate: 逐条记录给出判定，以及整报文的最终动作
+//
+// 规则与 ServeDNS 一致：
+//   1) 任一记录命中 allowList → 整报文放行
+//   2) preset allip → 其余情况全部阻断
+//   3) 任一记录命中 blockList → 阻断
+//   4) 否则放行
+func (p *Policy) Evaluate(m *dns.Msg) Verdict {
+    v := Verdict{Action: ActionPass}
+    if p == nil || m == nil {
+        return v
+    }
+
+    allowed := false
+    for _, rr := range m.Answer {
+        var ip net.IP
+        switch a := rr.(type) {
+        case *dns.A:
+            ip = a.A
+        case *dns.AAAA:
+            ip = a.AAAA
+        default:
+            continue
+        }
+
+        rv := RecordVerdict{RR: rr, IP: ip}
+        if r := p.lookupRR(p.allowList, rr); r != nil {
+            rv.Match, rv.Rule = MatchAllow, r
+            allowed = true
+        } else if r := p.lookupRR(p.blockList, rr); r != nil {
+            rv.Match, rv.Rule = MatchBlock, r
+        }
+        v.Records = append(v.Records, rv)
+    }
+
+    want := MatchBlock
+    switch {
+    case allowed:
+        want = MatchAllow
+    case p.allIP:
+        v.Blocked = true
+    default:
+        for _, rv := range v.Records {
+            if rv.Match == MatchBlock {
+                v.Blocked = true
+                break
+            }
+        }
+    }
+
+    for _, rv := range v.Records {
+        if rv.Match == want {
+            v.Rules = appendRule(v.Rules, rv.Rule)
+        }
+    }
+    if v.Blocked {
+        if len(v.Rules) == 0 {
+            v.Rules = appendRule(v.Rules, p.allIPRule)
+        }
+        v.Action = p.Action
+    }
+
+    return v
+}
+
+// MatchIP: 单个地址的判定，规则与 Evaluate 一致（allowList 优先）
+//
+// net.IP 无法区分 IPv4 与 IPv4-mapped：能转换为 4 字节的地址按 A 记录（IPv4）判定。
+func (p *Policy) MatchIP(ip net.IP) (bool, *Rule) {
+    if v4 := ip.To4(); v4 != nil {
+        ip = v4
+    }
+    a, ok := netip.AddrFromSlice(ip)
+    if !ok {
+        return false, nil
+    }
+    return p.MatchAddr(a)
+}
+
+// MatchAddr: MatchIP 的 netip 版本，不分配内存
+//
+// 与 Evaluate / ServeDNS 一致：IPv4 地址按 A 记录、IPv6 地址按 AAAA 记录判定。IPv4-mapped
+// 地址（::ffff:a.b.c.d）是 IPv6 地址，只有启用 embedded_ipv4 时才会再与 IPv4 表匹配。
+// 带 zone 的地址忽略 zone。
+func (p *Policy) MatchAddr(a netip.Addr) (bool, *Rule) {
+    if p == nil || !a.IsValid() {
+        return false, nil
+    }
+    if r := p.lookupAddr(p.allowList, a); r != nil {
+        return false, r
+    }
+    if p.allIP {
+        return true, p.allIPRule
+    }
+    if r := p.lookupAddr(p.blockList, a); r != nil {
+        return true, r
+    }
+    return false, nil
+}
+
+// Entries: blockList / allowList 中的全部前缀及其来源规则，IPv4 在前，按地址和前缀长度排序
+func (p *Policy) Entries() (block, allow []*Rule) {
+    if p == nil {
+        return nil, nil
+    }
+    return p.blockList.sorted(), p.allowList.sorted()
+}
+
+// decide: ServeDNS 热点路径使用，不分配内存
+//
+// 返回是否阻断，以及决定结果的第一条规则（放行时为命中的 allowList 规则，可能为 nil）。
+func (p *Policy) decide(m *dns.Msg) (bool, *Rule) {
+    // 1) allowList 优先（仅当 allowList 存在时）
+    if p.allowList != nil {
+        if r := p.firstMatch(p.allowList, m); r != nil {
+            return false, r
+        }
+    }
+
+    // 2) preset = allip → 全阻断模式，blockList 永远跳过
+    if p.allIP {
+        return true, p.allIPRule
+    }
+
+    // 3) 正常双表模型：blockList 命中 → 阻断
+    if r := p.firstMatch(p.blockList, m); r != nil {
+        return true, r
+    }
+
+    return false, nil
+}
+
+// EnableEmbeddedIPv4: 开启 AAAA 内嵌 IPv4 检查（NAT64 / IPv4-mapped / 6to4 / Teredo）
+//
+// 提取出的 IPv4 地址再与 IPv4 表匹配。nat64 为 well-known 之外额外识别的 NAT64 前缀。
+// 必须在 Policy 投入使用之前调用。
+func (p *Policy) EnableEmbeddedIPv4(nat64 []string) error {
+    e, err := newEmbeddedIPv4(nat64)
+    if err != nil {
+        return err
+    }
+    p.embed = e
+    return nil
+}
+
+// firstMatch: IPSet.FirstMatch 的 Policy 版本，考虑内嵌 IPv4
+func (p *Policy) firstMatch(s *IPSet, m *dns.Msg) *Rule {
+    if p.embed == nil {
+        return s.FirstMatch(m)
+    }
+    if s == nil || m == nil {
+        return nil
+    }
+    for _, rr := range m.Answer {
+        if r := p.lookupRR(s, rr); r != nil {
+            return r
+        }
+    }
+    return nil
+}
+
+// lookupRR: 先按原地址匹配，AAAA 未命中时再尝试内嵌的 IPv4
+func (p *Policy) lookupRR(s *IPSet, rr dns.RR) *Rule {
+    if r := s.lookupRR(rr); r != nil || p.embed == nil || s == nil {
+        return r
+    }
+    if a, ok := rr.(*dns.AAAA); ok {
+        if v, ok := p.embed.extract(a.AAAA); ok {
+            return s.lookupV4(v)
+        }
+    }
+    return nil
+}
+
+// lookupAddr: lookupRR 的单地址版本
+func (p *Policy) lookupAddr(s *IPSet, a netip.Addr) *Rule {
+    if r := s.lookupAddr(a); r != nil || p.embed == nil || s == nil || a.Is4() {
+        return r
+    }
+    b := a.As16()
+    if v, ok := p.embed.extract(b[:]); ok {
+        return s.lookupV4(v)
+    }
+    return nil
+}
+
+func appendRule(list []*Rule, r *Rule) []*Rule {
+    if r == nil {
+        return list
+    }
+    for _, x := range list {
+        if x == r {
+            return list
+        }
+    }
+    return append(list, r)
+}
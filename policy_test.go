@@ -0,0 +1,118 @@
+package carbolicacid
+
+import (
+    "context"
+    "testing"
+
+    "github.com/miekg/dns"
+)
+
+func TestPolicyEvaluatePerRecord(t *testing.T) {
+    p, err := NewPolicy([]*BlockNode{
+        {Kind: RulePreset, Value: "iana"},
+        {Kind: RuleInclude, Value: "5.6.7.0/24"},
+    }, ActionNxdomain)
+    if err != nil {
+        t.Fatalf("NewPolicy failed: %v", err)
+    }
+
+    m := makeA("example.com.", "1.1.1.1")
+    rr2, _ := dns.NewRR("example.com. 60 IN A 5.6.7.8")
+    rr3, _ := dns.NewRR("example.com. 60 IN AAAA ::1")
+    rr4, _ := dns.NewRR("example.com. 60 IN TXT \"ignored\"")
+    m.Answer = append(m.Answer, rr2, rr3, rr4)
+
+    v := p.Evaluate(m)
+    if !v.Blocked || v.Action != ActionNxdomain {
+        t.Fatalf("expected blocked with nxdomain, got blocked=%v action=%s", v.Blocked, v.Action)
+    }
+    if len(v.Records) != 3 {
+        t.Fatalf("expected 3 A/AAAA record verdicts, got %d", len(v.Records))
+    }
+
+    want := []MatchKind{MatchNone, MatchBlock, MatchBlock}
+    for i, rv := range v.Records {
+        if rv.Match != want[i] {
+            t.Fatalf("record %d: expected %s, got %s", i, want[i], rv.Match)
+        }
+    }
+    if got := v.Records[1].Rule.String(); got != "block 5.6.7.0/24" {
+        t.Fatalf("unexpected rule for 5.6.7.8: %q", got)
+    }
+    if got := v.Records[2].Rule.String(); got != "preset iana ::1/128" {
+        t.Fatalf("unexpected rule for ::1: %q", got)
+    }
+    if len(v.Rules) != 2 {
+        t.Fatalf("expected 2 matched rules, got %d", len(v.Rules))
+    }
+}
+
+func TestPolicyEvaluateAllowWins(t *testing.T) {
+    p, err := NewPolicy([]*BlockNode{
+        {Kind: RuleInclude, Value: "1.2.3.0/24", Excl: []string{"1.2.3.4/32"}},
+    }, ActionDrop)
+    if err != nil {
+        t.Fatalf("NewPolicy failed: %v", err)
+    }
+
+    m := makeA("example.com.", "1.2.3.5")
+    rr, _ := dns.NewRR("example.com. 60 IN A 1.2.3.4")
+    m.Answer = append(m.Answer, rr)
+
+    v := p.Evaluate(m)
+    if v.Blocked || v.Action != ActionPass {
+        t.Fatalf("expected pass, got blocked=%v action=%s", v.Blocked, v.Action)
+    }
+    if len(v.Rules) != 1 || !v.Rules[0].Exclude || v.Rules[0].CIDR != "1.2.3.4/32" {
+        t.Fatalf("expected exclude rule to decide the verdict, got %v", v.Rules)
+    }
+}
+
+func TestPolicyEvaluateAllIPWithoutAddresses(t *testing.T) {
+    p, err := NewPolicy([]*BlockNode{
+        {Kind: RulePreset, Value: "allip"},
+    }, ActionServfail)
+    if err != nil {
+        t.Fatalf("NewPolicy failed: %v", err)
+    }
+
+    m := new(dns.Msg)
+    m.SetQuestion("example.com.", dns.TypeMX)
+
+    v := p.Evaluate(m)
+    if !v.Blocked || v.Action != ActionServfail {
+        t.Fatalf("allip should block responses without A/AAAA, got blocked=%v", v.Blocked)
+    }
+    if len(v.Rules) != 1 || v.Rules[0].Node.Value != "allip" {
+        t.Fatalf("expected allip rule attribution, got %v", v.Rules)
+    }
+}
+
+// 影子策略只记录，不改变应答
+func TestShadowDoesNotChangeAnswer(t *testing.T) {
+    cfg := &Config{
+        Blocks: []*BlockNode{
+            {Kind: RuleInclude, Value: "10.0.0.0/8"},
+        },
+        Action: ActionNxdomain,
+        Shadow: &Shadow{
+            Blocks: []*BlockNode{{Kind: RulePreset, Value: "allip"}},
+            Action: ActionServfail,
+        },
+    }
+
+    next := &testNext{resp: makeA("example.com.", "8.8.8.8")}
+    ca := &CarbolicAcid{Next: next, cfg: cfg}
+
+    rw := &testResponseWriter{}
+    rc, err := ca.ServeDNS(context.Background(), rw, makeA("example.com.", "8.8.8.8"))
+    if err != nil {
+        t.Fatalf("ServeDNS error: %v", err)
+    }
+    if rc != dns.RcodeSuccess || rw.msg == nil || len(rw.msg.Answer) != 1 {
+        t.Fatalf("shadow policy must not change the answer, rc=%d msg=%v", rc, rw.msg)
+    }
+    if cfg.Shadow.policy == nil {
+        t.Fatalf("expected shadow policy to be initialized")
+    }
+}
@@ -0,0 +1,78 @@
+package carbolicacid
+
+import (
+    "encoding/binary"
+    "net/netip"
+    "strings"
+)
+
+// parsePrefix: CIDR 或单个地址 → 规范的 netip.Prefix（不分配内存）
+//
+// - 单个地址补全为 /32 或 /128
+// - 拒绝带 zone 的地址（fe80::1%eth0）：zone 只对本机接口有意义，不能出现在 DNS 应答中
+// - 拒绝主机位非零的前缀（10.1.2.3/8）：net.ParseCIDR 会静默掩掉主机位，
+//   写错的前缀因此匹配了与预期完全不同的范围
+//
+// IPv4-mapped 地址（::ffff:a.b.c.d）保持为 IPv6 前缀，与 AAAA 记录的匹配方式一致。
+func parsePrefix(s string) (netip.Prefix, error) {
+    if strings.Contains(s, "%") {
+        return netip.Prefix{}, &CIDRError{Kind: ErrInvalidCIDR, CIDR: s, Detail: "zone identifiers are not allowed"}
+    }
+
+    if !strings.Contains(s, "/") {
+        a, err := netip.ParseAddr(s)
+        if err != nil {
+            return netip.Prefix{}, &CIDRError{Kind: ErrInvalidCIDR, CIDR: s}
+        }
+        return netip.PrefixFrom(a, a.BitLen()), nil
+    }
+
+    p, err := netip.ParsePrefix(s)
+    if err != nil {
+        return netip.Prefix{}, &CIDRError{Kind: ErrInvalidCIDR, CIDR: s}
+    }
+    if m := p.Masked(); m != p {
+        return netip.Prefix{}, &CIDRError{Kind: ErrNonCanonical, CIDR: s, Detail: "host bits are set, did you mean " + m.String()}
+    }
+    return p, nil
+}
+
+// v4CIDR: IPv4 前缀 → 匹配表条目
+func v4CIDR(p netip.Prefix) IPv4CIDR {
+    b := p.Addr().As4()
+    shift := uint8(32 - p.Bits())
+    return IPv4CIDR{
+        shifted: binary.BigEndian.Uint32(b[:]) >> shift, // shift = 32 时结果为 0
+        shift:   shift,
+    }
+}
+
+// v6CIDR: IPv6 前缀 → 匹配表条目
+func v6CIDR(p netip.Prefix) IPv6CIDR {
+    hi, lo := addrToUint128(p.Addr())
+    bits := uint8(p.Bits())
+
+    c := IPv6CIDR{prefix: bits}
+    switch {
+    case bits == 0:
+    case bits <= 64:
+        c.shiftedHi = hi >> (64 - bits)
+    default:
+        c.shiftedHi = hi
+        c.shiftedLo = lo >> (128 - bits)
+    }
+    return c
+}
+
+// addrToUint128: IPv6（含 IPv4-mapped）地址 → 高低 64 位
+func addrToUint128(a netip.Addr) (hi, lo uint64) {
+    b := a.As16()
+    return binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+}
+
+// prefixSubset: child 是否包含于 parent（同一地址族）
+func prefixSubset(child, parent netip.Prefix) bool {
+    return child.Addr().Is4() == parent.Addr().Is4() &&
+        parent.Bits() <= child.Bits() &&
+        parent.Contains(child.Addr())
+}
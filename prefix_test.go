@@ -0,0 +1,177 @@
+package carbolicacid
+
+import (
+    "net"
+    "net/netip"
+    "strings"
+    "testing"
+
+    "github.com/miekg/dns"
+)
+
+func TestParsePrefix(t *testing.T) {
+    tests := []struct {
+        in   string
+        want string // 空表示应当报错
+        err  string
+    }{
+        {in: "10.0.0.0/8", want: "10.0.0.0/8"},
+        {in: "10.1.2.3", want: "10.1.2.3/32"},
+        {in: "2001:db8::1", want: "2001:db8::1/128"},
+        {in: "0.0.0.0/0", want: "0.0.0.0/0"},
+        {in: "::/0", want: "::/0"},
+        {in: "::ffff:0:0/96", want: "::ffff:0.0.0.0/96"},
+        {in: "10.1.2.3/8", err: "did you mean 10.0.0.0/8"},
+        {in: "2001:db8::1/32", err: "did you mean 2001:db8::/32"},
+        {in: "fe80::1%eth0", err: "zone"},
+        {in: "fe80::%eth0/10", err: "zone"},
+        {in: "10.0.0.0/33", err: "invalid CIDR"},
+        {in: "banana", err: "invalid CIDR"},
+        {in: "", err: "invalid CIDR"},
+    }
+
+    for _, tc := range tests {
+        p, err := parsePrefix(tc.in)
+        if tc.err != "" {
+            if err == nil || !strings.Contains(err.Error(), tc.err) {
+                t.Errorf("%q: expected error containing %q, got %v (%s)", tc.in, tc.err, err, p)
+            }
+            continue
+        }
+        if err != nil || p.String() != tc.want {
+            t.Errorf("%q: expected %s, got %s (%v)", tc.in, tc.want, p, err)
+        }
+    }
+}
+
+func TestNonCanonicalPrefixFailsInit(t *testing.T) {
+    for _, blocks := range [][]*BlockNode{
+        {{Kind: RuleInclude, Value: "10.1.2.3/8"}},
+        {{Kind: RuleInclude, Value: "10.0.0.0/8", Excl: []string{"10.1.2.3/16"}}},
+        {{Kind: RuleInclude, Value: "fe80::1%eth0"}},
+    } {
+        cfg := &Config{Blocks: blocks, Action: ActionDrop}
+        if err := cfg.initBlockList(); err == nil {
+            t.Errorf("expected init to fail for %s %v", blocks[0], blocks[0].Excl)
+        }
+    }
+}
+
+func TestBareAddressExclude(t *testing.T) {
+    cfg := &Config{
+        Blocks: []*BlockNode{{Kind: RulePreset, Value: "iana", Excl: []string{"127.0.0.53"}}},
+        Action: ActionDrop,
+    }
+    if err := cfg.initBlockList(); err != nil {
+        t.Fatalf("bare address exclude rejected: %v", err)
+    }
+    if blocked, _ := cfg.policy.MatchAddr(netip.MustParseAddr("127.0.0.53")); blocked {
+        t.Fatalf("excluded address blocked")
+    }
+}
+
+func TestMatchAddr(t *testing.T) {
+    p, err := NewPolicy([]*BlockNode{
+        {Kind: RuleInclude, Value: "10.0.0.0/8", Excl: []string{"10.1.0.0/16"}},
+        {Kind: RuleInclude, Value: "2001:db8::/32"},
+    }, ActionDrop)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        addr    string
+        blocked bool
+        rule    string
+    }{
+        {"10.2.3.4", true, "block 10.0.0.0/8"},
+        {"::ffff:10.2.3.4", false, ""}, // IPv4-mapped 是 IPv6 地址，未启用 embedded_ipv4
+        {"10.1.2.3", false, "block 10.0.0.0/8 exclude 10.1.0.0/16"},
+        {"2001:db8::1", true, "block 2001:db8::/32"},
+        {"2001:db9::1", false, ""},
+        {"192.0.2.1", false, ""},
+    }
+    for _, tc := range tests {
+        blocked, rule := p.MatchAddr(netip.MustParseAddr(tc.addr))
+        if blocked != tc.blocked || rule.String() != tc.rule {
+            t.Errorf("%s: got (%v, %q), want (%v, %q)", tc.addr, blocked, rule.String(), tc.blocked, tc.rule)
+        }
+    }
+    if blocked, _ := p.MatchAddr(netip.Addr{}); blocked {
+        t.Errorf("invalid address matched")
+    }
+}
+
+// MatchAddr / MatchIP 与 Evaluate、decide（ServeDNS）对同一地址的判定一致
+func TestMatchAddrAgreesWithEvaluate(t *testing.T) {
+    addrs := []string{
+        "10.2.3.4", "::ffff:10.2.3.4", "10.1.2.3", "::ffff:10.1.2.3",
+        "64:ff9b::a02:304", "2001:db8::1", "::ffff:192.0.2.1", "192.0.2.1",
+    }
+    for _, embedded := range []bool{false, true} {
+        p, err := NewPolicy([]*BlockNode{
+            {Kind: RuleInclude, Value: "10.0.0.0/8", Excl: []string{"10.1.0.0/16"}},
+            {Kind: RuleInclude, Value: "2001:db8::/32"},
+        }, ActionDrop)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if embedded {
+            if err := p.EnableEmbeddedIPv4(nil); err != nil {
+                t.Fatal(err)
+            }
+        }
+
+        for _, s := range addrs {
+            a := netip.MustParseAddr(s)
+            m := new(dns.Msg)
+            m.SetQuestion("example.com.", dns.TypeA)
+            hdr := dns.RR_Header{Name: "example.com.", Class: dns.ClassINET, Ttl: 60}
+            if a.Is4() {
+                hdr.Rrtype = dns.TypeA
+                m.Answer = []dns.RR{&dns.A{Hdr: hdr, A: a.AsSlice()}}
+            } else {
+                hdr.Rrtype = dns.TypeAAAA
+                m.Answer = []dns.RR{&dns.AAAA{Hdr: hdr, AAAA: a.AsSlice()}}
+            }
+
+            byAddr, _ := p.MatchAddr(a)
+            byEval := p.Evaluate(m).Blocked
+            byDecide, _ := p.decide(m)
+            if byAddr != byEval || byAddr != byDecide {
+                t.Errorf("embedded=%v %s: MatchAddr %v, Evaluate %v, decide %v", embedded, s, byAddr, byEval, byDecide)
+            }
+            if a.Is4() {
+                if byIP, _ := p.MatchIP(net.ParseIP(s)); byIP != byAddr {
+                    t.Errorf("embedded=%v %s: MatchIP %v, MatchAddr %v", embedded, s, byIP, byAddr)
+                }
+            }
+        }
+    }
+}
+
+func TestMatchHotPathAllocationFree(t *testing.T) {
+    p, err := NewPolicy([]*BlockNode{
+        {Kind: RulePreset, Value: "iana", Excl: []string{"10.1.0.0/16"}},
+    }, ActionDrop)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := p.EnableEmbeddedIPv4(nil); err != nil {
+        t.Fatal(err)
+    }
+
+    m := makeA("example.com.", "93.184.216.34")
+    m.Answer = append(m.Answer, &dns.AAAA{
+        Hdr:  dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: 60},
+        AAAA: netip.MustParseAddr("64:ff9b::8.8.8.8").AsSlice(),
+    })
+    a := netip.MustParseAddr("2001:db8::1")
+
+    if n := testing.AllocsPerRun(100, func() { p.decide(m) }); n != 0 {
+        t.Errorf("decide allocates %v times", n)
+    }
+    if n := testing.AllocsPerRun(100, func() { p.MatchAddr(a) }); n != 0 {
+        t.Errorf("MatchAddr allocates %v times", n)
+    }
+}
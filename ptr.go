@@ -0,0 +1,40 @@
+package carbolicacid
+
+import (
+    "net/netip"
+    "strings"
+
+    "github.com/coredns/coredns/plugin/pkg/dnsutil"
+    "github.com/miekg/dns"
+)
+
+// ptrAddr: PTR 查询名 → 地址
+//
+// 只处理完整地址（in-addr.arpa 4 段 / ip6.arpa 32 段），其余返回无效的 netip.Addr。
+func ptrAddr(r *dns.Msg) netip.Addr {
+    if r == nil || len(r.Question) == 0 {
+        return netip.Addr{}
+    }
+    q := r.Question[0]
+    if q.Qtype != dns.TypePTR {
+        return netip.Addr{}
+    }
+
+    a, err := netip.ParseAddr(dnsutil.ExtractAddressFromReverse(strings.ToLower(q.Name)))
+    if err != nil {
+        return netip.Addr{}
+    }
+    return a
+}
+
+// checkPTR: 查询侧检查 —— PTR 查询的地址命中 blockList 时返回 true 和命中规则
+func (c *Config) checkPTR(r *dns.Msg) (bool, *Rule) {
+    if !c.PTR {
+        return false, nil
+    }
+    a := ptrAddr(r)
+    if !a.IsValid() {
+        return false, nil
+    }
+    return c.policy.MatchAddr(a)
+}
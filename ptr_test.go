@@ -0,0 +1,64 @@
+package carbolicacid
+
+import (
+    "context"
+    "testing"
+
+    "github.com/miekg/dns"
+)
+
+// 计数 Next 调用次数，用于确认查询没有转发到上游
+type countingNext struct {
+    testNext
+    calls int
+}
+
+func (t *countingNext) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+    t.calls++
+    return t.testNext.ServeDNS(ctx, w, r)
+}
+
+func TestPTRQueryBlocked(t *testing.T) {
+    cfg := &Config{
+        Blocks: []*BlockNode{
+            {Kind: RulePreset, Value: "iana", Excl: []string{"127.0.0.0/8"}},
+        },
+        Action:    ActionDrop,
+        PTR:       true,
+        PTRAction: ActionNxdomain,
+    }
+
+    tests := []struct {
+        qname   string
+        blocked bool
+    }{
+        {"3.2.1.10.in-addr.arpa.", true},
+        {"3.2.1.10.IN-ADDR.ARPA.", true},
+        {"1.0.0.127.in-addr.arpa.", false}, // exclude
+        {"8.8.8.8.in-addr.arpa.", false},
+        {"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.e.f.ip6.arpa.", true},
+        {"10.in-addr.arpa.", false}, // 非完整地址不处理
+    }
+
+    for _, tc := range tests {
+        next := &countingNext{testNext: testNext{resp: new(dns.Msg)}}
+        ca := &CarbolicAcid{Next: next, cfg: cfg}
+
+        r := new(dns.Msg)
+        r.SetQuestion(tc.qname, dns.TypePTR)
+
+        rw := &testResponseWriter{}
+        rc, err := ca.ServeDNS(context.Background(), rw, r)
+        if err != nil {
+            t.Fatalf("%s: ServeDNS error: %v", tc.qname, err)
+        }
+
+        if tc.blocked {
+            if rc != dns.RcodeNameError || next.calls != 0 {
+                t.Errorf("%s: expected NXDOMAIN without upstream, got rc=%d calls=%d", tc.qname, rc, next.calls)
+            }
+        } else if next.calls != 1 {
+            t.Errorf("%s: expected query to reach upstream", tc.qname)
+        }
+    }
+}
@@ -0,0 +1,406 @@
+package carbolicacid
+
+import (
+    "bufio"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "math"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/coredns/coredns/plugin/pkg/log"
+)
+
+const (
+    defaultQuarantineSize = 64 << 20 // 64 MiB
+
+    quarantineSegments = 8           // 总大小上限按段数均分，淘汰以段为单位
+    quarantineMinSeg   = 64 << 10    // 单段最小 64 KiB
+    quarantineQueue    = 256         // 写入队列长度，满时丢弃新记录
+    quarantinePruneMax = time.Minute // 按时间淘汰的最长检查间隔
+    quarantineMagic    = "CAQ1"
+    quarantineExt      = ".caq"
+
+    // quarantineMaxRecord: 单条记录（不含长度字段）的上限：时间 + 4 个最长 64 KiB 的字符串 + 2 个最长 64 KiB 的 DNS 报文
+    quarantineMaxRecord = 8 + 4*(2+0xffff) + 2*(4+0xffff)
+)
+
+// QuarantineEntry: 一条隔离记录
+//
+// Query 与 Response 为原始报文：Response 是上游返回的、被拦截的响应，未经任何修改。
+type QuarantineEntry struct {
+    Time     time.Time
+    Client   string // 客户端地址 ip:port
+    Server   string // CoreDNS server 标识（metrics.WithServer）
+    Action   string
+    Rule     string
+    Query    []byte
+    Response []byte
+}
+
+// Quarantine: 被拦截的上游响应落盘，供事后取证与重放
+//
+// 目录下按时间顺序的段文件组成环：当前段写满、或段内最早的记录早于 MaxAge 时新建一段，
+// 总大小超过 MaxSize 或段内最新记录早于 MaxAge 时删除最旧的段。启动时与空闲时（定时）
+// 同样按这两个限制淘汰。写入在后台 goroutine 中完成，ServeDNS 只做一次非阻塞投递，
+// 队列满时丢弃并计数。
+type Quarantine struct {
+    Dir     string
+    MaxSize int64
+    MaxAge  time.Duration // 0 表示不按时间淘汰
+
+    mu        sync.Mutex
+    queue     chan *QuarantineEntry
+    done      chan struct{}
+    seg       *os.File
+    segName   string
+    segOpened time.Time // 当前段第一条记录的时间
+    segSize   int64
+}
+
+// start: 创建目录并启动后台写入（OnStartup）
+func (q *Quarantine) start() error {
+    if err := os.MkdirAll(q.Dir, 0o750); err != nil {
+        return err
+    }
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    if q.queue != nil {
+        return nil
+    }
+    q.queue = make(chan *QuarantineEntry, quarantineQueue)
+    q.done = make(chan struct{})
+    go q.run(q.queue, q.done)
+    return nil
+}
+
+// stop: 写完队列中剩余的记录并关闭当前段（OnShutdown）
+func (q *Quarantine) stop() error {
+    q.mu.Lock()
+    queue, done := q.queue, q.done
+    q.queue, q.done = nil, nil
+    q.mu.Unlock()
+    if queue == nil {
+        return nil
+    }
+    close(queue)
+    <-done
+    return nil
+}
+
+// record: 投递一条记录，不阻塞；未启动或队列已满时返回 false
+func (q *Quarantine) record(e *QuarantineEntry) bool {
+    if q == nil {
+        return false
+    }
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    if q.queue == nil {
+        return false
+    }
+    select {
+    case q.queue <- e:
+        return true
+    default:
+        return false
+    }
+}
+
+func (q *Quarantine) run(queue <-chan *QuarantineEntry, done chan<- struct{}) {
+    defer close(done)
+
+    // 先淘汰上次运行留下的段；之后即使没有新记录，也定期按时间淘汰
+    if err := q.prune(time.Now(), ""); err != nil {
+        log.Errorf("[carbolicacid] quarantine: %v", err)
+    }
+    var tick <-chan time.Time
+    if q.MaxAge > 0 {
+        t := time.NewTicker(q.pruneInterval())
+        defer t.Stop()
+        tick = t.C
+    }
+
+    for {
+        select {
+        case e, ok := <-queue:
+            if !ok {
+                if q.seg != nil {
+                    q.seg.Close()
+                    q.seg, q.segName = nil, ""
+                }
+                return
+            }
+            if err := q.write(e); err != nil {
+                log.Errorf("[carbolicacid] quarantine: %v", err)
+            }
+        case now := <-tick:
+            if err := q.expire(now); err != nil {
+                log.Errorf("[carbolicacid] quarantine: %v", err)
+            }
+        }
+    }
+}
+
+// pruneInterval: MaxAge 的 1/8，介于 1s 与 quarantinePruneMax 之间
+func (q *Quarantine) pruneInterval() time.Duration {
+    d := q.MaxAge / 8
+    if d < time.Second {
+        return time.Second
+    }
+    if d > quarantinePruneMax {
+        return quarantinePruneMax
+    }
+    return d
+}
+
+// expire: 定时调用（只在后台 goroutine 中）；当前段最早的记录早于 MaxAge 时关闭该段，再淘汰过期段
+func (q *Quarantine) expire(now time.Time) error {
+    if q.seg != nil && now.Sub(q.segOpened) > q.MaxAge {
+        q.seg.Close()
+        q.seg, q.segName = nil, ""
+    }
+    return q.prune(now, q.segName)
+}
+
+// write: 追加一条记录，必要时切换到新段（只在后台 goroutine 中调用）
+func (q *Quarantine) write(e *QuarantineEntry) error {
+    // DNS 报文最长 64 KiB，quarantineMaxRecord 按此计算；更长的内容写入后整段都无法读取
+    if len(e.Query) > 0xffff || len(e.Response) > 0xffff {
+        return fmt.Errorf("message longer than %d bytes", 0xffff)
+    }
+    buf := encodeQuarantineEntry(e)
+    aged := q.MaxAge > 0 && e.Time.Sub(q.segOpened) > q.MaxAge
+    if q.seg == nil || aged || q.segSize+int64(len(buf)) > q.segLimit() {
+        if err := q.rotate(e.Time); err != nil {
+            return err
+        }
+    }
+    n, err := q.seg.Write(buf)
+    q.segSize += int64(n)
+    return err
+}
+
+func (q *Quarantine) segLimit() int64 {
+    if s := q.MaxSize / quarantineSegments; s > quarantineMinSeg {
+        return s
+    }
+    return quarantineMinSeg
+}
+
+// rotate: 关闭当前段，新建一段，再按大小和时间淘汰旧段
+func (q *Quarantine) rotate(now time.Time) error {
+    if q.seg != nil {
+        q.seg.Close()
+        q.seg, q.segName = nil, ""
+    }
+
+    name := filepath.Join(q.Dir, fmt.Sprintf("%020d%s", now.UnixNano(), quarantineExt))
+    f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+    if err != nil {
+        return err
+    }
+    if _, err := f.WriteString(quarantineMagic); err != nil {
+        f.Close()
+        return err
+    }
+    q.seg, q.segName, q.segOpened, q.segSize = f, name, now, int64(len(quarantineMagic))
+
+    return q.prune(now, name)
+}
+
+// prune: 从最旧的段开始删除，直到总大小与时间都满足限制；当前段 keep 不删除（为空表示没有当前段）
+func (q *Quarantine) prune(now time.Time, keep string) error {
+    segs, err := quarantineSegmentsIn(q.Dir)
+    if err != nil {
+        return err
+    }
+
+    infos := make([]os.FileInfo, len(segs))
+    var total int64
+    for i, s := range segs {
+        fi, err := os.Stat(s)
+        if err != nil {
+            return err
+        }
+        infos[i] = fi
+        total += fi.Size()
+    }
+
+    for i, s := range segs {
+        if s == keep {
+            break
+        }
+        expired := q.MaxAge > 0 && now.Sub(infos[i].ModTime()) > q.MaxAge
+        if total <= q.MaxSize && !expired {
+            break
+        }
+        if err := os.Remove(s); err != nil {
+            return err
+        }
+        total -= infos[i].Size()
+    }
+    return nil
+}
+
+// quarantineSegmentsIn: 目录下的段文件，按时间从旧到新
+func quarantineSegmentsIn(dir string) ([]string, error) {
+    ents, err := os.ReadDir(dir)
+    if err != nil {
+        return nil, err
+    }
+    var segs []string
+    for _, e := range ents {
+        if !e.IsDir() && strings.HasSuffix(e.Name(), quarantineExt) {
+            segs = append(segs, filepath.Join(dir, e.Name()))
+        }
+    }
+    sort.Strings(segs) // 文件名为定长的纳秒时间戳
+    return segs, nil
+}
+
+// 记录格式（大端）：
+//
+//    u32 长度 | i64 时间（UnixNano）| str Client | str Server | str Action | str Rule | blob Query | blob Response
+//
+// str 为 u16 长度 + 内容，blob 为 u32 长度 + 内容。
+func encodeQuarantineEntry(e *QuarantineEntry) []byte {
+    strs := []string{e.Client, e.Server, e.Action, e.Rule}
+    n := 4 + 8 + 2*len(strs) + 4*2 + len(e.Query) + len(e.Response)
+    for i, s := range strs {
+        if len(s) > 0xffff {
+            strs[i] = s[:0xffff]
+        }
+        n += len(strs[i])
+    }
+
+    buf := make([]byte, 4, n)
+    binary.BigEndian.PutUint32(buf, uint32(n-4))
+    buf = binary.BigEndian.AppendUint64(buf, uint64(e.Time.UnixNano()))
+    for _, s := range strs {
+        buf = binary.BigEndian.AppendUint16(buf, uint16(len(s)))
+        buf = append(buf, s...)
+    }
+    for _, b := range [][]byte{e.Query, e.Response} {
+        buf = binary.BigEndian.AppendUint32(buf, uint32(len(b)))
+        buf = append(buf, b...)
+    }
+    return buf
+}
+
+var errQuarantineRecord = errors.New("malformed quarantine record")
+
+func decodeQuarantineEntry(b []byte) (*QuarantineEntry, error) {
+    if len(b) < 8 {
+        return nil, errQuarantineRecord
+    }
+    e := &QuarantineEntry{Time: time.Unix(0, int64(binary.BigEndian.Uint64(b))).UTC()}
+    b = b[8:]
+
+    for _, s := range []*string{&e.Client, &e.Server, &e.Action, &e.Rule} {
+        if len(b) < 2 {
+            return nil, errQuarantineRecord
+        }
+        l := int(binary.BigEndian.Uint16(b))
+        if len(b) < 2+l {
+            return nil, errQuarantineRecord
+        }
+        *s = string(b[2 : 2+l])
+        b = b[2+l:]
+    }
+    for _, p := range []*[]byte{&e.Query, &e.Response} {
+        if len(b) < 4 {
+            return nil, errQuarantineRecord
+        }
+        l := int(binary.BigEndian.Uint32(b))
+        if len(b) < 4+l {
+            return nil, errQuarantineRecord
+        }
+        *p = b[4 : 4+l]
+        b = b[4+l:]
+    }
+    if len(b) != 0 {
+        return nil, errQuarantineRecord
+    }
+    return e, nil
+}
+
+// ReadQuarantine: 按时间顺序读取目录中的所有记录，对每条调用 fn
+//
+// 段末尾不完整的记录（写入时进程退出）被忽略；长度超出 quarantineMaxRecord 或无法解码的记录
+// 视为段损坏，返回错误。fn 返回错误时停止读取并返回该错误。
+func ReadQuarantine(dir string, fn func(*QuarantineEntry) error) error {
+    segs, err := quarantineSegmentsIn(dir)
+    if err != nil {
+        return err
+    }
+    for _, s := range segs {
+        if err := readQuarantineSegment(s, fn); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func readQuarantineSegment(name string, fn func(*QuarantineEntry) error) error {
+    f, err := os.Open(name)
+    if err != nil {
+        if errors.Is(err, os.ErrNotExist) {
+            return nil // 读取期间被淘汰
+        }
+        return err
+    }
+    defer f.Close()
+
+    r := bufio.NewReader(f)
+    magic := make([]byte, len(quarantineMagic))
+    if _, err := io.ReadFull(r, magic); err != nil || string(magic) != quarantineMagic {
+        return fmt.Errorf("%s: not a quarantine segment", name)
+    }
+
+    var hdr [4]byte
+    for {
+        if _, err := io.ReadFull(r, hdr[:]); err != nil {
+            return nil // EOF 或不完整的长度字段
+        }
+        l := binary.BigEndian.Uint32(hdr[:])
+        if l > quarantineMaxRecord {
+            return fmt.Errorf("%s: record length %d exceeds %d", name, l, quarantineMaxRecord)
+        }
+        body := make([]byte, l)
+        if _, err := io.ReadFull(r, body); err != nil {
+            return nil
+        }
+        e, err := decodeQuarantineEntry(body)
+        if err != nil {
+            return fmt.Errorf("%s: %v", name, err)
+        }
+        if err := fn(e); err != nil {
+            return err
+        }
+    }
+}
+
+// parseSize: 字节数，支持 K/M/G 后缀（1024 进制）
+func parseSize(s string) (int64, error) {
+    mult := int64(1)
+    switch {
+    case strings.HasSuffix(s, "K"):
+        mult, s = 1<<10, strings.TrimSuffix(s, "K")
+    case strings.HasSuffix(s, "M"):
+        mult, s = 1<<20, strings.TrimSuffix(s, "M")
+    case strings.HasSuffix(s, "G"):
+        mult, s = 1<<30, strings.TrimSuffix(s, "G")
+    }
+    v, err := strconv.ParseInt(s, 10, 64)
+    if err != nil || v <= 0 || v > math.MaxInt64/mult {
+        return 0, fmt.Errorf("invalid size %q", s)
+    }
+    return v * mult, nil
+}
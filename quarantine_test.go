@@ -0,0 +1,352 @@
+package carbolicacid
+
+import (
+    "bytes"
+    "context"
+    "encoding/binary"
+    "net"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/coredns/caddy"
+    "github.com/miekg/dns"
+)
+
+func readAll(t *testing.T, dir string) []*QuarantineEntry {
+    t.Helper()
+    var got []*QuarantineEntry
+    if err := ReadQuarantine(dir, func(e *QuarantineEntry) error {
+        got = append(got, e)
+        return nil
+    }); err != nil {
+        t.Fatalf("ReadQuarantine: %v", err)
+    }
+    return got
+}
+
+func TestQuarantineRecordsUpstreamResponse(t *testing.T) {
+    dir := t.TempDir()
+    q := &Quarantine{Dir: dir, MaxSize: defaultQuarantineSize}
+    if err := q.start(); err != nil {
+        t.Fatal(err)
+    }
+
+    ca := blockedServer(ActionNxdomain)
+    ca.cfg.Quarantine = q
+
+    w := &wireResponseWriter{remote: &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 53000}}
+    r := new(dns.Msg)
+    r.SetQuestion("example.com.", dns.TypeA)
+    if _, err := ca.ServeDNS(context.Background(), w, r); err != nil {
+        t.Fatalf("ServeDNS error: %v", err)
+    }
+    q.stop()
+
+    got := readAll(t, dir)
+    if len(got) != 1 {
+        t.Fatalf("expected 1 quarantined entry, got %d", len(got))
+    }
+    e := got[0]
+    if e.Client != "192.0.2.1:53000" || e.Action != "nxdomain" || e.Rule != "block 10.0.0.0/8" {
+        t.Fatalf("unexpected entry: %+v", e)
+    }
+
+    // 记录的是上游原始响应，而不是写给客户端的 NXDOMAIN
+    m := new(dns.Msg)
+    if err := m.Unpack(e.Response); err != nil {
+        t.Fatalf("response does not decode: %v", err)
+    }
+    if m.Rcode != dns.RcodeSuccess || len(m.Answer) != 1 || m.Answer[0].(*dns.A).A.String() != "10.1.2.3" {
+        t.Fatalf("unexpected quarantined response: %v", m)
+    }
+    qm := new(dns.Msg)
+    if err := qm.Unpack(e.Query); err != nil || qm.Question[0].Name != "example.com." {
+        t.Fatalf("unexpected quarantined query: %v %v", qm, err)
+    }
+}
+
+func TestQuarantineRingEvictsOldestSegments(t *testing.T) {
+    dir := t.TempDir()
+    q := &Quarantine{Dir: dir, MaxSize: 4 * quarantineMinSeg}
+
+    payload := bytes.Repeat([]byte{0xab}, 4096)
+    now := time.Unix(1700000000, 0)
+    for i := 0; i < 200; i++ {
+        e := &QuarantineEntry{Time: now.Add(time.Duration(i) * time.Millisecond), Rule: "block 10.0.0.0/8", Response: payload}
+        if err := q.write(e); err != nil {
+            t.Fatalf("write %d: %v", i, err)
+        }
+    }
+    q.seg.Close()
+
+    segs, err := quarantineSegmentsIn(dir)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var total int64
+    for _, s := range segs {
+        fi, _ := os.Stat(s)
+        total += fi.Size()
+    }
+    if total > q.MaxSize+q.segLimit() {
+        t.Fatalf("ring exceeds its bound: %d bytes in %d segments", total, len(segs))
+    }
+
+    got := readAll(t, dir)
+    if len(got) == 0 || len(got) == 200 {
+        t.Fatalf("expected the oldest entries to be evicted, got %d", len(got))
+    }
+    if last := got[len(got)-1]; !last.Time.Equal(now.Add(199 * time.Millisecond)) {
+        t.Fatalf("newest entry missing, last is %v", last.Time)
+    }
+    for i := 1; i < len(got); i++ {
+        if got[i].Time.Before(got[i-1].Time) {
+            t.Fatalf("entries out of order at %d", i)
+        }
+    }
+}
+
+func TestQuarantineMaxAge(t *testing.T) {
+    dir := t.TempDir()
+    q := &Quarantine{Dir: dir, MaxSize: defaultQuarantineSize, MaxAge: time.Hour}
+
+    old := time.Now().Add(-2 * time.Hour)
+    if err := q.write(&QuarantineEntry{Time: old, Rule: "old"}); err != nil {
+        t.Fatal(err)
+    }
+    q.seg.Close()
+    segs, _ := quarantineSegmentsIn(dir)
+    os.Chtimes(segs[0], old, old)
+
+    q.seg = nil // 下一次写入切换到新段并淘汰过期段
+    if err := q.write(&QuarantineEntry{Time: time.Now(), Rule: "new"}); err != nil {
+        t.Fatal(err)
+    }
+    q.seg.Close()
+
+    got := readAll(t, dir)
+    if len(got) != 1 || got[0].Rule != "new" {
+        t.Fatalf("expected only the fresh entry, got %+v", got)
+    }
+}
+
+// 没有新记录时，过期的段（包括当前段）也会被定时淘汰
+func TestQuarantineMaxAgeIdle(t *testing.T) {
+    dir := t.TempDir()
+    q := &Quarantine{Dir: dir, MaxSize: defaultQuarantineSize, MaxAge: time.Hour}
+
+    old := time.Now().Add(-2 * time.Hour)
+    if err := q.write(&QuarantineEntry{Time: old, Rule: "old"}); err != nil {
+        t.Fatal(err)
+    }
+    segs, _ := quarantineSegmentsIn(dir)
+    os.Chtimes(segs[0], old, old)
+
+    if err := q.expire(old.Add(30 * time.Minute)); err != nil {
+        t.Fatal(err)
+    }
+    if q.seg == nil || len(readAll(t, dir)) != 1 {
+        t.Fatalf("segment expired before max_age")
+    }
+
+    if err := q.expire(time.Now()); err != nil {
+        t.Fatal(err)
+    }
+    if q.seg != nil {
+        t.Fatalf("expected the aged active segment to be closed")
+    }
+    if got := readAll(t, dir); len(got) != 0 {
+        t.Fatalf("expected expired entries to be deleted, got %+v", got)
+    }
+}
+
+// 当前段最早的记录早于 max_age 时，下一次写入切换到新段
+func TestQuarantineRotatesAgedSegment(t *testing.T) {
+    dir := t.TempDir()
+    q := &Quarantine{Dir: dir, MaxSize: defaultQuarantineSize, MaxAge: time.Hour}
+
+    now := time.Now()
+    for _, e := range []*QuarantineEntry{
+        {Time: now.Add(-2 * time.Hour), Rule: "first"},
+        {Time: now.Add(-90 * time.Minute), Rule: "second"},
+        {Time: now, Rule: "third"},
+    } {
+        if err := q.write(e); err != nil {
+            t.Fatal(err)
+        }
+    }
+    q.seg.Close()
+
+    if segs, _ := quarantineSegmentsIn(dir); len(segs) != 2 {
+        t.Fatalf("expected 2 segments, got %v", segs)
+    }
+}
+
+// 启动时淘汰上次运行留下的过期段
+func TestQuarantineStartPrunes(t *testing.T) {
+    dir := t.TempDir()
+    old := time.Now().Add(-2 * time.Hour)
+    w := &Quarantine{Dir: dir, MaxSize: defaultQuarantineSize}
+    if err := w.write(&QuarantineEntry{Time: old, Rule: "old"}); err != nil {
+        t.Fatal(err)
+    }
+    w.seg.Close()
+    segs, _ := quarantineSegmentsIn(dir)
+    os.Chtimes(segs[0], old, old)
+
+    q := &Quarantine{Dir: dir, MaxSize: defaultQuarantineSize, MaxAge: time.Hour}
+    if err := q.start(); err != nil {
+        t.Fatal(err)
+    }
+    q.stop()
+    if got := readAll(t, dir); len(got) != 0 {
+        t.Fatalf("expected the expired segment to be deleted at startup, got %+v", got)
+    }
+}
+
+func TestQuarantineTruncatedTail(t *testing.T) {
+    dir := t.TempDir()
+    q := &Quarantine{Dir: dir, MaxSize: defaultQuarantineSize}
+    for _, rule := range []string{"a", "b"} {
+        if err := q.write(&QuarantineEntry{Time: time.Now(), Rule: rule, Response: []byte{1, 2, 3}}); err != nil {
+            t.Fatal(err)
+        }
+    }
+    // 模拟写入第二条记录时进程退出
+    name := q.seg.Name()
+    q.seg.Close()
+    fi, _ := os.Stat(name)
+    os.Truncate(name, fi.Size()-2)
+
+    got := readAll(t, dir)
+    if len(got) != 1 || got[0].Rule != "a" {
+        t.Fatalf("expected the complete entry only, got %+v", got)
+    }
+}
+
+func TestQuarantineRoundTrip(t *testing.T) {
+    dir := t.TempDir()
+    q := &Quarantine{Dir: dir, MaxSize: defaultQuarantineSize}
+    long := strings.Repeat("r", 0x10000+10) // 超出 u16，写入时截断
+    resp := bytes.Repeat([]byte{0xab}, 0xffff)
+    in := []*QuarantineEntry{
+        {Time: time.Unix(1700000000, 123).UTC(), Client: "192.0.2.1:53000", Server: "dns://:53", Action: "nxdomain", Rule: "block 10.0.0.0/8", Query: []byte{1, 2}, Response: []byte{3, 4, 5}},
+        {Time: time.Unix(1700000001, 0).UTC(), Rule: long, Response: resp},
+        {Time: time.Unix(1700000002, 0).UTC()},
+    }
+    for _, e := range in {
+        if err := q.write(e); err != nil {
+            t.Fatal(err)
+        }
+    }
+    q.seg.Close()
+
+    got := readAll(t, dir)
+    if len(got) != len(in) {
+        t.Fatalf("expected %d entries, got %d", len(in), len(got))
+    }
+    first := got[0]
+    if !first.Time.Equal(in[0].Time) || first.Client != in[0].Client || first.Server != in[0].Server ||
+        first.Action != in[0].Action || first.Rule != in[0].Rule ||
+        !bytes.Equal(first.Query, in[0].Query) || !bytes.Equal(first.Response, in[0].Response) {
+        t.Fatalf("entry changed on the way through the segment: %+v", first)
+    }
+    if got[1].Rule != long[:0xffff] || !bytes.Equal(got[1].Response, resp) {
+        t.Fatalf("expected the rule truncated to 65535 bytes and the full response, got %d / %d bytes", len(got[1].Rule), len(got[1].Response))
+    }
+    if len(got[2].Query) != 0 || len(got[2].Response) != 0 {
+        t.Fatalf("expected an empty entry, got %+v", got[2])
+    }
+}
+
+func TestQuarantineCorruptSegment(t *testing.T) {
+    record := func(body []byte) []byte {
+        return append(binary.BigEndian.AppendUint32(nil, uint32(len(body))), body...)
+    }
+    tests := []struct {
+        name string
+        data []byte
+        err  string
+    }{
+        {"bad magic", []byte("NOPE"), "not a quarantine segment"},
+        {"huge length", []byte(quarantineMagic + "\xff\xff\xff\xff"), "exceeds"},
+        {"length above bound", binary.BigEndian.AppendUint32([]byte(quarantineMagic), quarantineMaxRecord+1), "exceeds"},
+        {"short string", append([]byte(quarantineMagic), record(make([]byte, 10))...), "malformed"},
+        {"blob past end", append([]byte(quarantineMagic), record(append(make([]byte, 16), 0, 0, 0, 9))...), "malformed"},
+        {"trailing bytes", append([]byte(quarantineMagic), record(make([]byte, 8+4*2+2*4+1))...), "malformed"},
+    }
+
+    for _, tc := range tests {
+        dir := t.TempDir()
+        if err := os.WriteFile(filepath.Join(dir, "00000000000000000001"+quarantineExt), tc.data, 0o640); err != nil {
+            t.Fatal(err)
+        }
+        err := ReadQuarantine(dir, func(*QuarantineEntry) error { return nil })
+        if err == nil || !strings.Contains(err.Error(), tc.err) {
+            t.Errorf("%s: expected error containing %q, got %v", tc.name, tc.err, err)
+        }
+    }
+}
+
+// 超出读取上限的记录不写入，否则整个段都无法读取
+func TestQuarantineWriteRejectsOversized(t *testing.T) {
+    dir := t.TempDir()
+    q := &Quarantine{Dir: dir, MaxSize: defaultQuarantineSize}
+    if err := q.write(&QuarantineEntry{Time: time.Now(), Response: make([]byte, 0x10000)}); err == nil {
+        t.Fatal("expected an oversized record to be rejected")
+    }
+    if err := q.write(&QuarantineEntry{Time: time.Now(), Rule: "ok"}); err != nil {
+        t.Fatal(err)
+    }
+    q.seg.Close()
+    if got := readAll(t, dir); len(got) != 1 || got[0].Rule != "ok" {
+        t.Fatalf("expected only the valid entry, got %+v", got)
+    }
+}
+
+func TestParseConfigQuarantine(t *testing.T) {
+    dir := filepath.Join(t.TempDir(), "q")
+    c := caddy.NewTestController("dns", `carbolicacid {
+        preset iana
+        quarantine `+dir+` {
+            max_size 16M
+            max_age 168h
+        }
+    }`)
+    cfg, err := parseConfig(c)
+    if err != nil {
+        t.Fatalf("parseConfig failed: %v", err)
+    }
+    q := cfg.Quarantine
+    if q == nil || q.Dir != dir || q.MaxSize != 16<<20 || q.MaxAge != 168*time.Hour {
+        t.Fatalf("unexpected quarantine config: %+v", q)
+    }
+
+    for i, input := range []string{
+        `carbolicacid {
+            quarantine /tmp/q { max_size 0 }
+        }`,
+        `carbolicacid {
+            quarantine /tmp/q {
+                max_age forever
+            }
+        }`,
+        `carbolicacid {
+            quarantine
+        }`,
+        `carbolicacid {
+            preset iana
+            shadow {
+                preset allip
+                quarantine /tmp/q
+            }
+        }`,
+    } {
+        if _, err := parseConfig(caddy.NewTestController("dns", input)); err == nil {
+            t.Errorf("test %d: expected error for input %s", i, input)
+        }
+    }
+}
@@ -0,0 +1,104 @@
+package carbolicacid
+
+import (
+    "context"
+    "crypto/tls"
+    "errors"
+    "fmt"
+    "time"
+
+    "github.com/coredns/coredns/plugin/pkg/parse"
+    "github.com/coredns/coredns/plugin/pkg/transport"
+    "github.com/miekg/dns"
+)
+
+const defaultResolverTimeout = 2 * time.Second
+
+// resolver: 插件自己发起查询用的上游（retry 等），不经过插件链
+//
+// 地址写法与 forward 一致：IP[:PORT]、dns://IP[:PORT]、tls://IP[:PORT]。
+// 依次尝试每个地址，返回第一个成功的应答。
+type resolver struct {
+    targets  []resolverTarget
+    timeout  time.Duration
+    forceTCP bool
+    tls      *tls.Config
+}
+
+type resolverTarget struct {
+    net  string // udp / tcp-tls
+    addr string
+}
+
+// newResolver: 解析上游地址；有 tls:// 地址时 tlsServerName 用于证书校验
+func newResolver(addrs []string, tlsServerName string, timeout time.Duration, forceTCP bool) (*resolver, error) {
+    if len(addrs) == 0 {
+        return nil, errors.New("no upstream address")
+    }
+    if timeout <= 0 {
+        timeout = defaultResolverTimeout
+    }
+
+    rs := &resolver{timeout: timeout, forceTCP: forceTCP}
+    for _, a := range addrs {
+        trans, host := parse.Transport(a)
+
+        var t resolverTarget
+        var err error
+        switch trans {
+        case transport.DNS:
+            t.net = "udp"
+            t.addr, err = parse.HostPort(host, transport.Port)
+        case transport.TLS:
+            t.net = "tcp-tls"
+            t.addr, err = parse.HostPort(host, transport.TLSPort)
+            if rs.tls == nil {
+                rs.tls = &tls.Config{ServerName: tlsServerName}
+            }
+        default:
+            return nil, fmt.Errorf("unsupported transport %q in %s", trans, a)
+        }
+        if err != nil {
+            return nil, err
+        }
+        rs.targets = append(rs.targets, t)
+    }
+    return rs, nil
+}
+
+// exchange: 依次向每个上游发送 r 的副本，返回第一个成功的应答及其地址
+//
+// UDP 应答被截断时改用 TCP 重试同一上游。
+func (rs *resolver) exchange(ctx context.Context, r *dns.Msg) (*dns.Msg, string, error) {
+    var lastErr error
+    for _, t := range rs.targets {
+        network := t.net
+        if network == "udp" && rs.forceTCP {
+            network = "tcp"
+        }
+
+        m, err := rs.exchangeOne(ctx, r, network, t.addr)
+        if err == nil && m.Truncated && network == "udp" {
+            m, err = rs.exchangeOne(ctx, r, "tcp", t.addr)
+        }
+        if err != nil {
+            lastErr = fmt.Errorf("%s: %v", t.addr, err)
+            continue
+        }
+        return m, t.addr, nil
+    }
+    return nil, "", lastErr
+}
+
+func (rs *resolver) exchangeOne(ctx context.Context, r *dns.Msg, network, addr string) (*dns.Msg, error) {
+    client := &dns.Client{Net: network, Timeout: rs.timeout}
+    if network == "tcp-tls" {
+        client.TLSConfig = rs.tls
+    }
+
+    ctx, cancel := context.WithTimeout(ctx, rs.timeout)
+    defer cancel()
+
+    m, _, err := client.ExchangeContext(ctx, r.Copy(), addr)
+    return m, err
+}
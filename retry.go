@@ -0,0 +1,57 @@
+package carbolicacid
+
+import (
+    "context"
+    "time"
+
+    "github.com/coredns/coredns/plugin/metrics"
+    "github.com/coredns/coredns/plugin/pkg/log"
+    "github.com/miekg/dns"
+)
+
+// Retry: responses retry 的备用上游
+//
+// 响应被拦截时，把原查询发给备用上游；备用上游的应答通过同样的检查（双表 + TTL）
+// 则返回给客户端，否则（包括查询失败）执行 Fallback 动作。
+type Retry struct {
+    Upstreams     []string
+    Fallback      ResponseAction // drop / servfail / nxdomain
+    Timeout       time.Duration
+    TLSServerName string
+
+    resolver *resolver
+}
+
+// init: 解析备用上游地址
+func (rt *Retry) init() error {
+    rs, err := newResolver(rt.Upstreams, rt.TLSServerName, rt.Timeout, false)
+    if err != nil {
+        return err
+    }
+    rt.resolver = rs
+    return nil
+}
+
+// retry: 执行 responses retry
+func (c *CarbolicAcid) retry(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+    rt := c.cfg.Retry
+    server := metrics.WithServer(ctx)
+
+    m, addr, err := rt.resolver.exchange(ctx, r)
+    if err != nil {
+        retryCount.WithLabelValues(server, "failed").Inc()
+        log.Warningf("[carbolicacid] retry %s failed: %v, fallback to %s", qname(r), err, rt.Fallback)
+        return c.block(ctx, w, r, rt.Fallback)
+    }
+
+    if blocked, reason := c.check(ctx, m); blocked {
+        retryCount.WithLabelValues(server, "blocked").Inc()
+        log.Warningf("[carbolicacid] retry %s via %s matched %q, fallback to %s", qname(r), addr, reason, rt.Fallback)
+        return c.block(ctx, w, r, rt.Fallback)
+    }
+
+    // 应答已写出；m.Rcode 为 SERVFAIL / REFUSED 时不能原样返回，否则服务器会再写一个 SERVFAIL
+    retryCount.WithLabelValues(server, "answered").Inc()
+    w.WriteMsg(m)
+    return dns.RcodeSuccess, nil
+}
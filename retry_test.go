@@ -0,0 +1,190 @@
+package carbolicacid
+
+import (
+    "context"
+    "net"
+    "testing"
+    "time"
+
+    "github.com/coredns/caddy"
+    "github.com/coredns/coredns/plugin"
+    "github.com/miekg/dns"
+)
+
+// fakeUpstream: 进程内的 dns.Server，按 ip 返回固定的 A 记录
+func fakeUpstream(t *testing.T, ip string) string {
+    return serveUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+        m := new(dns.Msg)
+        m.SetReply(r)
+        m.Answer = append(m.Answer, &dns.A{
+            Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+            A:   net.ParseIP(ip),
+        })
+        w.WriteMsg(m)
+    })
+}
+
+// rcodeUpstream: 进程内的 dns.Server，只返回 rcode、不带记录
+func rcodeUpstream(t *testing.T, rcode int) string {
+    return serveUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+        m := new(dns.Msg)
+        m.SetRcode(r, rcode)
+        w.WriteMsg(m)
+    })
+}
+
+func serveUpstream(t *testing.T, h dns.HandlerFunc) string {
+    t.Helper()
+    pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("listen: %v", err)
+    }
+
+    started := make(chan struct{})
+    srv := &dns.Server{
+        PacketConn:        pc,
+        NotifyStartedFunc: func() { close(started) },
+        Handler:           h,
+    }
+    go srv.ActivateAndServe()
+    <-started
+    t.Cleanup(func() { srv.Shutdown() })
+
+    return pc.LocalAddr().String()
+}
+
+func retryServer(upstream string, fallback ResponseAction) *CarbolicAcid {
+    ca := blockedServer(ActionRetry)
+    ca.cfg.Retry = &Retry{Upstreams: []string{upstream}, Fallback: fallback, Timeout: 500 * time.Millisecond}
+    return ca
+}
+
+func TestRetryAnswered(t *testing.T) {
+    ca := retryServer(fakeUpstream(t, "93.184.216.34"), ActionServfail)
+
+    w := &wireResponseWriter{remote: &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 53000}}
+    r := new(dns.Msg)
+    r.SetQuestion("example.com.", dns.TypeA)
+    if _, err := ca.ServeDNS(context.Background(), w, r); err != nil {
+        t.Fatalf("ServeDNS error: %v", err)
+    }
+
+    m := w.received(t)
+    if m.Id != r.Id || m.Rcode != dns.RcodeSuccess || len(m.Answer) != 1 {
+        t.Fatalf("unexpected reply: %v", m)
+    }
+    if got := m.Answer[0].(*dns.A).A.String(); got != "93.184.216.34" {
+        t.Fatalf("expected the retry upstream answer, got %s", got)
+    }
+}
+
+// 重试上游返回的 SERVFAIL / REFUSED 原样写回；返回值必须让服务器不再补写自己的 SERVFAIL
+func TestRetryAnsweredWithError(t *testing.T) {
+    for _, rcode := range []int{dns.RcodeServerFailure, dns.RcodeRefused} {
+        ca := retryServer(rcodeUpstream(t, rcode), ActionNxdomain)
+
+        w := &wireResponseWriter{remote: &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 53000}}
+        r := new(dns.Msg)
+        r.SetQuestion("example.com.", dns.TypeA)
+        rc, err := ca.ServeDNS(context.Background(), w, r)
+        if err != nil {
+            t.Fatalf("ServeDNS error: %v", err)
+        }
+        if !plugin.ClientWrite(rc) {
+            t.Errorf("%s: returned rc %d makes the server write a second reply", dns.RcodeToString[rcode], rc)
+        }
+        if m := w.received(t); m.Rcode != rcode {
+            t.Errorf("expected the retry upstream %s, got %v", dns.RcodeToString[rcode], m)
+        }
+    }
+}
+
+func TestRetryAlsoPoisoned(t *testing.T) {
+    ca := retryServer(fakeUpstream(t, "10.9.9.9"), ActionNxdomain)
+
+    w := &wireResponseWriter{remote: &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 53000}}
+    r := new(dns.Msg)
+    r.SetQuestion("example.com.", dns.TypeA)
+    if _, err := ca.ServeDNS(context.Background(), w, r); err != nil {
+        t.Fatalf("ServeDNS error: %v", err)
+    }
+    if m := w.received(t); m.Rcode != dns.RcodeNameError || len(m.Answer) != 0 {
+        t.Fatalf("expected fallback NXDOMAIN, got %v", m)
+    }
+}
+
+func TestRetryUpstreamUnreachable(t *testing.T) {
+    // 监听后立即关闭，得到一个没有服务的地址
+    pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    addr := pc.LocalAddr().String()
+    pc.Close()
+
+    ca := retryServer(addr, ActionServfail)
+    ca.cfg.Retry.Timeout = 100 * time.Millisecond
+
+    w := &wireResponseWriter{remote: &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 53000}}
+    r := new(dns.Msg)
+    r.SetQuestion("example.com.", dns.TypeA)
+    rc, err := ca.ServeDNS(context.Background(), w, r)
+    if err != nil {
+        t.Fatalf("ServeDNS error: %v", err)
+    }
+    if rc != dns.RcodeSuccess || w.received(t).Rcode != dns.RcodeServerFailure {
+        t.Fatalf("expected fallback SERVFAIL, got rc=%d", rc)
+    }
+}
+
+func TestParseConfigRetry(t *testing.T) {
+    cfg, err := parseConfig(caddy.NewTestController("dns", `carbolicacid {
+        preset iana
+        responses retry
+        retry tls://9.9.9.9 127.0.0.1:5353 {
+            tls_servername dns.quad9.net
+            fallback nxdomain
+            timeout 1s
+        }
+    }`))
+    if err != nil {
+        t.Fatalf("parseConfig failed: %v", err)
+    }
+    rt := cfg.Retry
+    if cfg.Action != ActionRetry || rt == nil || len(rt.Upstreams) != 2 || rt.Fallback != ActionNxdomain || rt.Timeout != time.Second || rt.TLSServerName != "dns.quad9.net" {
+        t.Fatalf("unexpected retry config: %s %+v", cfg.Action, rt)
+    }
+
+    for i, input := range []string{
+        `carbolicacid {
+            responses retry
+        }`,
+        `carbolicacid {
+            responses retry
+            retry
+        }`,
+        `carbolicacid {
+            responses retry
+            retry example.com
+        }`,
+        `carbolicacid {
+            responses retry
+            retry 9.9.9.9 { fallback bypass }
+        }`,
+        `carbolicacid {
+            responses retry
+            retry https://9.9.9.9
+        }`,
+        `carbolicacid {
+            preset iana
+            shadow {
+                preset allip
+                responses retry
+            }
+        }`,
+    } {
+        if _, err := parseConfig(caddy.NewTestController("dns", input)); err == nil {
+            t.Errorf("test %d: expected error for input %s", i, input)
+        }
+    }
+}
@@ -1,11 +1,16 @@
 package carbolicacid
 
 import (
+    "net/netip"
+    "strconv"
     "sync"
+    "time"
 
     "github.com/coredns/caddy"
     "github.com/coredns/coredns/core/dnsserver"
     "github.com/coredns/coredns/plugin"
+    "github.com/coredns/coredns/plugin/dnstap"
+    "github.com/coredns/coredns/plugin/pkg/log"
 )
 
 func init() {
@@ -18,11 +23,47 @@ func setup(c *caddy.Controller) error {
         return err
     }
 
-    dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
-        return &CarbolicAcid{
-            Next: next,
-            cfg:  cfg,
+    cfg.zone = dnsserver.GetConfig(c).Zone
+    ca := &CarbolicAcid{cfg: cfg}
+
+    // 启动时完成初始化，使 ready 与状态指标在第一个查询之前就反映匹配表的状态
+    c.OnStartup(func() error {
+        if err := cfg.init(); err != nil {
+            log.Errorf("[carbolicacid] init failed: %v, fallback to BYPASS mode", err)
+        }
+        return nil
+    })
+
+    // 与 forward 插件一致：启动时查找 dnstap 插件
+    c.OnStartup(func() error {
+        if taph := dnsserver.GetConfig(c).Handler("dnstap"); taph != nil {
+            if t, ok := taph.(*dnstap.Dnstap); ok {
+                ca.setTapPlugin(t)
+            }
         }
+        return nil
+    })
+
+    // 插件链在 OnStartup 之前已经建好：按 plugin.cfg 顺序检查与 cache / forward 的相对位置
+    c.OnStartup(func() error {
+        conf := dnsserver.GetConfig(c)
+        enabled := func(name string) bool { return conf.Handler(name) != nil }
+        return checkOrder(cfg.OrderCheck, cfg.zone, orderProblems(dnsserver.Directives, enabled))
+    })
+
+    if q := cfg.Quarantine; q != nil {
+        c.OnStartup(q.start)
+        c.OnShutdown(q.stop)
+    }
+
+    if i := cfg.Introspect; i != nil {
+        c.OnStartup(func() error { return i.start(ca) })
+        c.OnShutdown(i.stop)
+    }
+
+    dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+        ca.Next = next
+        return ca
     })
 
     return nil
@@ -42,8 +83,29 @@ const (
     ActionServfail
     ActionNxdomain
     ActionBypass // v0.3.3: 透传但记录告警
+    ActionPass   // v0.3.5: 仅用于 Verdict，表示未阻断，不可配置
+    ActionRetry  // v0.3.5: 向备用上游重新查询，见 Retry
 )
 
+func (a ResponseAction) String() string {
+    switch a {
+    case ActionDrop:
+        return "drop"
+    case ActionServfail:
+        return "servfail"
+    case ActionNxdomain:
+        return "nxdomain"
+    case ActionBypass:
+        return "bypass"
+    case ActionPass:
+        return "pass"
+    case ActionRetry:
+        return "retry"
+    default:
+        return "unknown"
+    }
+}
+
 // v0.3.3 新语法：结构化 preset/block 节点
 type BlockNode struct {
     Kind  RuleKind // RulePreset 或 RuleInclude（block）
@@ -51,6 +113,17 @@ type BlockNode struct {
     Excl  []string // exclude 列表
 }
 
+// String: "preset iana" / "block 10.0.0.0/8"
+func (b *BlockNode) String() string {
+    if b == nil {
+        return ""
+    }
+    if b.Kind == RulePreset {
+        return "preset " + b.Value
+    }
+    return "block " + b.Value
+}
+
 type Config struct {
     Action ResponseAction
 
@@ -58,128 +131,742 @@ type Config struct {
     Blocks []*BlockNode
 
     // 运行时结构：双表模型
+    policy    *Policy
     blockList *IPSet
     allowList *IPSet
 
     initOnce sync.Once
     initErr  error
+    loadedAt time.Time     // v0.3.5: 初始化完成的时间与耗时，见 Status
+    loadTime time.Duration
+    zone     string        // v0.3.5: 所在 server block 的 zone，用作状态指标的标签
 
     presetAllIP bool // 是否使用 preset allip }
+
+    // v0.3.5: 影子策略，只评估和记录，不改变应答
+    Shadow *Shadow
+
+    // v0.3.5: 查询侧 PTR 检查（RFC 6303），反向查询的地址命中 blockList 时不转发上游
+    PTR       bool
+    PTRAction ResponseAction
+
+    // v0.3.5: drop 在 TCP / DoT / DoH 上的行为
+    DropStream DropMode
+
+    // v0.3.5: TTL 范围检查；被阻断的 NXDOMAIN 应答附带 SOA 的否定缓存 TTL（默认 0，不附带）
+    TTL         *TTLWindow
+    NegativeTTL uint32
+
+    // v0.3.5: AAAA 内嵌 IPv4 检查，NAT64 为额外识别的 NAT64 前缀
+    EmbeddedIPv4 bool
+    NAT64        []string
+
+    // v0.3.5: RFC 6303 本地反向区，直接返回权威 NXDOMAIN + SOA
+    LocalZones bool
+    localZones plugin.Zones
+
+    // v0.3.5: 被拦截的上游响应落盘，nil 表示关闭
+    Quarantine *Quarantine
+
+    // v0.3.5: 按 forward 上游统计被拦截的响应，nil 表示关闭
+    Upstreams *Upstreams
+
+    // v0.3.5: responses retry 的备用上游
+    Retry *Retry
+
+    // v0.3.5: 共识模式，命中后向可信上游确认，nil 表示关闭
+    Verify *Verify
+
+    // v0.3.5: 只读的 HTTP 调试接口（仅环回地址），nil 表示关闭
+    Introspect *Introspect
+
+    // v0.3.5: 判定缓存的条目数，0 表示关闭
+    VerdictCache int
+    verdicts     *verdictCache
+
+    // v0.3.5: 与 cache 协作，按 qname / qtype 保存被阻断的判定，重复查询不再到上游；0 表示关闭
+    BlockedCache    int
+    BlockedCacheTTL time.Duration
+    blocked         *verdictCache
+
+    // v0.3.5: 启动时检查插件顺序（相对 cache / forward）
+    OrderCheck OrderMode
+
+    // 解析阶段使用：检查重复的 block / exclude
+    seenBlocks   map[netip.Prefix]*BlockNode
+    seenExcludes map[netip.Prefix]*BlockNode
 }
 
 func parseConfig(c *caddy.Controller) (*Config, error) {
     cfg := &Config{
-        Action: ActionDrop,
+        Action:          ActionDrop,
+        BlockedCacheTTL: defaultBlockedCacheTTL,
     }
 
     for c.Next() {
         for c.NextBlock() {
-            switch c.Val() {
-
-            // -------------------------
-            // preset iana { exclude ... }
-            // preset iana
-            // -------------------------
-            case "preset":
-                args := c.RemainingArgs()
-                if len(args) != 1 {
-                    return nil, c.ArgErr()
-                }
-                name := args[0]
+            closed, err := parseDirective(c, cfg, true)
+            if err != nil {
+                return nil, err
+            }
+            if closed {
+                break
+            }
+        }
+    }
 
-                node := &BlockNode{
-                    Kind:  RulePreset,
-                    Value: name,
-                }
+    if cfg.Action == ActionRetry && cfg.Retry == nil {
+        return nil, c.Err("responses retry requires a retry upstream")
+    }
+    // bypass / retry 需要上游响应，无法直接由保存的判定应答
+    if cfg.BlockedCache > 0 && (cfg.Action == ActionBypass || cfg.Action == ActionRetry) {
+        return nil, c.Errf("cache_blocked requires responses drop, servfail or nxdomain, not %s", cfg.Action)
+    }
 
-                // 尝试读取内层 block：preset NAME { ... }
-                if c.NextBlock() {
-                    for {
-                        switch c.Val() {
-                        case "exclude":
-                            exArgs := c.RemainingArgs()
-                            if len(exArgs) != 1 {
-                                return nil, c.ArgErr()
-                            }
-                            node.Excl = append(node.Excl, exArgs[0])
-
-                        default:
-                            return nil, c.Errf("unknown directive %q inside preset %q", c.Val(), name)
-                        }
-
-                        if !c.NextBlock() {
-                            break
-                        }
-                    }
-                }
+    return cfg, nil
+}
 
-                // 无内层 block → 等价于 preset name {}
-                cfg.Blocks = append(cfg.Blocks, node)
-
-            // -------------------------
-            // block CIDR { exclude ... }
-            // block CIDR
-            // -------------------------
-            case "block":
-                args := c.RemainingArgs()
-                if len(args) != 1 {
-                    return nil, c.ArgErr()
+// parseDirective: 解析一条指令（当前 token 为指令名）
+//
+// top 表示是否位于 carbolicacid 顶层；shadow 只能出现在顶层。
+// 返回 closed=true 表示同一行的 "}" 已经结束了外层 block。
+func parseDirective(c *caddy.Controller, cfg *Config, top bool) (bool, error) {
+    switch c.Val() {
+
+    // -------------------------
+    // preset iana { exclude ... }
+    // preset iana
+    // -------------------------
+    case "preset":
+        args, closed := lineArgs(c)
+        if len(args) != 1 {
+            return false, c.ArgErr()
+        }
+        node := &BlockNode{
+            Kind:  RulePreset,
+            Value: args[0],
+        }
+        list, err := presetCIDRs(node.Value)
+        if err != nil {
+            return false, c.Err(err.Error())
+        }
+        for _, b := range cfg.Blocks {
+            if b.Kind == RulePreset && b.Value == node.Value {
+                return false, c.Errf("%s already configured", node)
+            }
+        }
+        parents := make([]netip.Prefix, 0, len(list))
+        for _, s := range list {
+            p, err := parsePrefix(s)
+            if err != nil {
+                return false, c.Err(err.Error())
+            }
+            parents = append(parents, p)
+        }
+        if !closed {
+            // 无内层 block → 等价于 preset name {}
+            if err := parseExcludes(c, cfg, node, parents); err != nil {
+                return false, err
+            }
+        }
+        cfg.Blocks = append(cfg.Blocks, node)
+        return closed, nil
+
+    // -------------------------
+    // block CIDR { exclude ... }
+    // block CIDR
+    // -------------------------
+    case "block":
+        args, closed := lineArgs(c)
+        if len(args) != 1 {
+            return false, c.ArgErr()
+        }
+        node := &BlockNode{
+            Kind:  RuleInclude,
+            Value: args[0],
+        }
+        p, err := parsePrefix(node.Value)
+        if err != nil {
+            return false, positioned(c, err)
+        }
+        if prev := seenPrefix(&cfg.seenBlocks, p, node); prev != nil {
+            return false, positioned(c, &CIDRError{Kind: ErrDuplicate, CIDR: node.Value, Detail: "already configured as " + prev.String()})
+        }
+        if !closed {
+            if err := parseExcludes(c, cfg, node, []netip.Prefix{p}); err != nil {
+                return false, err
+            }
+        }
+        cfg.Blocks = append(cfg.Blocks, node)
+        return closed, nil
+
+    // -------------------------
+    // responses drop|servfail|nxdomain|bypass
+    // -------------------------
+    case "responses":
+        args, closed := lineArgs(c)
+        if len(args) != 1 {
+            return false, c.ArgErr()
+        }
+        if args[0] == "retry" {
+            if !top {
+                return false, c.Err("responses retry is not allowed inside shadow")
+            }
+            cfg.Action = ActionRetry
+            return closed, nil
+        }
+        action, err := parseAction(c, args[0])
+        if err != nil {
+            return false, err
+        }
+        cfg.Action = action
+        return closed, nil
+
+    // -------------------------
+    // retry UPSTREAM... { fallback ACTION  timeout DURATION  tls_servername NAME }
+    // -------------------------
+    case "retry":
+        if !top {
+            return false, c.Errf("%s is not allowed inside shadow", c.Val())
+        }
+        if cfg.Retry != nil {
+            return false, c.Err("retry already configured")
+        }
+        args, closed := lineArgs(c)
+        if len(args) == 0 {
+            return false, c.ArgErr()
+        }
+        rt := &Retry{Upstreams: args, Fallback: ActionServfail, Timeout: defaultResolverTimeout}
+        if _, err := newResolver(rt.Upstreams, "", rt.Timeout, false); err != nil {
+            return false, c.Err(err.Error())
+        }
+        cfg.Retry = rt
+        if closed {
+            return true, nil
+        }
+        return false, nestedBlock(c, func() (bool, error) {
+            opt := c.Val()
+            args, closed := lineArgs(c)
+            if len(args) != 1 {
+                return false, c.ArgErr()
+            }
+            switch opt {
+            case "fallback":
+                action, err := parseAction(c, args[0])
+                if err != nil {
+                    return false, err
                 }
-                cidr := args[0]
-
-                node := &BlockNode{
-                    Kind:  RuleInclude,
-                    Value: cidr,
+                if action == ActionBypass {
+                    return false, c.Err("retry fallback cannot be bypass")
                 }
-
-                if c.NextBlock() {
-                    for {
-                        switch c.Val() {
-                        case "exclude":
-                            exArgs := c.RemainingArgs()
-                            if len(exArgs) != 1 {
-                                return nil, c.ArgErr()
-                            }
-                            node.Excl = append(node.Excl, exArgs[0])
-
-                        default:
-                            return nil, c.Errf("unknown directive %q inside block %q", c.Val(), cidr)
-                        }
-
-                        if !c.NextBlock() {
-                            break
-                        }
+                rt.Fallback = action
+            case "timeout":
+                d, err := time.ParseDuration(args[0])
+                if err != nil || d <= 0 {
+                    return false, c.Errf("invalid retry timeout %q", args[0])
+                }
+                rt.Timeout = d
+            case "tls_servername":
+                rt.TLSServerName = args[0]
+            default:
+                return false, c.Errf("unknown directive %q inside retry", opt)
+            }
+            return closed, nil
+        })
+
+    // -------------------------
+    // ptr drop|servfail|nxdomain|bypass
+    // -------------------------
+    case "ptr":
+        if !top {
+            return false, c.Errf("%s is not allowed inside shadow", c.Val())
+        }
+        args, closed := lineArgs(c)
+        if len(args) != 1 {
+            return false, c.ArgErr()
+        }
+        action, err := parseAction(c, args[0])
+        if err != nil {
+            return false, err
+        }
+        cfg.PTR = true
+        cfg.PTRAction = action
+        return closed, nil
+
+    // -------------------------
+    // drop_stream close|servfail
+    // -------------------------
+    case "drop_stream":
+        if !top {
+            return false, c.Errf("%s is not allowed inside shadow", c.Val())
+        }
+        args, closed := lineArgs(c)
+        if len(args) != 1 {
+            return false, c.ArgErr()
+        }
+        switch args[0] {
+        case "close":
+            cfg.DropStream = DropClose
+        case "servfail":
+            cfg.DropStream = DropServfail
+        default:
+            return false, c.Errf("invalid drop_stream mode: %s", args[0])
+        }
+        return closed, nil
+
+    // -------------------------
+    // ttl MIN MAX [clamp|reject]
+    // -------------------------
+    case "ttl":
+        if !top {
+            return false, c.Errf("%s is not allowed inside shadow", c.Val())
+        }
+        args, closed := lineArgs(c)
+        if len(args) != 2 && len(args) != 3 {
+            return false, c.ArgErr()
+        }
+        lo, err := strconv.ParseUint(args[0], 10, 32)
+        if err != nil {
+            return false, c.Errf("invalid ttl minimum %q: %v", args[0], err)
+        }
+        hi, err := strconv.ParseUint(args[1], 10, 32)
+        if err != nil {
+            return false, c.Errf("invalid ttl maximum %q: %v", args[1], err)
+        }
+        if lo > hi {
+            return false, c.Errf("ttl minimum %d is greater than maximum %d", lo, hi)
+        }
+        t := &TTLWindow{Min: uint32(lo), Max: uint32(hi)}
+        if len(args) == 3 {
+            switch args[2] {
+            case "clamp":
+            case "reject":
+                t.Reject = true
+            default:
+                return false, c.Errf("invalid ttl mode: %s", args[2])
+            }
+        }
+        cfg.TTL = t
+        return closed, nil
+
+    // -------------------------
+    // negative_ttl SECONDS
+    // -------------------------
+    case "negative_ttl":
+        if !top {
+            return false, c.Errf("%s is not allowed inside shadow", c.Val())
+        }
+        args, closed := lineArgs(c)
+        if len(args) != 1 {
+            return false, c.ArgErr()
+        }
+        v, err := strconv.ParseUint(args[0], 10, 32)
+        if err != nil {
+            return false, c.Errf("invalid negative_ttl %q: %v", args[0], err)
+        }
+        cfg.NegativeTTL = uint32(v)
+        return closed, nil
+
+    // -------------------------
+    // embedded_ipv4 [NAT64-PREFIX...]
+    // -------------------------
+    case "embedded_ipv4":
+        if !top {
+            return false, c.Errf("%s is not allowed inside shadow", c.Val())
+        }
+        args, closed := lineArgs(c)
+        for _, a := range args {
+            if _, err := parseNAT64Prefix(a); err != nil {
+                return false, c.Err(err.Error())
+            }
+        }
+        cfg.EmbeddedIPv4 = true
+        cfg.NAT64 = append(cfg.NAT64, args...)
+        return closed, nil
+
+    // -------------------------
+    // local_zones
+    // -------------------------
+    case "local_zones":
+        if !top {
+            return false, c.Errf("%s is not allowed inside shadow", c.Val())
+        }
+        args, closed := lineArgs(c)
+        if len(args) != 0 {
+            return false, c.ArgErr()
+        }
+        cfg.LocalZones = true
+        return closed, nil
+
+    // -------------------------
+    // verify UPSTREAM... { timeout DURATION  tls_servername NAME  cache SIZE [MAX_TTL]  on_error block|pass }
+    // -------------------------
+    case "verify":
+        if !top {
+            return false, c.Errf("%s is not allowed inside shadow", c.Val())
+        }
+        if cfg.Verify != nil {
+            return false, c.Err("verify already configured")
+        }
+        args, closed := lineArgs(c)
+        if len(args) == 0 {
+            return false, c.ArgErr()
+        }
+        v := &Verify{
+            Upstreams: args,
+            Timeout:   defaultResolverTimeout,
+            CacheSize: defaultVerifyCacheSize,
+            CacheTTL:  defaultVerifyCacheTTL,
+        }
+        if _, err := newResolver(v.Upstreams, "", v.Timeout, true); err != nil {
+            return false, c.Err(err.Error())
+        }
+        cfg.Verify = v
+        if closed {
+            return true, nil
+        }
+        return false, nestedBlock(c, func() (bool, error) {
+            opt := c.Val()
+            args, closed := lineArgs(c)
+            switch {
+            case opt == "cache" && (len(args) == 1 || len(args) == 2):
+                n, err := strconv.Atoi(args[0])
+                if err != nil || n < 0 {
+                    return false, c.Errf("invalid verify cache size %q", args[0])
+                }
+                v.CacheSize = n
+                if len(args) == 2 {
+                    d, err := time.ParseDuration(args[1])
+                    if err != nil || d <= 0 {
+                        return false, c.Errf("invalid verify cache ttl %q", args[1])
                     }
+                    v.CacheTTL = d
                 }
-
-                cfg.Blocks = append(cfg.Blocks, node)
-
-            // -------------------------
-            // responses drop|servfail|nxdomain|bypass
-            // -------------------------
-            case "responses":
-                args := c.RemainingArgs()
-                if len(args) != 1 {
-                    return nil, c.ArgErr()
+            case len(args) != 1:
+                return false, c.ArgErr()
+            case opt == "timeout":
+                d, err := time.ParseDuration(args[0])
+                if err != nil || d <= 0 {
+                    return false, c.Errf("invalid verify timeout %q", args[0])
                 }
+                v.Timeout = d
+            case opt == "tls_servername":
+                v.TLSServerName = args[0]
+            case opt == "on_error":
                 switch args[0] {
-                case "drop":
-                    cfg.Action = ActionDrop
-                case "servfail":
-                    cfg.Action = ActionServfail
-                case "nxdomain":
-                    cfg.Action = ActionNxdomain
-                case "bypass":
-                    cfg.Action = ActionBypass
+                case "block":
+                    v.PassOnError = false
+                case "pass":
+                    v.PassOnError = true
                 default:
-                    return nil, c.Errf("invalid responses action: %s", args[0])
+                    return false, c.Errf("invalid verify on_error %q", args[0])
                 }
-
             default:
-                return nil, c.Errf("unknown directive: %s", c.Val())
+                return false, c.Errf("unknown directive %q inside verify", opt)
+            }
+            return closed, nil
+        })
+
+    // -------------------------
+    // verdict_cache SIZE
+    // -------------------------
+    case "verdict_cache":
+        if !top {
+            return false, c.Errf("%s is not allowed inside shadow", c.Val())
+        }
+        args, closed := lineArgs(c)
+        if len(args) != 1 {
+            return false, c.ArgErr()
+        }
+        n, err := strconv.Atoi(args[0])
+        if err != nil || n < 0 {
+            return false, c.Errf("invalid verdict_cache size %q", args[0])
+        }
+        cfg.VerdictCache = n
+        return closed, nil
+
+    // -------------------------
+    // cache_blocked SIZE [MAX_TTL]
+    // -------------------------
+    case "cache_blocked":
+        if !top {
+            return false, c.Errf("%s is not allowed inside shadow", c.Val())
+        }
+        args, closed := lineArgs(c)
+        if len(args) < 1 || len(args) > 2 {
+            return false, c.ArgErr()
+        }
+        n, err := strconv.Atoi(args[0])
+        if err != nil || n < 0 {
+            return false, c.Errf("invalid cache_blocked size %q", args[0])
+        }
+        cfg.BlockedCache = n
+        if len(args) == 2 {
+            d, err := time.ParseDuration(args[1])
+            if err != nil || d <= 0 {
+                return false, c.Errf("invalid cache_blocked ttl %q", args[1])
+            }
+            cfg.BlockedCacheTTL = d
+        }
+        return closed, nil
+
+    // -------------------------
+    // order_check warn|fail|off
+    // -------------------------
+    case "order_check":
+        if !top {
+            return false, c.Errf("%s is not allowed inside shadow", c.Val())
+        }
+        args, closed := lineArgs(c)
+        if len(args) != 1 {
+            return false, c.ArgErr()
+        }
+        switch args[0] {
+        case "warn":
+            cfg.OrderCheck = OrderWarn
+        case "fail":
+            cfg.OrderCheck = OrderFail
+        case "off":
+            cfg.OrderCheck = OrderOff
+        default:
+            return false, c.Errf("invalid order_check mode: %s", args[0])
+        }
+        return closed, nil
+
+    // -------------------------
+    // introspect [ADDR]
+    // -------------------------
+    case "introspect":
+        if !top {
+            return false, c.Errf("%s is not allowed inside shadow", c.Val())
+        }
+        if cfg.Introspect != nil {
+            return false, c.Err("introspect already configured")
+        }
+        args, closed := lineArgs(c)
+        if len(args) > 1 {
+            return false, c.ArgErr()
+        }
+        i := &Introspect{Addr: defaultIntrospectAddr}
+        if len(args) == 1 {
+            i.Addr = args[0]
+        }
+        if err := checkIntrospectAddr(i.Addr); err != nil {
+            return false, c.Err(err.Error())
+        }
+        cfg.Introspect = i
+        return closed, nil
+
+    // -------------------------
+    // quarantine DIR { max_size SIZE  max_age DURATION }
+    // -------------------------
+    case "quarantine":
+        if !top {
+            return false, c.Errf("%s is not allowed inside shadow", c.Val())
+        }
+        if cfg.Quarantine != nil {
+            return false, c.Err("quarantine already configured")
+        }
+        args, closed := lineArgs(c)
+        if len(args) != 1 {
+            return false, c.ArgErr()
+        }
+        q := &Quarantine{Dir: args[0], MaxSize: defaultQuarantineSize}
+        cfg.Quarantine = q
+        if closed {
+            return true, nil
+        }
+        return false, nestedBlock(c, func() (bool, error) {
+            opt := c.Val()
+            args, closed := lineArgs(c)
+            if len(args) != 1 {
+                return false, c.ArgErr()
+            }
+            switch opt {
+            case "max_size":
+                v, err := parseSize(args[0])
+                if err != nil {
+                    return false, c.Err(err.Error())
+                }
+                q.MaxSize = v
+            case "max_age":
+                d, err := time.ParseDuration(args[0])
+                if err != nil || d <= 0 {
+                    return false, c.Errf("invalid max_age %q", args[0])
+                }
+                q.MaxAge = d
+            default:
+                return false, c.Errf("unknown directive %q inside quarantine", opt)
             }
+            return closed, nil
+        })
+
+    // -------------------------
+    // upstreams [unhealthy N [WINDOW]]
+    // -------------------------
+    case "upstreams":
+        if !top {
+            return false, c.Errf("%s is not allowed inside shadow", c.Val())
         }
+        args, closed := lineArgs(c)
+        u := &Upstreams{Window: defaultUpstreamWindow}
+        switch {
+        case len(args) == 0:
+        case args[0] == "unhealthy" && (len(args) == 2 || len(args) == 3):
+            n, err := strconv.Atoi(args[1])
+            if err != nil || n <= 0 {
+                return false, c.Errf("invalid unhealthy threshold %q", args[1])
+            }
+            u.Threshold = n
+            if len(args) == 3 {
+                d, err := time.ParseDuration(args[2])
+                if err != nil || d <= 0 {
+                    return false, c.Errf("invalid unhealthy window %q", args[2])
+                }
+                u.Window = d
+            }
+        default:
+            return false, c.ArgErr()
+        }
+        cfg.Upstreams = u
+        return closed, nil
+
+    // -------------------------
+    // shadow { preset ... block ... responses ... }
+    // -------------------------
+    case "shadow":
+        if !top {
+            return false, c.Err("shadow cannot be nested")
+        }
+        if cfg.Shadow != nil {
+            return false, c.Err("shadow already configured")
+        }
+        args, closed := lineArgs(c)
+        if len(args) != 0 || closed {
+            return false, c.ArgErr()
+        }
+
+        inner := &Config{Action: ActionDrop}
+        err := nestedBlock(c, func() (bool, error) {
+            return parseDirective(c, inner, false)
+        })
+        if err != nil {
+            return false, err
+        }
+        if len(inner.Blocks) == 0 {
+            return false, c.Err("shadow requires at least one preset or block")
+        }
+        cfg.Shadow = &Shadow{
+            Action: inner.Action,
+            Blocks: inner.Blocks,
+        }
+        return false, nil
+
+    default:
+        return false, c.Errf("unknown directive: %s", c.Val())
     }
+}
 
-    return cfg, nil
-}
\ No newline at end of file
+// parseAction: drop|servfail|nxdomain|bypass
+func parseAction(c *caddy.Controller, s string) (ResponseAction, error) {
+    switch s {
+    case "drop":
+        return ActionDrop, nil
+    case "servfail":
+        return ActionServfail, nil
+    case "nxdomain":
+        return ActionNxdomain, nil
+    case "bypass":
+        return ActionBypass, nil
+    default:
+        return 0, c.Errf("invalid %s action: %s", c.Val(), s)
+    }
+}
+
+// parseExcludes: 解析 preset/block 的内层 block `{ exclude ... }`
+//
+// 每条 exclude 在解析时校验：必须是合法、规范的 CIDR，包含于 parents 的并集，且不重复；
+// 使 parents 被 exclude 完全覆盖（该节点不阻断任何地址）的那一条报 ErrFullyExcluded。
+func parseExcludes(c *caddy.Controller, cfg *Config, node *BlockNode, parents []netip.Prefix) error {
+    remaining := prefixRanges(parents...)
+    return nestedBlock(c, func() (bool, error) {
+        if c.Val() != "exclude" {
+            return false, c.Errf("unknown directive %q inside %s", c.Val(), node)
+        }
+        args, closed := lineArgs(c)
+        if len(args) != 1 {
+            return false, c.ArgErr()
+        }
+        if node.Kind == RulePreset && node.Value == "none" {
+            return false, c.Err("preset none cannot have exclude")
+        }
+
+        p, err := parsePrefix(args[0])
+        if err != nil {
+            return false, positioned(c, err)
+        }
+        if !prefixWithin(p, parents) {
+            return false, positioned(c, &CIDRError{Kind: ErrNotSubset, CIDR: args[0], Detail: "parent is " + node.String()})
+        }
+        if prev := seenPrefix(&cfg.seenExcludes, p, node); prev != nil {
+            return false, positioned(c, &CIDRError{Kind: ErrDuplicate, CIDR: args[0], Detail: "already excluded in " + prev.String()})
+        }
+        if remaining = remaining.minus(prefixRanges(p)); remaining.empty() {
+            return false, positioned(c, &CIDRError{Kind: ErrFullyExcluded, CIDR: args[0], Detail: node.String() + " blocks nothing"})
+        }
+
+        node.Excl = append(node.Excl, args[0])
+        return closed, nil
+    })
+}
+
+// seenPrefix: 记录前缀的来源节点；已出现过时返回之前的节点
+func seenPrefix(m *map[netip.Prefix]*BlockNode, p netip.Prefix, node *BlockNode) *BlockNode {
+    if *m == nil {
+        *m = make(map[netip.Prefix]*BlockNode)
+    }
+    if prev, ok := (*m)[p]; ok {
+        return prev
+    }
+    (*m)[p] = node
+    return nil
+}
+
+// lineArgs: 读取当前行剩余参数
+//
+// caddy 的 Dispenser 不支持嵌套 block，同一行写法 `{ exclude X }` 中的 "}" 会被
+// RemainingArgs 当作参数读入；这里把它剥离，closed 表示所在 block 已经结束。
+func lineArgs(c *caddy.Controller) ([]string, bool) {
+    args := c.RemainingArgs()
+    if n := len(args); n > 0 && args[n-1] == "}" {
+        return args[:n-1], true
+    }
+    return args, false
+}
+
+// nestedBlock: 解析紧跟在参数之后的内层 block `{ ... }`，对其中每条指令调用 fn
+//
+// 当前行没有 "{" 时直接返回。fn 返回 true 表示它已读到内层 block 的 "}"。
+func nestedBlock(c *caddy.Controller, fn func() (bool, error)) error {
+    // RemainingArgs 在 "{" 之前停下，因此同一行的下一个 token 只可能是 "{"
+    if !c.NextArg() {
+        return nil
+    }
+    if c.Val() != "{" {
+        return c.SyntaxErr("{")
+    }
+
+    for c.Next() {
+        if c.Val() == "}" {
+            return nil
+        }
+        closed, err := fn()
+        if err != nil {
+            return err
+        }
+        if closed {
+            return nil
+        }
+    }
+    return c.EOFErr()
+}
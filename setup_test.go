@@ -0,0 +1,175 @@
+package carbolicacid
+
+import (
+    "errors"
+    "strings"
+    "testing"
+
+    "github.com/coredns/caddy"
+)
+
+func TestParseConfigNestedExcludes(t *testing.T) {
+    c := caddy.NewTestController("dns", `carbolicacid {
+        preset iana {
+            exclude 10.0.0.0/8
+            exclude 127.0.0.1
+        }
+        block 1.2.3.0/24 { exclude 1.2.3.4 }
+        responses nxdomain
+    }`)
+
+    cfg, err := parseConfig(c)
+    if err != nil {
+        t.Fatalf("parseConfig failed: %v", err)
+    }
+    if len(cfg.Blocks) != 2 {
+        t.Fatalf("expected 2 blocks, got %d", len(cfg.Blocks))
+    }
+    if got := cfg.Blocks[0].Excl; len(got) != 2 || got[1] != "127.0.0.1" {
+        t.Fatalf("unexpected preset excludes: %v", got)
+    }
+    if got := cfg.Blocks[1].Excl; len(got) != 1 || got[0] != "1.2.3.4" {
+        t.Fatalf("unexpected block excludes: %v", got)
+    }
+    if cfg.Action != ActionNxdomain {
+        t.Fatalf("expected nxdomain, got %s", cfg.Action)
+    }
+}
+
+func TestParseConfigShadow(t *testing.T) {
+    c := caddy.NewTestController("dns", `carbolicacid {
+        preset iana
+        shadow {
+            preset allip {
+                exclude 8.8.8.0/24
+            }
+            responses servfail
+        }
+    }`)
+
+    cfg, err := parseConfig(c)
+    if err != nil {
+        t.Fatalf("parseConfig failed: %v", err)
+    }
+    if len(cfg.Blocks) != 1 || cfg.Action != ActionDrop {
+        t.Fatalf("shadow directives leaked into enforced config: %v %s", cfg.Blocks, cfg.Action)
+    }
+    if cfg.Shadow == nil {
+        t.Fatalf("expected shadow config")
+    }
+    if cfg.Shadow.Action != ActionServfail || len(cfg.Shadow.Blocks) != 1 || cfg.Shadow.Blocks[0].Excl[0] != "8.8.8.0/24" {
+        t.Fatalf("unexpected shadow config: %+v", cfg.Shadow)
+    }
+}
+
+func TestParseConfigErrors(t *testing.T) {
+    tests := []string{
+        `carbolicacid {
+            preset iana {
+                include 10.0.0.0/8
+            }
+        }`,
+        `carbolicacid {
+            shadow {
+                responses drop
+            }
+        }`,
+        `carbolicacid {
+            shadow {
+                shadow {
+                    preset iana
+                }
+            }
+        }`,
+        `carbolicacid {
+            responses reject
+        }`,
+    }
+
+    for i, input := range tests {
+        c := caddy.NewTestController("dns", input)
+        if _, err := parseConfig(c); err == nil {
+            t.Errorf("test %d: expected error for input %s", i, input)
+        }
+    }
+}
+
+func TestParseConfigCIDRErrors(t *testing.T) {
+    tests := []struct {
+        input string
+        kind  error
+        line  string
+    }{
+        {"carbolicacid {\n    block 10.0.0.0/33\n}", ErrInvalidCIDR, "Testfile:2"},
+        {"carbolicacid {\n    block banana\n}", ErrInvalidCIDR, "Testfile:2"},
+        {"carbolicacid {\n    block fe80::1%eth0\n}", ErrInvalidCIDR, "Testfile:2"},
+        {"carbolicacid {\n    preset iana\n    block 10.1.2.3/8\n}", ErrNonCanonical, "Testfile:3"},
+        {"carbolicacid {\n    block 10.0.0.0/8 {\n        exclude 10.1.0.0/16\n        exclude 192.168.0.0/16\n    }\n}", ErrNotSubset, "Testfile:4"},
+        {"carbolicacid {\n    preset iana {\n        exclude 8.8.8.8\n    }\n}", ErrNotSubset, "Testfile:3"},
+        {"carbolicacid {\n    block 10.0.0.0/8 { exclude 10.1.2.3/8 }\n}", ErrNonCanonical, "Testfile:2"},
+        {"carbolicacid {\n    block 10.0.0.0/8\n    block 10.0.0.0/8\n}", ErrDuplicate, "Testfile:3"},
+        {"carbolicacid {\n    block 10.0.0.0/8 {\n        exclude 10.1.0.0/16\n        exclude 10.1.0.0/16\n    }\n}", ErrDuplicate, "Testfile:4"},
+        {"carbolicacid {\n    block 10.0.0.0/8 { exclude 10.0.0.0/8 }\n}", ErrFullyExcluded, "Testfile:2"},
+        {"carbolicacid {\n    block 10.0.0.0/24 {\n        exclude 10.0.0.0/25\n        exclude 10.0.0.128/25\n    }\n}", ErrFullyExcluded, "Testfile:4"},
+    }
+
+    for i, tc := range tests {
+        _, err := parseConfig(caddy.NewTestController("dns", tc.input))
+        if !errors.Is(err, tc.kind) {
+            t.Errorf("test %d: expected %v, got %v", i, tc.kind, err)
+            continue
+        }
+        var ce *CIDRError
+        if !errors.As(err, &ce) || ce.CIDR == "" {
+            t.Errorf("test %d: expected a *CIDRError, got %T", i, err)
+        }
+        if !strings.HasPrefix(err.Error(), tc.line+" ") {
+            t.Errorf("test %d: expected error at %s, got %q", i, tc.line, err)
+        }
+    }
+}
+
+func TestParseConfigPresetErrors(t *testing.T) {
+    for i, input := range []string{
+        `carbolicacid {
+            preset bogus
+        }`,
+        `carbolicacid {
+            preset iana
+            preset iana
+        }`,
+        `carbolicacid {
+            preset none { exclude 10.0.0.0/8 }
+        }`,
+    } {
+        if _, err := parseConfig(caddy.NewTestController("dns", input)); err == nil {
+            t.Errorf("test %d: expected error for input %s", i, input)
+        }
+    }
+}
+
+// exclude 覆盖整个父节点时 setup 失败（CoreDNS 拒绝启动），而不是在首次初始化时才进入 bypass
+func TestSetupFullyExcluded(t *testing.T) {
+    for i, tc := range []struct {
+        input string
+        line  string
+    }{
+        {"carbolicacid {\n    preset iana\n    block 192.0.2.0/24 {\n        exclude 192.0.2.0/25\n        exclude 192.0.2.128/25\n    }\n}", "Testfile:5"},
+        {"carbolicacid {\n    preset allip {\n        exclude 0.0.0.0/0\n        exclude ::/0\n    }\n}", "Testfile:4"},
+        {"carbolicacid {\n    preset iana\n    shadow {\n        block 10.0.0.0/8 { exclude 10.0.0.0/8 }\n    }\n}", "Testfile:4"},
+    } {
+        err := setup(caddy.NewTestController("dns", tc.input))
+        if !errors.Is(err, ErrFullyExcluded) {
+            t.Errorf("test %d: expected ErrFullyExcluded, got %v", i, err)
+            continue
+        }
+        if !strings.HasPrefix(err.Error(), tc.line+" ") {
+            t.Errorf("test %d: expected error at %s, got %q", i, tc.line, err)
+        }
+    }
+
+    // 只覆盖一部分时照常启动
+    if err := setup(caddy.NewTestController("dns", "carbolicacid {\n    block 10.0.0.0/8 { exclude 10.0.0.0/9 }\n}")); err != nil {
+        t.Fatalf("setup failed: %v", err)
+    }
+}
@@ -0,0 +1,56 @@
+package carbolicacid
+
+import (
+    "github.com/coredns/coredns/plugin/pkg/log"
+    "github.com/miekg/dns"
+)
+
+// Shadow: 影子策略（dry-run）
+//
+// 与生效策略并行评估每个响应，只记录指标和日志，永远不改变应答。
+// 用于在切换到更严格的配置之前比较两者的命中情况。
+type Shadow struct {
+    Action ResponseAction
+    Blocks []*BlockNode
+
+    policy *Policy
+}
+
+// init: 构建影子策略；失败只影响影子策略本身
+//
+// 地址读取方式（embedded_ipv4）沿用生效配置。
+func (s *Shadow) init(c *Config) error {
+    p, err := NewPolicy(s.Blocks, s.Action)
+    if err != nil {
+        return err
+    }
+    if c.EmbeddedIPv4 {
+        if err := p.EnableEmbeddedIPv4(c.NAT64); err != nil {
+            return err
+        }
+    }
+    s.policy = p
+    return nil
+}
+
+// observe: 评估影子策略并记录结果
+//
+// enforced 为生效策略的最终动作（未阻断时为 ActionPass）。
+// 两者结论不一致（一个阻断、一个放行）时输出日志。
+func (s *Shadow) observe(server string, r, resp *dns.Msg, enforced ResponseAction) {
+    if s == nil || s.policy == nil {
+        return
+    }
+
+    action := ActionPass
+    blocked, rule := s.policy.decide(resp)
+    if blocked {
+        action = s.Action
+    }
+
+    shadowCount.WithLabelValues(server, enforced.String(), action.String(), rule.String()).Inc()
+
+    if (action == ActionPass) != (enforced == ActionPass) {
+        log.Infof("[carbolicacid] shadow: %s enforced=%s shadow=%s rule=%q", qname(r), enforced, action, rule.String())
+    }
+}
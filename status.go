@@ -0,0 +1,97 @@
+package carbolicacid
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "time"
+)
+
+// Status: 插件的运行状态，供 ready 检查、其他插件（如自定义健康检查）和运维排查使用
+//
+// 匹配表只在初始化时构建一次，之后只读；配置变更通过 CoreDNS reload 生成新实例，
+// 因此 Status 在初始化完成后不再变化。
+type Status struct {
+    Ready    bool          `json:"ready"`
+    LoadedAt time.Time     `json:"loadedAt"`   // 初始化完成的时间，未初始化时为零值
+    LoadTime time.Duration `json:"loadTimeNs"` // 初始化耗时（匹配表、local zones、retry/verify 上游）
+
+    // Digest: 生效规则（动作 + preset/block/exclude）的摘要，用于确认各实例加载的是同一份策略
+    Digest  string   `json:"digest"`
+    Sources []string `json:"sources"` // 规则来源，按 Corefile 顺序，例如 "preset iana"、"block 10.0.0.0/8"
+
+    // 匹配表的前缀条数
+    BlockListV4 int `json:"blockListV4"`
+    BlockListV6 int `json:"blockListV6"`
+    AllowListV4 int `json:"allowListV4"`
+    AllowListV6 int `json:"allowListV6"`
+
+    LastError string `json:"lastError,omitempty"` // 初始化失败的原因；非空时插件处于 bypass 状态
+}
+
+// Status: 返回插件当前状态；尚未初始化时先完成初始化
+func (c *CarbolicAcid) Status() Status {
+    cfg := c.cfg
+    err := cfg.init()
+
+    s := Status{
+        Ready:    err == nil,
+        LoadedAt: cfg.loadedAt,
+        LoadTime: cfg.loadTime,
+        Digest:   policyDigest(cfg.Action, cfg.Blocks),
+    }
+    for _, b := range cfg.Blocks {
+        s.Sources = append(s.Sources, b.String())
+    }
+    if err != nil {
+        s.LastError = err.Error()
+        return s
+    }
+    s.BlockListV4, s.BlockListV6 = cfg.blockList.size()
+    s.AllowListV4, s.AllowListV6 = cfg.allowList.size()
+    return s
+}
+
+// size: IPv4 / IPv6 前缀条数（nil 表示空表）
+func (s *IPSet) size() (v4, v6 int) {
+    if s == nil {
+        return 0, 0
+    }
+    v4 = len(s.v4.p8) + len(s.v4.p16) + len(s.v4.p24) + len(s.v4.rest)
+    return v4, len(s.v6)
+}
+
+// policyDigest: 动作与 preset/block/exclude 的 SHA-256 前 12 位十六进制
+func policyDigest(action ResponseAction, blocks []*BlockNode) string {
+    h := sha256.New()
+    fmt.Fprintf(h, "responses %s\n", action)
+    for _, b := range blocks {
+        fmt.Fprintf(h, "%s\n", b)
+        for _, ex := range b.Excl {
+            fmt.Fprintf(h, "\texclude %s\n", ex)
+        }
+    }
+    return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// publishStatus: 初始化结束后更新状态指标（由 Config.init 调用）
+func (c *Config) publishStatus() {
+    zone := c.zone
+    if c.initErr != nil {
+        readyGauge.WithLabelValues(zone).Set(0)
+        return
+    }
+    readyGauge.WithLabelValues(zone).Set(1)
+    loadTimestamp.WithLabelValues(zone).Set(float64(c.loadedAt.UnixNano()) / 1e9)
+    loadDuration.WithLabelValues(zone).Set(c.loadTime.Seconds())
+    policyInfo.WithLabelValues(zone, policyDigest(c.Action, c.Blocks)).Set(1)
+
+    for _, t := range []struct {
+        name string
+        set  *IPSet
+    }{{"block", c.blockList}, {"allow", c.allowList}} {
+        v4, v6 := t.set.size()
+        tableEntries.WithLabelValues(zone, t.name, "ipv4").Set(float64(v4))
+        tableEntries.WithLabelValues(zone, t.name, "ipv6").Set(float64(v6))
+    }
+}
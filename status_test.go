@@ -0,0 +1,79 @@
+package carbolicacid
+
+import (
+    "testing"
+
+    "github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestStatusReady(t *testing.T) {
+    ca := &CarbolicAcid{cfg: &Config{
+        Action: ActionNxdomain,
+        Blocks: []*BlockNode{
+            {Kind: RulePreset, Value: "iana", Excl: []string{"10.1.0.0/16"}},
+            {Kind: RuleInclude, Value: "2001:db8:1::/48"},
+        },
+        zone: "status-ready.",
+    }}
+
+    if !ca.Ready() {
+        t.Fatalf("expected ready, status: %+v", ca.Status())
+    }
+
+    s := ca.Status()
+    if !s.Ready || s.LastError != "" || s.LoadedAt.IsZero() {
+        t.Fatalf("unexpected status: %+v", s)
+    }
+    if s.BlockListV4 != len(ianaPresetV4) || s.BlockListV6 != len(ianaPresetV6)+1 {
+        t.Fatalf("unexpected blockList size: v4=%d v6=%d", s.BlockListV4, s.BlockListV6)
+    }
+    if s.AllowListV4 != 1 || s.AllowListV6 != 0 {
+        t.Fatalf("unexpected allowList size: v4=%d v6=%d", s.AllowListV4, s.AllowListV6)
+    }
+    if len(s.Sources) != 2 || s.Sources[0] != "preset iana" || s.Sources[1] != "block 2001:db8:1::/48" {
+        t.Fatalf("unexpected sources: %v", s.Sources)
+    }
+
+    if got := testutil.ToFloat64(readyGauge.WithLabelValues("status-ready.")); got != 1 {
+        t.Fatalf("expected ready gauge 1, got %v", got)
+    }
+    if got := testutil.ToFloat64(tableEntries.WithLabelValues("status-ready.", "allow", "ipv4")); got != 1 {
+        t.Fatalf("expected 1 allowList IPv4 entry, got %v", got)
+    }
+}
+
+func TestStatusInitFailure(t *testing.T) {
+    // 没有任何 preset/block：初始化失败，插件 bypass
+    ca := &CarbolicAcid{cfg: &Config{Action: ActionDrop, zone: "status-failed."}}
+
+    if ca.Ready() {
+        t.Fatal("expected not ready when initialization failed")
+    }
+    s := ca.Status()
+    if s.Ready || s.LastError == "" || !s.LoadedAt.IsZero() {
+        t.Fatalf("unexpected status: %+v", s)
+    }
+    if got := testutil.ToFloat64(readyGauge.WithLabelValues("status-failed.")); got != 0 {
+        t.Fatalf("expected ready gauge 0, got %v", got)
+    }
+}
+
+func TestPolicyDigest(t *testing.T) {
+    blocks := func(ex ...string) []*BlockNode {
+        return []*BlockNode{{Kind: RuleInclude, Value: "10.0.0.0/8", Excl: ex}}
+    }
+
+    a := policyDigest(ActionDrop, blocks("10.1.0.0/16"))
+    if a != policyDigest(ActionDrop, blocks("10.1.0.0/16")) {
+        t.Fatal("digest is not stable")
+    }
+    for name, d := range map[string]string{
+        "action":  policyDigest(ActionNxdomain, blocks("10.1.0.0/16")),
+        "exclude": policyDigest(ActionDrop, blocks("10.2.0.0/16")),
+        "none":    policyDigest(ActionDrop, blocks()),
+    } {
+        if d == a {
+            t.Fatalf("digest unchanged after changing %s", name)
+        }
+    }
+}
@@ -0,0 +1,27 @@
+package carbolicacid
+
+import (
+    "github.com/coredns/coredns/request"
+    "github.com/miekg/dns"
+)
+
+// synthReply: 构造插件自身的合成应答
+//
+// - Question 原样复制，保留客户端的大小写（兼容 0x20 随机大小写）
+// - RA 置位：插件位于递归/转发链路上，与上游应答保持一致
+func synthReply(r *dns.Msg, rcode int) *dns.Msg {
+    m := new(dns.Msg)
+    m.SetRcode(r, rcode)
+    m.RecursionAvailable = true
+    return m
+}
+
+// writeSynth: 写出合成应答
+//
+// 镜像请求的 EDNS0 状态（UDP 缓冲区大小、DO 位、cookie 等受支持的选项），
+// 并按客户端缓冲区裁剪，与 CoreDNS 其他插件的应答保持一致。
+func writeSynth(w dns.ResponseWriter, r, m *dns.Msg) error {
+    state := request.Request{W: w, Req: r}
+    state.SizeAndDo(m)
+    return w.WriteMsg(state.Scrub(m))
+}
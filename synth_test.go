@@ -0,0 +1,136 @@
+package carbolicacid
+
+import (
+    "context"
+    "net"
+    "testing"
+
+    "github.com/miekg/dns"
+)
+
+// wireResponseWriter: 像真实服务器一样把应答打包成报文，测试再解包得到客户端实际收到的内容
+type wireResponseWriter struct {
+    dns.ResponseWriter
+    remote net.Addr
+    wire   []byte
+    closed bool
+}
+
+func (w *wireResponseWriter) WriteMsg(m *dns.Msg) error {
+    buf, err := m.Pack()
+    if err != nil {
+        return err
+    }
+    w.wire = buf
+    return nil
+}
+
+func (w *wireResponseWriter) RemoteAddr() net.Addr { return w.remote }
+
+func (w *wireResponseWriter) LocalAddr() net.Addr {
+    return &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 53}
+}
+
+func (w *wireResponseWriter) Close() error {
+    w.closed = true
+    return nil
+}
+
+func (w *wireResponseWriter) received(t *testing.T) *dns.Msg {
+    t.Helper()
+    if w.wire == nil {
+        t.Fatalf("nothing written to the client")
+    }
+    m := new(dns.Msg)
+    if err := m.Unpack(w.wire); err != nil {
+        t.Fatalf("client cannot decode reply: %v", err)
+    }
+    return m
+}
+
+func ednsQuery(name string, size uint16, do bool, cookie string) *dns.Msg {
+    r := new(dns.Msg)
+    r.SetQuestion(name, dns.TypeA)
+    r.SetEdns0(size, do)
+    if cookie != "" {
+        o := r.IsEdns0()
+        o.Option = append(o.Option, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: cookie})
+    }
+    return r
+}
+
+func blockedServer(action ResponseAction) *CarbolicAcid {
+    cfg := &Config{
+        Blocks: []*BlockNode{
+            {Kind: RuleInclude, Value: "10.0.0.0/8"},
+        },
+        Action:      action,
+        NegativeTTL: 60,
+    }
+    return &CarbolicAcid{Next: &testNext{resp: makeA("example.com.", "10.1.2.3")}, cfg: cfg}
+}
+
+func TestSynthReplyMirrorsEDNS(t *testing.T) {
+    ca := blockedServer(ActionNxdomain)
+
+    w := &wireResponseWriter{remote: &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 53000}}
+    r := ednsQuery("ExAmPlE.CoM.", 1232, true, "0123456789abcdef")
+    if _, err := ca.ServeDNS(context.Background(), w, r); err != nil {
+        t.Fatalf("ServeDNS error: %v", err)
+    }
+
+    m := w.received(t)
+    if m.Rcode != dns.RcodeNameError || !m.Response || !m.RecursionAvailable || !m.RecursionDesired {
+        t.Fatalf("unexpected header: %v", m.MsgHdr)
+    }
+    if m.Id != r.Id {
+        t.Fatalf("id mismatch: %d != %d", m.Id, r.Id)
+    }
+    if len(m.Question) != 1 || m.Question[0].Name != "ExAmPlE.CoM." {
+        t.Fatalf("question casing not preserved: %v", m.Question)
+    }
+
+    opt := m.IsEdns0()
+    if opt == nil {
+        t.Fatalf("reply dropped the client's OPT record")
+    }
+    if opt.UDPSize() != 1232 || !opt.Do() {
+        t.Fatalf("unexpected OPT: size=%d do=%v", opt.UDPSize(), opt.Do())
+    }
+    var cookie bool
+    for _, o := range opt.Option {
+        if c, ok := o.(*dns.EDNS0_COOKIE); ok && c.Cookie == "0123456789abcdef" {
+            cookie = true
+        }
+    }
+    if !cookie {
+        t.Fatalf("reply dropped the client cookie: %v", opt.Option)
+    }
+    if len(m.Ns) != 1 || m.Ns[0].Header().Rrtype != dns.TypeSOA {
+        t.Fatalf("expected negative-cache SOA, got %v", m.Ns)
+    }
+}
+
+// 通过真实的 CoreDNS 服务器发送查询，解码 TCP 连接上收到的全部报文：
+// 合成的 SERVFAIL 只能写出一次，服务器不能再追加自己的 SERVFAIL。
+func TestSynthReplyWithoutEDNS(t *testing.T) {
+    skipIntegration(t)
+    placeDirective(t, "forward", false)
+    up := newScriptedUpstream(t, integrationAnswers)
+    _, tcp := startCoreDNS(t, integrationCorefile(up.addr, "servfail", false))
+
+    r := new(dns.Msg)
+    r.SetQuestion("poisoned.example.", dns.TypeA)
+    replies := exchangeTCP(t, tcp, r)
+    if len(replies) != 1 {
+        t.Fatalf("client received %d messages, want exactly one: %v", len(replies), replies)
+    }
+
+    m := replies[0]
+    if m.Id != r.Id || m.Rcode != dns.RcodeServerFailure || !m.RecursionAvailable {
+        t.Fatalf("unexpected header: %v", m.MsgHdr)
+    }
+    if m.IsEdns0() != nil {
+        t.Fatalf("reply must not carry OPT when the query had none")
+    }
+}
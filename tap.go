@@ -0,0 +1,89 @@
+package carbolicacid
+
+import (
+    "context"
+    "time"
+
+    "github.com/coredns/coredns/plugin/dnstap"
+    "github.com/coredns/coredns/plugin/dnstap/msg"
+    "github.com/coredns/coredns/plugin/metadata"
+    "github.com/coredns/coredns/request"
+
+    tap "github.com/dnstap/golang-dnstap"
+    "github.com/miekg/dns"
+)
+
+// tapper: dnstap 插件中本插件用到的部分，便于测试替换
+type tapper interface {
+    TapMessageWithMetadata(ctx context.Context, m *tap.Message, state request.Request)
+}
+
+// setTapPlugin: 记录 dnstap 插件（及其后串联的 dnstap 插件），与 forward 插件一致
+func (c *CarbolicAcid) setTapPlugin(t *dnstap.Dnstap) {
+    c.taps = append(c.taps, t)
+    if next, ok := t.Next.(*dnstap.Dnstap); ok {
+        c.setTapPlugin(next)
+    }
+}
+
+// replyRecorder: 记录写给客户端的合成应答，同时照常写出
+type replyRecorder struct {
+    dns.ResponseWriter
+    msg *dns.Msg
+}
+
+func (r *replyRecorder) WriteMsg(m *dns.Msg) error {
+    r.msg = m
+    return r.ResponseWriter.WriteMsg(m)
+}
+
+// tapIntercepted: 为被拦截的响应输出 dnstap 消息
+//
+// - upstream：上游返回的原始（被投毒）响应，类型 FORWARDER_RESPONSE
+// - reply：实际写给客户端的应答，类型 CLIENT_RESPONSE；drop 时为 nil
+//
+// 两条消息都带原始报文，并通过 metadata 标记 carbolicacid/stage（upstream|reply）、
+// carbolicacid/action、carbolicacid/rule。dnstap 插件配置 extra 格式
+// （如 "{/carbolicacid/stage} {/carbolicacid/rule}"）后即写入 Extra 字段。
+func (c *CarbolicAcid) tapIntercepted(ctx context.Context, w dns.ResponseWriter, r, upstream, reply *dns.Msg, action ResponseAction, rule string, start time.Time) {
+    if len(c.taps) == 0 {
+        return
+    }
+
+    // 未启用 metadata 插件时自建 metadata 上下文，保证 extra 中的占位符可用
+    if metadata.ValueFuncs(ctx) == nil {
+        ctx = metadata.ContextWithMetadata(ctx)
+    }
+    setMetadata(ctx, action, rule)
+
+    state := request.Request{W: w, Req: r}
+    now := time.Now()
+
+    emit := func(stage string, m *dns.Msg, typ tap.Message_Type) {
+        buf, err := m.Pack()
+        if err != nil {
+            return
+        }
+        metadata.SetValueFunc(ctx, "carbolicacid/stage", func() string { return stage })
+
+        for _, t := range c.taps {
+            tm := new(tap.Message)
+            msg.SetType(tm, typ)
+            msg.SetQueryTime(tm, start)
+            msg.SetResponseTime(tm, now)
+            msg.SetQueryAddress(tm, w.RemoteAddr())
+            if typ == tap.Message_CLIENT_RESPONSE {
+                msg.SetResponseAddress(tm, w.LocalAddr())
+            }
+            tm.ResponseMessage = buf
+            t.TapMessageWithMetadata(ctx, tm, state)
+        }
+    }
+
+    if upstream != nil {
+        emit("upstream", upstream, tap.Message_FORWARDER_RESPONSE)
+    }
+    if reply != nil {
+        emit("reply", reply, tap.Message_CLIENT_RESPONSE)
+    }
+}
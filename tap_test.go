@@ -0,0 +1,78 @@
+package carbolicacid
+
+import (
+    "context"
+    "net"
+    "testing"
+
+    "github.com/coredns/coredns/plugin/metadata"
+    "github.com/coredns/coredns/request"
+
+    tap "github.com/dnstap/golang-dnstap"
+    "github.com/miekg/dns"
+)
+
+// fakeTapper: 记录收到的 dnstap 消息，以及当时 metadata 中的标记
+type fakeTapper struct {
+    msgs  []*tap.Message
+    extra []string
+}
+
+func (f *fakeTapper) TapMessageWithMetadata(ctx context.Context, m *tap.Message, state request.Request) {
+    f.msgs = append(f.msgs, m)
+    var extra string
+    for _, l := range []string{"carbolicacid/stage", "carbolicacid/action", "carbolicacid/rule"} {
+        if fn := metadata.ValueFunc(ctx, l); fn != nil {
+            extra += fn() + "|"
+        }
+    }
+    f.extra = append(f.extra, extra)
+}
+
+func TestTapIntercepted(t *testing.T) {
+    ft := &fakeTapper{}
+    ca := blockedServer(ActionNxdomain)
+    ca.taps = []tapper{ft}
+
+    w := &wireResponseWriter{remote: &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 53000}}
+    r := new(dns.Msg)
+    r.SetQuestion("example.com.", dns.TypeA)
+    if _, err := ca.ServeDNS(context.Background(), w, r); err != nil {
+        t.Fatalf("ServeDNS error: %v", err)
+    }
+
+    if len(ft.msgs) != 2 {
+        t.Fatalf("expected upstream + reply dnstap messages, got %d", len(ft.msgs))
+    }
+    if *ft.msgs[0].Type != tap.Message_FORWARDER_RESPONSE || *ft.msgs[1].Type != tap.Message_CLIENT_RESPONSE {
+        t.Fatalf("unexpected dnstap types: %v, %v", ft.msgs[0].Type, ft.msgs[1].Type)
+    }
+    if ft.extra[0] != "upstream|nxdomain|block 10.0.0.0/8|" || ft.extra[1] != "reply|nxdomain|block 10.0.0.0/8|" {
+        t.Fatalf("unexpected tags: %q", ft.extra)
+    }
+
+    // 原始报文：上游的投毒响应与实际写给客户端的应答
+    up := new(dns.Msg)
+    if err := up.Unpack(ft.msgs[0].ResponseMessage); err != nil || len(up.Answer) != 1 {
+        t.Fatalf("upstream message not recorded: %v", err)
+    }
+    reply := new(dns.Msg)
+    if err := reply.Unpack(ft.msgs[1].ResponseMessage); err != nil || reply.Rcode != dns.RcodeNameError {
+        t.Fatalf("reply message not recorded: %v", err)
+    }
+}
+
+func TestTapNotEmittedForPassingResponses(t *testing.T) {
+    ft := &fakeTapper{}
+    ca := blockedServer(ActionNxdomain)
+    ca.Next = &testNext{resp: makeA("example.com.", "1.1.1.1")}
+    ca.taps = []tapper{ft}
+
+    rw := &testResponseWriter{}
+    if _, err := ca.ServeDNS(context.Background(), rw, makeA("example.com.", "1.1.1.1")); err != nil {
+        t.Fatalf("ServeDNS error: %v", err)
+    }
+    if len(ft.msgs) != 0 {
+        t.Fatalf("passing responses must not be tapped, got %d messages", len(ft.msgs))
+    }
+}
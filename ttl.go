@@ -0,0 +1,93 @@
+package carbolicacid
+
+import (
+    "github.com/miekg/dns"
+)
+
+// TTLWindow: 应答 TTL 的允许范围
+//
+// 投毒应答常伴随异常的 TTL。Reject 为 false 时把超出范围的 TTL 修正到边界，
+// 为 true 时把整个应答视为被阻断，按 responses 动作处理。
+type TTLWindow struct {
+    Min    uint32
+    Max    uint32
+    Reject bool
+}
+
+// outside: 应答中是否有 TTL 超出范围的记录
+func (t *TTLWindow) outside(m *dns.Msg) bool {
+    if t == nil || m == nil {
+        return false
+    }
+    for _, sec := range [][]dns.RR{m.Answer, m.Ns, m.Extra} {
+        for _, rr := range sec {
+            h := rr.Header()
+            if h.Rrtype == dns.TypeOPT {
+                continue
+            }
+            if h.Ttl < t.Min || h.Ttl > t.Max {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// clamp: 把所有记录的 TTL 修正到范围内
+func (t *TTLWindow) clamp(m *dns.Msg) {
+    if t == nil || m == nil {
+        return
+    }
+    for _, sec := range [][]dns.RR{m.Answer, m.Ns, m.Extra} {
+        for _, rr := range sec {
+            h := rr.Header()
+            if h.Rrtype == dns.TypeOPT {
+                continue
+            }
+            h.Ttl = t.clampValue(h.Ttl)
+            if soa, ok := rr.(*dns.SOA); ok {
+                soa.Minttl = t.clampValue(soa.Minttl)
+            }
+        }
+    }
+}
+
+func (t *TTLWindow) clampValue(v uint32) uint32 {
+    if t == nil {
+        return v
+    }
+    if v < t.Min {
+        return t.Min
+    }
+    if v > t.Max {
+        return t.Max
+    }
+    return v
+}
+
+// negativeZone: 否定缓存 SOA 的 owner
+//
+// 被阻断的名称不存在于任何区中，SOA 挂在插件所知的最近上级区：包含 name 的 server block zone，
+// 否则为根区 "."；不使用 qname 本身，避免把不存在的名称当作区顶点。
+func negativeZone(zone, name string) string {
+    if zone != "" && dns.IsSubDomain(zone, name) {
+        return dns.Fqdn(zone)
+    }
+    return "."
+}
+
+// negativeSOA: 插件自身 NXDOMAIN/NODATA 应答的 SOA，供下游缓存计算否定 TTL（RFC 2308）
+//
+// name 为 SOA 的 owner（区顶点）。
+func negativeSOA(name string, ttl uint32) *dns.SOA {
+    return &dns.SOA{
+        Hdr:     dns.RR_Header{Name: name, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: ttl},
+        Ns:      "ns.carbolicacid.invalid.",
+        Mbox:    localZoneMbox,
+        Serial:  1,
+        Refresh: localZoneRefresh,
+        Retry:   localZoneRetry,
+        Expire:  localZoneExpire,
+        Minttl:  ttl,
+    }
+}
@@ -0,0 +1,117 @@
+package carbolicacid
+
+import (
+    "context"
+    "testing"
+
+    "github.com/coredns/caddy"
+    "github.com/miekg/dns"
+)
+
+func TestTTLClamp(t *testing.T) {
+    cfg := &Config{
+        Blocks: []*BlockNode{
+            {Kind: RuleInclude, Value: "10.0.0.0/8"},
+        },
+        Action: ActionNxdomain,
+        TTL:    &TTLWindow{Min: 30, Max: 3600},
+    }
+
+    resp := makeA("example.com.", "1.1.1.1")
+    resp.Answer[0].Header().Ttl = 604800
+
+    next := &testNext{resp: resp}
+    ca := &CarbolicAcid{Next: next, cfg: cfg}
+
+    rw := &testResponseWriter{}
+    if _, err := ca.ServeDNS(context.Background(), rw, makeA("example.com.", "1.1.1.1")); err != nil {
+        t.Fatalf("ServeDNS error: %v", err)
+    }
+    if rw.msg == nil || rw.msg.Answer[0].Header().Ttl != 3600 {
+        t.Fatalf("expected TTL to be clamped to 3600, got %v", rw.msg)
+    }
+}
+
+func TestTTLReject(t *testing.T) {
+    cfg := &Config{
+        Blocks: []*BlockNode{
+            {Kind: RuleInclude, Value: "10.0.0.0/8"},
+        },
+        Action:      ActionNxdomain,
+        TTL:         &TTLWindow{Min: 30, Max: 3600, Reject: true},
+        NegativeTTL: 7200,
+    }
+
+    resp := makeA("example.com.", "1.1.1.1")
+    resp.Answer[0].Header().Ttl = 1
+
+    next := &testNext{resp: resp}
+    ca := &CarbolicAcid{Next: next, cfg: cfg}
+
+    r := new(dns.Msg)
+    r.SetQuestion("example.com.", dns.TypeA)
+
+    rw := &testResponseWriter{}
+    rc, err := ca.ServeDNS(context.Background(), rw, r)
+    if err != nil {
+        t.Fatalf("ServeDNS error: %v", err)
+    }
+    if rc != dns.RcodeNameError {
+        t.Fatalf("expected NXDOMAIN for out-of-window TTL, got %d", rc)
+    }
+
+    // 否定缓存 SOA，TTL 同样受范围约束
+    if len(rw.msg.Ns) != 1 {
+        t.Fatalf("expected negative-cache SOA in authority section")
+    }
+    soa, ok := rw.msg.Ns[0].(*dns.SOA)
+    if !ok || soa.Hdr.Ttl != 3600 || soa.Minttl != 3600 {
+        t.Fatalf("unexpected SOA: %v", rw.msg.Ns[0])
+    }
+}
+
+func TestNegativeSOA(t *testing.T) {
+    cfg, err := parseConfig(caddy.NewTestController("dns", "carbolicacid {\n    block 10.0.0.0/8\n    responses nxdomain\n}"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if cfg.NegativeTTL != 0 {
+        t.Fatalf("negative_ttl must default to off, got %d", cfg.NegativeTTL)
+    }
+
+    tests := []struct {
+        zone, qname string
+        negTTL      uint32
+        owner       string // "" 表示不附带 SOA
+    }{
+        {"example.com.", "www.example.com.", 0, ""},
+        {"example.com.", "www.Example.COM.", 300, "example.com."},
+        {"example.com.", "example.com.", 300, "example.com."},
+        {"example.org.", "www.example.com.", 300, "."},
+        {".", "www.example.com.", 300, "."},
+        {"", "www.example.com.", 300, "."},
+    }
+    for _, tc := range tests {
+        cfg := &Config{
+            Blocks:      []*BlockNode{{Kind: RuleInclude, Value: "10.0.0.0/8"}},
+            Action:      ActionNxdomain,
+            NegativeTTL: tc.negTTL,
+            zone:        tc.zone,
+        }
+        ca := &CarbolicAcid{Next: &testNext{resp: makeA(tc.qname, "10.1.2.3")}, cfg: cfg}
+
+        rw := &testResponseWriter{}
+        if _, err := ca.ServeDNS(context.Background(), rw, makeA(tc.qname, "10.1.2.3")); err != nil {
+            t.Fatalf("ServeDNS error: %v", err)
+        }
+        if tc.owner == "" {
+            if len(rw.msg.Ns) != 0 {
+                t.Errorf("%s: expected no SOA, got %v", tc.qname, rw.msg.Ns)
+            }
+            continue
+        }
+        if len(rw.msg.Ns) != 1 || rw.msg.Ns[0].Header().Name != tc.owner || rw.msg.Ns[0].Header().Ttl != tc.negTTL {
+            t.Errorf("zone %q, %s: expected SOA owned by %s, got %v", tc.zone, tc.qname, tc.owner, rw.msg.Ns)
+        }
+    }
+}
@@ -1,7 +1,11 @@
 package carbolicacid
 
 import (
+    "encoding/binary"
+    "fmt"
     "net"
+    "net/netip"
+    "sort"
 
     "github.com/miekg/dns"
 )
@@ -10,19 +14,66 @@ import (
 type IPv4CIDR struct {
     shifted uint32
     shift   uint8
+    rule    uint32 // 来源规则在 rules 中的下标
 }
 
 // IPv6CIDR: shiftedHi/shiftedLo 预右移，高效匹配
 type IPv6CIDR struct {
     shiftedHi uint64
     shiftedLo uint64
-    prefix    uint8 // 0–128
+    prefix    uint8  // 0–128
+    rule      uint32 // 来源规则在 rules 中的下标
+}
+
+// Rule: 表条目的来源 —— 哪个 BlockNode 的哪一条 CIDR
+type Rule struct {
+    Node    *BlockNode // 所属 preset/block 节点
+    CIDR    string     // 具体前缀：preset 展开后的前缀、block 值或 exclude 值
+    Exclude bool       // true: 来自 exclude（allowList 条目）
+}
+
+// String: 用于日志，例如 "preset iana 127.0.0.0/8" / "block 1.2.3.0/24 exclude 1.2.3.4/32"
+func (r *Rule) String() string {
+    if r == nil {
+        return ""
+    }
+    s := r.Node.String()
+    if r.Exclude {
+        return s + " exclude " + r.CIDR
+    }
+    if r.Node.Kind == RulePreset {
+        return s + " " + r.CIDR
+    }
+    return s
 }
 
 // CIDRSet: 初始化阶段使用
 type CIDRSet struct {
-    v4 []IPv4CIDR
-    v6 []IPv6CIDR
+    v4    []IPv4CIDR
+    v6    []IPv6CIDR
+    rules []Rule
+}
+
+// addRule: 解析规则的 CIDR 并打上来源标记
+func (cs *CIDRSet) addRule(r Rule) error {
+    p, err := parsePrefix(r.CIDR)
+    if err != nil {
+        return fmt.Errorf("%s: %w", r.Node, err)
+    }
+
+    idx := uint32(len(cs.rules))
+    cs.rules = append(cs.rules, r)
+
+    if p.Addr().Is4() {
+        c := v4CIDR(p)
+        c.rule = idx
+        cs.v4 = append(cs.v4, c)
+    } else {
+        c := v6CIDR(p)
+        c.rule = idx
+        cs.v6 = append(cs.v6, c)
+    }
+    return nil
 }
 
 // IPv4PrefixBuckets: 按常见前缀分类的桶，ServeDNS 热点路径使用
@@ -35,8 +86,9 @@ type IPv4PrefixBuckets struct {
 
 // IPSet: ServeDNS 热点路径使用
 type IPSet struct {
-    v4 IPv4PrefixBuckets
-    v6 []IPv6CIDR
+    v4    IPv4PrefixBuckets
+    v6    []IPv6CIDR
+    rules []Rule
 }
 
 // ----------------- 工具函数（初始化用） -----------------
@@ -59,84 +111,155 @@ func ipv6ToUint128(ip net.IP) (hi, lo uint64) {
 
 // HasAny: 判断 DNS 响应中是否包含任意匹配的 IP
 func (s *IPSet) HasAny(m *dns.Msg) bool {
+    return s.FirstMatch(m) != nil
+}
+
+// FirstMatch: 返回响应中第一条命中记录的来源规则，未命中返回 nil
+func (s *IPSet) FirstMatch(m *dns.Msg) *Rule {
     if s == nil {
-        return false
+        return nil
     }
     if m == nil || len(m.Answer) == 0 {
-        return false
+        return nil
     }
 
     for _, rr := range m.Answer {
-        switch a := rr.(type) {
-        case *dns.A:
-            if matchIPv4(a.A, s) {
-                return true
-            }
-        case *dns.AAAA:
-            if matchIPv6(a.AAAA, s) {
-                return true
-            }
+        if r := s.lookupRR(rr); r != nil {
+            return r
+        }
+    }
+    return nil
+}
+
+// lookupRR: 单条 RR 匹配；非 A/AAAA 记录返回 nil
+func (s *IPSet) lookupRR(rr dns.RR) *Rule {
+    if s == nil {
+        return nil
+    }
+    switch a := rr.(type) {
+    case *dns.A:
+        return s.lookupIPv4(a.A)
+    case *dns.AAAA:
+        return s.lookupIPv6(a.AAAA)
+    }
+    return nil
+}
+
+// lookupAddr: 单个地址匹配，IPv4/IPv6 按地址族区分（不做 Unmap）
+func (s *IPSet) lookupAddr(a netip.Addr) *Rule {
+    if s == nil {
+        return nil
+    }
+    if a.Is4() {
+        b := a.As4()
+        return s.lookupV4(binary.BigEndian.Uint32(b[:]))
+    }
+    if a.Is6() {
+        return s.lookupV6(addrToUint128(a))
+    }
+    return nil
+}
+
+// sorted: 全部规则，IPv4 在前，按地址和前缀长度排序（用于展示，不在热点路径使用）
+func (s *IPSet) sorted() []*Rule {
+    if s == nil {
+        return []*Rule{}
+    }
+    type entry struct {
+        p netip.Prefix
+        r *Rule
+    }
+    entries := make([]entry, len(s.rules))
+    for i := range s.rules {
+        p, _ := parsePrefix(s.rules[i].CIDR) // 构建时已校验
+        entries[i] = entry{p, &s.rules[i]}
+    }
+    sort.SliceStable(entries, func(i, j int) bool {
+        a, b := entries[i].p, entries[j].p
+        if c := a.Addr().Compare(b.Addr()); c != 0 {
+            return c < 0
         }
+        return a.Bits() < b.Bits()
+    })
+
+    rules := make([]*Rule, len(entries))
+    for i, e := range entries {
+        rules[i] = e.r
     }
-    return false
+    return rules
 }
 
 // ----------------- IPv4 匹配 -----------------
 
 func matchIPv4(ip net.IP, s *IPSet) bool {
-    v := ipv4ToUint32(ip)
+    return s.lookupIPv4(ip) != nil
+}
 
+func (s *IPSet) lookupIPv4(ip net.IP) *Rule {
+    return s.lookupV4(ipv4ToUint32(ip))
+}
+
+// lookupV4: 已转换为 uint32 的 IPv4 匹配
+func (s *IPSet) lookupV4(v uint32) *Rule {
     // /8 桶
-    for _, c := range s.v4.p8 {
-        if (v >> c.shift) == c.shifted {
-            return true
+    for i := range s.v4.p8 {
+        if c := &s.v4.p8[i]; (v >> c.shift) == c.shifted {
+            return &s.rules[c.rule]
         }
     }
 
     // /16 桶
-    for _, c := range s.v4.p16 {
-        if (v >> c.shift) == c.shifted {
-            return true
+    for i := range s.v4.p16 {
+        if c := &s.v4.p16[i]; (v >> c.shift) == c.shifted {
+            return &s.rules[c.rule]
         }
     }
 
     // /24 桶
-    for _, c := range s.v4.p24 {
-        if (v >> c.shift) == c.shifted {
-            return true
+    for i := range s.v4.p24 {
+        if c := &s.v4.p24[i]; (v >> c.shift) == c.shifted {
+            return &s.rules[c.rule]
         }
     }
 
     // 其他前缀
-    for _, c := range s.v4.rest {
-        if (v >> c.shift) == c.shifted {
-            return true
+    for i := range s.v4.rest {
+        if c := &s.v4.rest[i]; (v >> c.shift) == c.shifted {
+            return &s.rules[c.rule]
         }
     }
 
-    return false
+    return nil
 }
 
 // ----------------- IPv6 匹配 -----------------
 
 func matchIPv6(ip net.IP, s *IPSet) bool {
-    hi, lo := ipv6ToUint128(ip)
+    return s.lookupIPv6(ip) != nil
+}
 
-    for _, c := range s.v6 {
+func (s *IPSet) lookupIPv6(ip net.IP) *Rule {
+    return s.lookupV6(ipv6ToUint128(ip))
+}
+
+// lookupV6: 已转换为高低 64 位的 IPv6 匹配
+func (s *IPSet) lookupV6(hi, lo uint64) *Rule {
+    for i := range s.v6 {
+        c := &s.v6[i]
         p := c.prefix
         if p == 0 {
-            return true
+            return &s.rules[c.rule]
         }
         if p <= 64 {
             if (hi >> (64 - p)) == c.shiftedHi {
-                return true
+                return &s.rules[c.rule]
             }
         } else {
             if hi == c.shiftedHi && (lo>>(128-p)) == c.shiftedLo {
-                return true
+                return &s.rules[c.rule]
             }
         }
     }
 
-    return false
-}
\ No newline at end of file
+    return nil
+}
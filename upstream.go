@@ -0,0 +1,117 @@
+package carbolicacid
+
+import (
+    "context"
+    "sort"
+    "sync"
+    "time"
+
+    "github.com/coredns/coredns/plugin/metadata"
+    "github.com/coredns/coredns/plugin/pkg/log"
+)
+
+const (
+    defaultUpstreamWindow = time.Minute
+
+    // unknownUpstream: 上游未知（未经过 forward，或 forward 未选出上游）
+    unknownUpstream = "unknown"
+)
+
+// Upstreams: 按上游（forward 选中的地址）统计被拦截的响应
+//
+// 上游身份来自 forward 插件设置的 metadata forward/upstream。Threshold > 0 时，
+// 一个统计窗口内被拦截次数达到 Threshold 的上游标记为 unhealthy；之后某个完整窗口内
+// 低于 Threshold 即恢复。forward 没有提供从外部下线上游的接口，unhealthy 只通过指标、
+// 日志和 Unhealthy() 暴露，不改变 forward 的选择。
+type Upstreams struct {
+    Threshold int
+    Window    time.Duration
+
+    mu    sync.Mutex
+    state map[string]*upstreamState
+}
+
+type upstreamState struct {
+    start     time.Time // 当前窗口起点
+    count     int       // 当前窗口内被拦截的次数
+    unhealthy bool
+}
+
+// withUpstreamMetadata: 未启用 metadata 插件时自建 metadata 上下文，使 forward 能写入 forward/upstream
+func withUpstreamMetadata(ctx context.Context) context.Context {
+    if metadata.ValueFuncs(ctx) == nil {
+        return metadata.ContextWithMetadata(ctx)
+    }
+    return ctx
+}
+
+// upstreamOf: 读取 forward 选中的上游地址
+func upstreamOf(ctx context.Context) string {
+    if f := metadata.ValueFunc(ctx, "forward/upstream"); f != nil {
+        if u := f(); u != "" {
+            return u
+        }
+    }
+    return unknownUpstream
+}
+
+// observe: 记录上游的一个响应；blocked 表示该响应被拦截
+//
+// 未被拦截的响应也要经过这里，窗口才能滚动，unhealthy 的上游才能恢复。
+func (u *Upstreams) observe(server, upstream string, blocked bool, now time.Time) {
+    if blocked {
+        upstreamBlockedCount.WithLabelValues(server, upstream).Inc()
+    }
+    if u.Threshold <= 0 || upstream == unknownUpstream {
+        return
+    }
+
+    u.mu.Lock()
+    defer u.mu.Unlock()
+
+    if u.state == nil {
+        u.state = make(map[string]*upstreamState)
+    }
+    s := u.state[upstream]
+    if s == nil {
+        s = &upstreamState{start: now}
+        u.state[upstream] = s
+    }
+
+    if now.Sub(s.start) >= u.Window {
+        if s.unhealthy && s.count < u.Threshold {
+            s.unhealthy = false
+            upstreamUnhealthy.WithLabelValues(server, upstream).Set(0)
+            log.Infof("[carbolicacid] upstream %s recovered: %d blocked responses in the last %s", upstream, s.count, u.Window)
+        }
+        s.start, s.count = now, 0
+    }
+
+    if !blocked {
+        return
+    }
+    s.count++
+    if !s.unhealthy && s.count >= u.Threshold {
+        s.unhealthy = true
+        upstreamUnhealthy.WithLabelValues(server, upstream).Set(1)
+        log.Warningf("[carbolicacid] upstream %s marked unhealthy: %d blocked responses within %s", upstream, s.count, u.Window)
+    }
+}
+
+// Unhealthy: 当前被标记为 unhealthy 的上游，按地址排序
+func (u *Upstreams) Unhealthy() []string {
+    if u == nil {
+        return nil
+    }
+    u.mu.Lock()
+    defer u.mu.Unlock()
+
+    var list []string
+    for addr, s := range u.state {
+        if s.unhealthy {
+            list = append(list, addr)
+        }
+    }
+    sort.Strings(list)
+    return list
+}
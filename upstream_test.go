@@ -0,0 +1,142 @@
+package carbolicacid
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    "github.com/coredns/caddy"
+    "github.com/coredns/coredns/plugin/metadata"
+    "github.com/miekg/dns"
+)
+
+// forwardNext: 像 forward 一样在 metadata 中报告选中的上游
+type forwardNext struct {
+    upstream string
+    resp     *dns.Msg
+}
+
+func (f *forwardNext) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+    metadata.SetValueFunc(ctx, "forward/upstream", func() string { return f.upstream })
+    w.WriteMsg(f.resp)
+    return dns.RcodeSuccess, nil
+}
+
+func (f *forwardNext) Name() string { return "forward" }
+
+func TestUpstreamAttribution(t *testing.T) {
+    poisoned := &forwardNext{upstream: "192.0.2.53:53", resp: makeA("example.com.", "10.1.2.3")}
+    ca := blockedServer(ActionNxdomain)
+    ca.cfg.Upstreams = &Upstreams{Threshold: 2, Window: time.Hour}
+
+    var seen string
+    ca.Next = &probeNext{next: poisoned, fn: func(ctx context.Context) { seen = upstreamOf(ctx) }}
+
+    // 未启用 metadata 插件也能拿到上游
+    for i := 0; i < 2; i++ {
+        if _, err := ca.ServeDNS(context.Background(), &testResponseWriter{}, makeA("example.com.", "10.1.2.3")); err != nil {
+            t.Fatalf("ServeDNS error: %v", err)
+        }
+    }
+    if seen != "192.0.2.53:53" {
+        t.Fatalf("upstream not captured, got %q", seen)
+    }
+    if got := ca.UnhealthyUpstreams(); len(got) != 1 || got[0] != "192.0.2.53:53" {
+        t.Fatalf("expected upstream to be marked unhealthy, got %v", got)
+    }
+}
+
+// probeNext: 调用 next 之后检查 ctx
+type probeNext struct {
+    next *forwardNext
+    fn   func(ctx context.Context)
+}
+
+func (p *probeNext) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+    rc, err := p.next.ServeDNS(ctx, w, r)
+    p.fn(ctx)
+    return rc, err
+}
+
+func (p *probeNext) Name() string { return "probe" }
+
+func TestUpstreamsWindow(t *testing.T) {
+    u := &Upstreams{Threshold: 3, Window: time.Minute}
+    now := time.Unix(1700000000, 0)
+    const up = "192.0.2.53:53"
+
+    // 窗口内 2 次：不标记
+    u.observe("dns://:53", up, true, now)
+    u.observe("dns://:53", up, true, now.Add(10*time.Second))
+    u.observe("dns://:53", up, false, now.Add(20*time.Second))
+    if len(u.Unhealthy()) != 0 {
+        t.Fatalf("marked unhealthy below threshold")
+    }
+
+    // 新窗口重新计数，达到 3 次 → unhealthy
+    for i := 0; i < 3; i++ {
+        u.observe("dns://:53", up, true, now.Add(time.Minute+time.Duration(i)*time.Second))
+    }
+    if got := u.Unhealthy(); len(got) != 1 {
+        t.Fatalf("expected unhealthy upstream, got %v", got)
+    }
+
+    // 下一个窗口：上一窗口达到阈值，保持 unhealthy
+    u.observe("dns://:53", up, false, now.Add(2*time.Minute))
+    if len(u.Unhealthy()) != 1 {
+        t.Fatalf("recovered before a clean window")
+    }
+
+    // 再下一个窗口：上一窗口低于阈值，恢复
+    u.observe("dns://:53", up, false, now.Add(3*time.Minute))
+    if len(u.Unhealthy()) != 0 {
+        t.Fatalf("expected upstream to recover")
+    }
+
+    // 未知上游不参与标记
+    for i := 0; i < 5; i++ {
+        u.observe("dns://:53", unknownUpstream, true, now.Add(3*time.Minute))
+    }
+    if len(u.Unhealthy()) != 0 {
+        t.Fatalf("unknown upstream must not be marked unhealthy")
+    }
+}
+
+func TestParseConfigUpstreams(t *testing.T) {
+    cfg, err := parseConfig(caddy.NewTestController("dns", `carbolicacid {
+        preset iana
+        upstreams unhealthy 20 5m
+    }`))
+    if err != nil {
+        t.Fatalf("parseConfig failed: %v", err)
+    }
+    if u := cfg.Upstreams; u == nil || u.Threshold != 20 || u.Window != 5*time.Minute {
+        t.Fatalf("unexpected upstreams config: %+v", cfg.Upstreams)
+    }
+
+    cfg, err = parseConfig(caddy.NewTestController("dns", `carbolicacid {
+        upstreams
+    }`))
+    if err != nil || cfg.Upstreams == nil || cfg.Upstreams.Threshold != 0 {
+        t.Fatalf("unexpected result for bare upstreams: %+v %v", cfg.Upstreams, err)
+    }
+
+    for i, input := range []string{
+        `carbolicacid {
+            upstreams unhealthy
+        }`,
+        `carbolicacid {
+            upstreams unhealthy 0
+        }`,
+        `carbolicacid {
+            upstreams unhealthy 5 soon
+        }`,
+        `carbolicacid {
+            upstreams sick 5
+        }`,
+    } {
+        if _, err := parseConfig(caddy.NewTestController("dns", input)); err == nil {
+            t.Errorf("test %d: expected error for input %s", i, input)
+        }
+    }
+}
@@ -0,0 +1,134 @@
+package carbolicacid
+
+import (
+    "context"
+    "time"
+
+    "github.com/coredns/coredns/plugin/metrics"
+    "github.com/coredns/coredns/plugin/pkg/log"
+    "github.com/miekg/dns"
+)
+
+const (
+    defaultVerifyCacheSize = 1024
+    defaultVerifyCacheTTL  = 5 * time.Minute
+    verifyNoAddrTTL        = time.Minute // 可信应答没有地址记录时的缓存时间
+)
+
+// Verify: 共识模式
+//
+// 响应命中双表后，通过 TCP / DoT 向可信上游查询同一名称。可信应答包含上游应答中的
+// 全部 A/AAAA 地址时，认为该名称确实解析到这些地址（例如合法的内网名称），放行；
+// 否则按 responses 动作处理。结果按可信应答的 TTL（不超过 CacheTTL）缓存。
+type Verify struct {
+    Upstreams     []string
+    Timeout       time.Duration
+    TLSServerName string
+    CacheSize     int           // 0 表示不缓存
+    CacheTTL      time.Duration // 缓存时间上限
+    PassOnError   bool          // 可信上游不可用时放行（默认仍阻断）
+
+    resolver *resolver
+    cache    *verdictCache
+}
+
+// init: 解析可信上游地址（dns:// 强制使用 TCP），创建缓存
+func (v *Verify) init() error {
+    rs, err := newResolver(v.Upstreams, v.TLSServerName, v.Timeout, true)
+    if err != nil {
+        return err
+    }
+    v.resolver = rs
+    if v.CacheSize > 0 {
+        v.cache = newVerdictCache(v.CacheSize)
+    }
+    return nil
+}
+
+// confirm: 对已命中的响应做共识确认，返回是否仍应阻断
+func (v *Verify) confirm(ctx context.Context, resp *dns.Msg, reason string) bool {
+    if len(resp.Question) == 0 {
+        return true
+    }
+    server := metrics.WithServer(ctx)
+    now := time.Now()
+
+    var key uint64
+    if v.cache != nil {
+        key = responseKey(resp)
+        if cv, ok := v.cache.get(key, now); ok {
+            verifyCount.WithLabelValues(server, verifyResult(cv.blocked), "hit").Inc()
+            return cv.blocked
+        }
+    }
+
+    q := resp.Question[0]
+    m := new(dns.Msg)
+    m.SetQuestion(q.Name, q.Qtype)
+    m.SetEdns0(dns.DefaultMsgSize, false)
+
+    trusted, addr, err := v.resolver.exchange(ctx, m)
+    if err != nil {
+        verifyCount.WithLabelValues(server, "error", "miss").Inc()
+        log.Warningf("[carbolicacid] verify %s failed: %v", q.Name, err)
+        return !v.PassOnError
+    }
+
+    blocked := !containsAddrs(trusted, resp)
+    verifyCount.WithLabelValues(server, verifyResult(blocked), "miss").Inc()
+    if !blocked {
+        log.Infof("[carbolicacid] verify %s matched %q but trusted resolver %s agrees, pass", q.Name, reason, addr)
+    }
+
+    if v.cache != nil {
+        ttl := time.Duration(minAnswerTTL(trusted)) * time.Second
+        if ttl == 0 {
+            ttl = verifyNoAddrTTL
+        }
+        if ttl > v.CacheTTL {
+            ttl = v.CacheTTL
+        }
+        v.cache.add(key, cachedVerdict{blocked: blocked, reason: reason}, ttl, now)
+    }
+    return blocked
+}
+
+func verifyResult(blocked bool) string {
+    if blocked {
+        return "differ"
+    }
+    return "agree"
+}
+
+// containsAddrs: trusted 的 Answer 是否包含 resp 的 Answer 中的全部 A/AAAA 地址
+//
+// resp 中没有地址记录时（preset allip 下的 NODATA 等）要求 trusted 同样没有。
+func containsAddrs(trusted, resp *dns.Msg) bool {
+    have := make(map[string]bool)
+    for _, rr := range trusted.Answer {
+        switch a := rr.(type) {
+        case *dns.A:
+            have[a.A.String()] = true
+        case *dns.AAAA:
+            have[a.AAAA.String()] = true
+        }
+    }
+
+    n := 0
+    for _, rr := range resp.Answer {
+        var ip string
+        switch a := rr.(type) {
+        case *dns.A:
+            ip = a.A.String()
+        case *dns.AAAA:
+            ip = a.AAAA.String()
+        default:
+            continue
+        }
+        if !have[ip] {
+            return false
+        }
+        n++
+    }
+    return n > 0 || len(have) == 0
+}
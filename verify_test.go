@@ -0,0 +1,164 @@
+package carbolicacid
+
+import (
+    "context"
+    "net"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "github.com/coredns/caddy"
+    "github.com/miekg/dns"
+)
+
+// trustedUpstream: 进程内的 TCP dns.Server，返回给定的 A 记录，并统计查询次数
+func trustedUpstream(t *testing.T, ips ...string) (string, *int32) {
+    t.Helper()
+    l, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("listen: %v", err)
+    }
+
+    var queries int32
+    started := make(chan struct{})
+    srv := &dns.Server{
+        Listener:          l,
+        NotifyStartedFunc: func() { close(started) },
+        Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+            atomic.AddInt32(&queries, 1)
+            m := new(dns.Msg)
+            m.SetReply(r)
+            for _, ip := range ips {
+                m.Answer = append(m.Answer, &dns.A{
+                    Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+                    A:   net.ParseIP(ip),
+                })
+            }
+            if len(ips) == 0 {
+                m.Rcode = dns.RcodeNameError
+            }
+            w.WriteMsg(m)
+        }),
+    }
+    go srv.ActivateAndServe()
+    <-started
+    t.Cleanup(func() { srv.Shutdown() })
+
+    return l.Addr().String(), &queries
+}
+
+func verifyServer(upstream string) *CarbolicAcid {
+    ca := blockedServer(ActionNxdomain)
+    ca.cfg.Verify = &Verify{
+        Upstreams: []string{upstream},
+        Timeout:   500 * time.Millisecond,
+        CacheSize: 16,
+        CacheTTL:  time.Minute,
+    }
+    return ca
+}
+
+func serveA(t *testing.T, ca *CarbolicAcid) *dns.Msg {
+    t.Helper()
+    w := &wireResponseWriter{remote: &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 53000}}
+    r := new(dns.Msg)
+    r.SetQuestion("example.com.", dns.TypeA)
+    if _, err := ca.ServeDNS(context.Background(), w, r); err != nil {
+        t.Fatalf("ServeDNS error: %v", err)
+    }
+    return w.received(t)
+}
+
+func TestVerifyTrustedAgrees(t *testing.T) {
+    // 可信上游也解析到 10.1.2.3（合法的内网名称）→ 放行，且结果被缓存
+    addr, queries := trustedUpstream(t, "10.1.2.3", "10.1.2.4")
+    ca := verifyServer(addr)
+
+    for i := 0; i < 3; i++ {
+        m := serveA(t, ca)
+        if m.Rcode != dns.RcodeSuccess || len(m.Answer) != 1 {
+            t.Fatalf("expected the upstream answer to pass, got %v", m)
+        }
+    }
+    if n := atomic.LoadInt32(queries); n != 1 {
+        t.Fatalf("expected 1 trusted query thanks to the cache, got %d", n)
+    }
+}
+
+func TestVerifyTrustedDiffers(t *testing.T) {
+    addr, _ := trustedUpstream(t, "93.184.216.34")
+    ca := verifyServer(addr)
+
+    if m := serveA(t, ca); m.Rcode != dns.RcodeNameError {
+        t.Fatalf("expected NXDOMAIN when the trusted answer differs, got %v", m)
+    }
+}
+
+func TestVerifyTrustedNXDOMAIN(t *testing.T) {
+    addr, _ := trustedUpstream(t)
+    ca := verifyServer(addr)
+
+    if m := serveA(t, ca); m.Rcode != dns.RcodeNameError {
+        t.Fatalf("expected NXDOMAIN when the trusted resolver has no address, got %v", m)
+    }
+}
+
+func TestVerifyTrustedUnreachable(t *testing.T) {
+    l, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    addr := l.Addr().String()
+    l.Close()
+
+    ca := verifyServer(addr)
+    if m := serveA(t, ca); m.Rcode != dns.RcodeNameError {
+        t.Fatalf("on_error block: expected NXDOMAIN, got %v", m)
+    }
+
+    ca = verifyServer(addr)
+    ca.cfg.Verify.PassOnError = true
+    if m := serveA(t, ca); m.Rcode != dns.RcodeSuccess || len(m.Answer) != 1 {
+        t.Fatalf("on_error pass: expected the upstream answer, got %v", m)
+    }
+}
+
+func TestParseConfigVerify(t *testing.T) {
+    cfg, err := parseConfig(caddy.NewTestController("dns", `carbolicacid {
+        preset allip
+        verify tls://1.1.1.1 {
+            tls_servername cloudflare-dns.com
+            timeout 1s
+            cache 4096 10m
+            on_error pass
+        }
+    }`))
+    if err != nil {
+        t.Fatalf("parseConfig failed: %v", err)
+    }
+    v := cfg.Verify
+    if v == nil || v.Timeout != time.Second || v.CacheSize != 4096 || v.CacheTTL != 10*time.Minute || !v.PassOnError || v.TLSServerName != "cloudflare-dns.com" {
+        t.Fatalf("unexpected verify config: %+v", v)
+    }
+
+    for i, input := range []string{
+        `carbolicacid {
+            verify
+        }`,
+        `carbolicacid {
+            verify 1.1.1.1 { cache -1 }
+        }`,
+        `carbolicacid {
+            verify 1.1.1.1 { on_error ignore }
+        }`,
+        `carbolicacid {
+            verify 1.1.1.1 {
+                retries 3
+            }
+        }`,
+    } {
+        if _, err := parseConfig(caddy.NewTestController("dns", input)); err == nil {
+            t.Errorf("test %d: expected error for input %s", i, input)
+        }
+    }
+}